@@ -1,17 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/gorilla/mux"
-	_ "github.com/gorilla/mux" //registering the driver
-	"github.com/stripe/stripe-go/v82"
-)
+	_ "github.com/lib/pq" // registering the driver
 
-var db *sql.DB
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/server"
+	"github.com/Brossef/rescounts-task/internal/storage"
+	"github.com/Brossef/rescounts-task/internal/store/postgres"
+)
 
 func main() {
 
@@ -23,8 +26,7 @@ func main() {
 		" sslmode=disable"
 	// dsn := "host=db port=5432 user=rescounts_user password=rescounts_pass dbname=rescounts_db sslmode=disable"
 	log.Printf("DSN: %q\n", dsn)
-	var err error
-	db, err = sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		log.Fatal("cannot open database:", err)
 	}
@@ -33,67 +35,77 @@ func main() {
 	}
 	defer db.Close()
 
-	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
-	if stripeKey == "" {
-		log.Fatal("STRIPE_SECRET_KEY is not set")
+	// Subcommands: `server migrate ...`; no arguments (or `serve`) runs the HTTP server.
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		if os.Args[1] != "migrate" {
+			log.Fatalf("unknown command %q (expected \"serve\" or \"migrate\")", os.Args[1])
+		}
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatal("migrate: ", err)
+		}
+		return
 	}
-	stripe.Key = stripeKey
-
-	r := mux.NewRouter()
-
-	r.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Hello world!"))
-	}).Methods("GET")
-
-	r.HandleFunc("/signup", signupHandler).Methods("POST")
-	r.HandleFunc("/login", loginHandler).Methods("POST")
-	r.Handle("/products", jwtMiddleware(http.HandlerFunc(listProductsHandler))).Methods("GET")
 
-	// Admin-only routes (through JWT -> adminMiddleware):
-	r.Handle(
-		"/admin/products",
-		jwtMiddleware(adminMiddleware(http.HandlerFunc(createProductHandler))),
-	).Methods("POST")
-
-	r.Handle(
-		"/admin/products/{id}",
-		jwtMiddleware(adminMiddleware(http.HandlerFunc(updateProductHandler))),
-	).Methods("PUT")
-
-	r.Handle(
-		"/admin/products/{id}",
-		jwtMiddleware(adminMiddleware(http.HandlerFunc(deleteProductHandler))),
-	).Methods("DELETE")
-
-	r.Handle(
-		"/users/buy",
-		jwtMiddleware(http.HandlerFunc(buyProductsHandler)),
-	).Methods("POST")
+	if err := migrateOnStart(db); err != nil {
+		log.Fatal("cannot migrate database: ", err)
+	}
 
-	r.Handle(
-		"/users/history",
-		jwtMiddleware(http.HandlerFunc(getUserHistoryHandler)),
-	).Methods("GET")
+	payments, err := payment.New(os.Getenv("PAYMENT_PROVIDER"), os.Getenv("STRIPE_SECRET_KEY"))
+	if err != nil {
+		log.Fatal("cannot configure payment provider:", err)
+	}
+	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		log.Println("WARNING: STRIPE_WEBHOOK_SECRET is not set; /webhooks/stripe will reject events")
+	}
 
-	r.Handle(
-		"/admin/sales",
-		jwtMiddleware(adminMiddleware(http.HandlerFunc(getSalesHandler))),
-	).Methods("GET")
+	media, err := storage.New(storage.Config{
+		Backend:           os.Getenv("STORAGE_BACKEND"),
+		LocalDir:          os.Getenv("MEDIA_DIR"),
+		BaseURL:           os.Getenv("MEDIA_BASE_URL"),
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          os.Getenv("S3_REGION"),
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+	})
+	if err != nil {
+		log.Fatal("cannot configure media storage:", err)
+	}
 
-	r.Handle(
-		"/users/creditcards",
-		jwtMiddleware(http.HandlerFunc(addCreditCardHandler)),
-	).Methods("POST")
+	srv := server.New(postgres.New(db), payments, media, server.Config{
+		JWTSecret:     []byte(os.Getenv("JWT_SECRET")),
+		WebhookSecret: webhookSecret,
+	})
+
+	// Flag expiring/expired cards in the background (CARD_EXPIRY_CHECK_INTERVAL=0 disables it)
+	expiryInterval := 24 * time.Hour
+	if v := os.Getenv("CARD_EXPIRY_CHECK_INTERVAL"); v != "" {
+		expiryInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("invalid CARD_EXPIRY_CHECK_INTERVAL: ", err)
+		}
+	}
+	if expiryInterval > 0 {
+		go srv.RunCardExpiryJob(context.Background(), expiryInterval)
+	}
 
-	r.Handle(
-		"/users/creditcards/{card_id}",
-		jwtMiddleware(http.HandlerFunc(deleteCreditCardHandler)),
-	).Methods("DELETE")
+	// Release the stock of orders whose payment never reached Stripe (ABANDONED_ORDER_CHECK_INTERVAL=0 disables it)
+	abandonedInterval := 10 * time.Minute
+	if v := os.Getenv("ABANDONED_ORDER_CHECK_INTERVAL"); v != "" {
+		abandonedInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("invalid ABANDONED_ORDER_CHECK_INTERVAL: ", err)
+		}
+	}
+	if abandonedInterval > 0 {
+		go srv.RunAbandonedOrderJob(context.Background(), abandonedInterval)
+	}
 
 	addr := ":8080"
 	log.Printf("Listening on %s…\n", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
+	if err := http.ListenAndServe(addr, srv.Routes()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS admins;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS credit_cards;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,21 @@
+-- Only single-line orders fit the old `purchases` shape; other orders are lost.
+
+CREATE TABLE purchases (
+  id SERIAL PRIMARY KEY,
+  user_id INT REFERENCES users(id) ON DELETE CASCADE,
+  product_id INT REFERENCES products(id) ON DELETE SET NULL,
+  quantity INT NOT NULL,
+  total_price_cents INT NOT NULL,
+  stripe_payment_intent_id VARCHAR(100) UNIQUE NOT NULL,
+  purchased_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO purchases
+  (user_id, product_id, quantity, total_price_cents, stripe_payment_intent_id, purchased_at)
+SELECT o.user_id, ol.product_id, ol.quantity, ol.total_price_cents, o.stripe_payment_intent_id, o.created_at
+  FROM orders o
+  JOIN order_lines ol ON ol.order_id = o.id
+ WHERE (SELECT COUNT(*) FROM order_lines x WHERE x.order_id = o.id) = 1;
+
+DROP TABLE order_lines;
+DROP TABLE orders;
@@ -0,0 +1,40 @@
+-- Replaces the single-row `purchases` table with `orders` + `order_lines`.
+--
+-- Every legacy purchase carried its own PaymentIntent (the column was
+-- UNIQUE), so each one becomes a paid order with a single line.
+
+CREATE TABLE orders (
+  id SERIAL PRIMARY KEY,
+  user_id INT REFERENCES users(id) ON DELETE CASCADE,
+  stripe_payment_intent_id VARCHAR(100) UNIQUE NOT NULL,
+  status VARCHAR(30) NOT NULL DEFAULT 'pending',
+  total_cents INT NOT NULL,
+  currency CHAR(3) NOT NULL DEFAULT 'cad',
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE order_lines (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  product_id INT REFERENCES products(id) ON DELETE SET NULL,
+  quantity INT NOT NULL,
+  unit_price_cents INT NOT NULL,
+  total_price_cents INT NOT NULL
+);
+
+CREATE INDEX order_lines_order_id_idx ON order_lines(order_id);
+CREATE INDEX orders_user_id_idx ON orders(user_id);
+
+INSERT INTO orders
+  (user_id, stripe_payment_intent_id, status, total_cents, currency, created_at, updated_at)
+SELECT user_id, stripe_payment_intent_id, 'paid', total_price_cents, 'cad', purchased_at, purchased_at
+  FROM purchases;
+
+INSERT INTO order_lines
+  (order_id, product_id, quantity, unit_price_cents, total_price_cents)
+SELECT o.id, pu.product_id, pu.quantity, pu.total_price_cents / pu.quantity, pu.total_price_cents
+  FROM purchases pu
+  JOIN orders o ON o.stripe_payment_intent_id = pu.stripe_payment_intent_id;
+
+DROP TABLE purchases;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS stripe_events;
+ALTER TABLE orders DROP COLUMN IF EXISTS refunded_cents;
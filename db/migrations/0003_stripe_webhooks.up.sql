@@ -0,0 +1,10 @@
+-- Tables and columns used by POST /webhooks/stripe.
+
+ALTER TABLE orders ADD COLUMN refunded_cents INT NOT NULL DEFAULT 0;
+
+-- Stripe webhook events already processed (deliveries are at-least-once).
+CREATE TABLE stripe_events (
+  id VARCHAR(100) PRIMARY KEY,
+  type VARCHAR(100) NOT NULL,
+  received_at TIMESTAMP DEFAULT NOW()
+);
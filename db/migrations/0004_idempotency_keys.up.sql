@@ -0,0 +1,12 @@
+-- Stored responses for requests sent with an Idempotency-Key header.
+-- response_status is NULL while the original request is still running.
+CREATE TABLE idempotency_keys (
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  idempotency_key VARCHAR(255) NOT NULL,
+  request_hash CHAR(64) NOT NULL,
+  response_status INT,
+  response_content_type VARCHAR(100),
+  response_body BYTEA,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (user_id, idempotency_key)
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS stock_adjustments;
+-- Orders that never got a PaymentIntent cannot satisfy NOT NULL again.
+DELETE FROM orders WHERE stripe_payment_intent_id IS NULL;
+ALTER TABLE orders ALTER COLUMN stripe_payment_intent_id SET NOT NULL;
+ALTER TABLE products
+  DROP COLUMN IF EXISTS unlimited_stock,
+  DROP COLUMN IF EXISTS stock_quantity;
@@ -0,0 +1,22 @@
+-- Stock tracking. Existing products are marked unlimited so they stay buyable
+-- until an admin sets their stock.
+
+ALTER TABLE products
+  ADD COLUMN stock_quantity INT NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  ADD COLUMN unlimited_stock BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE products SET unlimited_stock = TRUE;
+
+-- Orders are now created (pending) before the PaymentIntent exists.
+ALTER TABLE orders ALTER COLUMN stripe_payment_intent_id DROP NOT NULL;
+
+-- Audit trail of every stock movement (admin adjustments and checkout reservations).
+CREATE TABLE stock_adjustments (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  delta INT NOT NULL,
+  reason TEXT NOT NULL,
+  admin_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+  order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS refund_lines;
+DROP TABLE IF EXISTS refunds;
+ALTER TABLE order_lines DROP COLUMN IF EXISTS refunded_quantity;
@@ -0,0 +1,23 @@
+-- Refund tracking for POST /admin/orders/{id}/refunds.
+
+ALTER TABLE order_lines ADD COLUMN refunded_quantity INT NOT NULL DEFAULT 0;
+
+CREATE TABLE refunds (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  stripe_refund_id VARCHAR(100) UNIQUE NOT NULL,
+  amount_cents INT NOT NULL,
+  status VARCHAR(30) NOT NULL,
+  reason TEXT,
+  restocked BOOLEAN NOT NULL DEFAULT FALSE,
+  admin_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE refund_lines (
+  refund_id INT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+  order_line_id INT NOT NULL REFERENCES order_lines(id) ON DELETE CASCADE,
+  quantity INT NOT NULL,
+  amount_cents INT NOT NULL,
+  PRIMARY KEY (refund_id, order_line_id)
+);
@@ -0,0 +1,22 @@
+-- Rotating refresh tokens, stored as SHA-256 hashes. Tokens rotated from the
+-- same login share a family_id so a reused token can revoke the whole chain.
+CREATE TABLE refresh_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash CHAR(64) UNIQUE NOT NULL,
+  family_id VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  replaced_by INT REFERENCES refresh_tokens(id),
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+
+-- Access tokens (by jti) revoked before they expire.
+CREATE TABLE revoked_access_tokens (
+  jti VARCHAR(64) PRIMARY KEY,
+  user_id INT REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP DEFAULT NOW()
+);
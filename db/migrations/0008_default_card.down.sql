@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS credit_cards_one_default_per_user;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS is_default;
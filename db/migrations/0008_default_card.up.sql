@@ -0,0 +1,10 @@
+-- A default card per user, used by /users/buy when no card is given.
+
+ALTER TABLE credit_cards ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing users get their most recently added card as default.
+UPDATE credit_cards SET is_default = TRUE
+ WHERE id IN (SELECT MAX(id) FROM credit_cards GROUP BY user_id);
+
+CREATE UNIQUE INDEX credit_cards_one_default_per_user
+    ON credit_cards (user_id) WHERE is_default;
@@ -0,0 +1 @@
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS expiry_status;
@@ -0,0 +1,4 @@
+-- Expiry state of saved cards, kept up to date by the card expiry job:
+-- 'valid', 'expiring' (expires within 30 days) or 'expired'.
+
+ALTER TABLE credit_cards ADD COLUMN expiry_status VARCHAR(20) NOT NULL DEFAULT 'valid';
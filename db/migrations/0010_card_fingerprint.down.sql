@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS credit_cards_user_fingerprint;
+ALTER TABLE credit_cards DROP COLUMN IF EXISTS fingerprint;
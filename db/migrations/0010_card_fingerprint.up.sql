@@ -0,0 +1,7 @@
+-- Stripe card fingerprints, so the same card cannot be saved twice by a user.
+-- Cards saved before this migration have no fingerprint (NULLs never collide).
+
+ALTER TABLE credit_cards ADD COLUMN fingerprint VARCHAR(100);
+
+CREATE UNIQUE INDEX credit_cards_user_fingerprint
+    ON credit_cards (user_id, fingerprint);
@@ -0,0 +1,13 @@
+-- Server-side shopping carts. price_cents is the price the user saw when the
+-- item was added, so checkout can detect price changes since then.
+
+CREATE TABLE cart_items (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  price_cents INT NOT NULL,
+  added_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (user_id, product_id)
+);
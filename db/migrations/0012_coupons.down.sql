@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_cents;
+ALTER TABLE order_lines DROP COLUMN IF EXISTS discount_cents;
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS coupon_products;
+DROP TABLE IF EXISTS coupons;
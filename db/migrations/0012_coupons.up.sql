@@ -0,0 +1,47 @@
+-- Admin-managed coupons and the discounts they gave.
+--
+-- value is a percentage (1-100) for 'percent' coupons and an amount in cents for
+-- 'fixed' ones. NULL limits and validity bounds mean "no limit". A coupon with
+-- rows in coupon_products only discounts those products.
+
+CREATE TABLE coupons (
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(50) NOT NULL,
+  discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+  value INT NOT NULL CHECK (value > 0),
+  min_order_cents INT NOT NULL DEFAULT 0,
+  max_redemptions INT,
+  max_redemptions_per_user INT,
+  starts_at TIMESTAMP,
+  ends_at TIMESTAMP,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Codes are matched case-insensitively.
+CREATE UNIQUE INDEX coupons_code_key ON coupons (LOWER(code));
+
+CREATE TABLE coupon_products (
+  coupon_id INT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  PRIMARY KEY (coupon_id, product_id)
+);
+
+-- One row per coupon redeemed by an order. code is kept so reports survive the
+-- coupon being deleted.
+CREATE TABLE order_discounts (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+  coupon_id INT REFERENCES coupons(id) ON DELETE SET NULL,
+  user_id INT REFERENCES users(id) ON DELETE SET NULL,
+  code VARCHAR(50) NOT NULL,
+  amount_cents INT NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX order_discounts_coupon_id_idx ON order_discounts(coupon_id);
+
+-- Share of the order discount carried by each line, so per-line refunds return
+-- what was actually paid.
+ALTER TABLE order_lines ADD COLUMN discount_cents INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount_cents INT NOT NULL DEFAULT 0;
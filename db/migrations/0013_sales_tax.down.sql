@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS orders_tax_province_idx;
+DROP TABLE IF EXISTS order_line_taxes;
+ALTER TABLE order_lines DROP COLUMN IF EXISTS tax_cents;
+ALTER TABLE order_lines DROP COLUMN IF EXISTS tax_category;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_cents;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_province;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_province;
+ALTER TABLE products DROP COLUMN IF EXISTS tax_category;
@@ -0,0 +1,24 @@
+-- Canadian sales tax. Products carry a tax category, users a billing province,
+-- and every order line the taxes charged on it (one row per GST/HST/PST/QST).
+-- Orders placed before this migration have no province and no tax.
+
+ALTER TABLE products ADD COLUMN tax_category VARCHAR(20) NOT NULL DEFAULT 'taxable'
+    CHECK (tax_category IN ('taxable', 'exempt', 'zero_rated'));
+
+ALTER TABLE users ADD COLUMN billing_province CHAR(2);
+
+ALTER TABLE orders ADD COLUMN tax_province CHAR(2);
+ALTER TABLE orders ADD COLUMN tax_cents INT NOT NULL DEFAULT 0;
+
+ALTER TABLE order_lines ADD COLUMN tax_category VARCHAR(20) NOT NULL DEFAULT 'taxable';
+ALTER TABLE order_lines ADD COLUMN tax_cents INT NOT NULL DEFAULT 0;
+
+CREATE TABLE order_line_taxes (
+  order_line_id INT NOT NULL REFERENCES order_lines(id) ON DELETE CASCADE,
+  tax_type VARCHAR(3) NOT NULL,
+  rate_percent NUMERIC(6,3) NOT NULL,
+  amount_cents INT NOT NULL,
+  PRIMARY KEY (order_line_id, tax_type)
+);
+
+CREATE INDEX orders_tax_province_idx ON orders(tax_province, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS fx_rate;
+DROP TABLE IF EXISTS product_prices;
+DROP TABLE IF EXISTS fx_rates;
@@ -0,0 +1,20 @@
+-- Multi-currency pricing. products.price_cents stays the price in the base
+-- currency (CAD). A product sells in another currency at its explicit price in
+-- product_prices, or else at its base price converted with fx_rates, where rate
+-- is how much of the currency one CAD buys.
+
+CREATE TABLE fx_rates (
+  currency CHAR(3) PRIMARY KEY,
+  rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE product_prices (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  currency CHAR(3) NOT NULL,
+  price_cents INT NOT NULL CHECK (price_cents > 0),
+  PRIMARY KEY (product_id, currency)
+);
+
+-- Rate the order was priced at, to report it in the base currency.
+ALTER TABLE orders ADD COLUMN fx_rate NUMERIC(18,8) NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_products_created_at;
+DROP INDEX IF EXISTS idx_products_name;
+DROP INDEX IF EXISTS idx_products_price;
+ALTER TABLE products ALTER COLUMN created_at DROP NOT NULL;
@@ -0,0 +1,9 @@
+-- Keyset pagination of GET /products. Every product needs a created_at to be
+-- sorted by it, and each sort key gets an index ending in the id tie-breaker.
+
+UPDATE products SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE products ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX idx_products_price ON products (price_cents, id);
+CREATE INDEX idx_products_name ON products (name, id);
+CREATE INDEX idx_products_created_at ON products (created_at, id);
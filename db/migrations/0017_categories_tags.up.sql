@@ -0,0 +1,36 @@
+-- Product categories (a tree, browsed by slug) and free-form tags, both
+-- assigned to products many-to-many.
+
+CREATE TABLE categories (
+  id SERIAL PRIMARY KEY,
+  parent_id INT REFERENCES categories(id) ON DELETE RESTRICT,
+  name VARCHAR(100) NOT NULL,
+  slug VARCHAR(100) NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  CHECK (parent_id <> id)
+);
+
+CREATE INDEX idx_categories_parent ON categories (parent_id);
+
+CREATE TABLE product_categories (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+  PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX idx_product_categories_category ON product_categories (category_id);
+
+-- Tag names are stored trimmed and lower-cased.
+CREATE TABLE tags (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE product_tags (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (product_id, tag_id)
+);
+
+CREATE INDEX idx_product_tags_tag ON product_tags (tag_id);
@@ -0,0 +1,20 @@
+-- Product images. The files (original and thumbnail) live in the storage
+-- backend under their keys; rows are listed by position.
+
+CREATE TABLE product_images (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  storage_key VARCHAR(255) NOT NULL,
+  thumbnail_key VARCHAR(255) NOT NULL,
+  content_type VARCHAR(50) NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  position INT NOT NULL,
+  is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_images_product ON product_images (product_id, position);
+
+-- At most one primary image per product.
+CREATE UNIQUE INDEX idx_product_images_primary ON product_images (product_id) WHERE is_primary;
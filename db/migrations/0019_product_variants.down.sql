@@ -0,0 +1,14 @@
+ALTER TABLE stock_adjustments DROP COLUMN IF EXISTS variant_id;
+
+DROP INDEX IF EXISTS idx_cart_items_user_product_variant;
+DELETE FROM cart_items WHERE variant_id IS NOT NULL;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE cart_items ADD CONSTRAINT cart_items_user_id_product_id_key UNIQUE (user_id, product_id);
+
+ALTER TABLE order_lines
+  DROP COLUMN IF EXISTS variant_options,
+  DROP COLUMN IF EXISTS variant_sku,
+  DROP COLUMN IF EXISTS variant_id;
+
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_options;
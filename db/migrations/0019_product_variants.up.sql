@@ -0,0 +1,41 @@
+-- Product variants. A product may define options (e.g. size, color) and sell
+-- as variants: SKUs with one value per option, their own stock and, optionally,
+-- their own base-currency price. Products with variants are only bought through
+-- one of them; their product-level stock is unused.
+
+CREATE TABLE product_options (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  name VARCHAR(50) NOT NULL,
+  option_values TEXT[] NOT NULL,
+  position INT NOT NULL,
+  UNIQUE (product_id, name)
+);
+
+-- options maps each option name to the variant's value.
+CREATE TABLE product_variants (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  sku VARCHAR(64) NOT NULL UNIQUE,
+  options JSONB NOT NULL DEFAULT '{}',
+  price_cents INT CHECK (price_cents > 0),
+  stock_quantity INT NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  unlimited_stock BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  UNIQUE (product_id, options)
+);
+
+-- Order lines keep the variant as sold, even if it is later changed or deleted.
+ALTER TABLE order_lines
+  ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE SET NULL,
+  ADD COLUMN variant_sku VARCHAR(64),
+  ADD COLUMN variant_options JSONB;
+
+ALTER TABLE cart_items
+  ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE,
+  DROP CONSTRAINT IF EXISTS cart_items_user_id_product_id_key;
+CREATE UNIQUE INDEX idx_cart_items_user_product_variant
+  ON cart_items (user_id, product_id, COALESCE(variant_id, 0));
+
+ALTER TABLE stock_adjustments
+  ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+ALTER TABLE order_lines DROP COLUMN IF EXISTS product_name;
+DROP INDEX IF EXISTS idx_products_active;
+ALTER TABLE products DROP COLUMN IF EXISTS archived_at;
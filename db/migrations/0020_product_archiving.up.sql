@@ -0,0 +1,13 @@
+-- Archived products are hidden from the catalog and cannot be bought, but are
+-- kept so past orders still resolve them. Products are no longer deleted.
+
+ALTER TABLE products ADD COLUMN archived_at TIMESTAMP;
+
+CREATE INDEX idx_products_active ON products (id) WHERE archived_at IS NULL;
+
+-- Order lines keep the product's name as sold (unit_price_cents already keeps
+-- its price), so history reads the same whatever later happens to the product.
+-- Older lines take the product's current name; lines of products deleted
+-- before archiving have none.
+ALTER TABLE order_lines ADD COLUMN product_name VARCHAR(100);
+UPDATE order_lines ol SET product_name = p.name FROM products p WHERE p.id = ol.product_id;
@@ -0,0 +1,21 @@
+-- Product price history: a row for every change of a product's name, base
+-- price or explicit currency prices, so past prices can be audited.
+CREATE TABLE product_price_history (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  price_cents INT NOT NULL,
+  -- Explicit prices in other currencies, by currency code; NULL for none.
+  prices JSONB,
+  admin_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+  changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_price_history_product ON product_price_history (product_id, id);
+
+-- Start every existing product's history with its current state.
+INSERT INTO product_price_history (product_id, name, price_cents, prices, changed_at)
+SELECT p.id, p.name, p.price_cents,
+       (SELECT jsonb_object_agg(pp.currency, pp.price_cents) FROM product_prices pp WHERE pp.product_id = p.id),
+       COALESCE(p.created_at, NOW())
+  FROM products p;
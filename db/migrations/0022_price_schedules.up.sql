@@ -0,0 +1,17 @@
+-- Scheduled prices. While a schedule runs (starts_at <= now < ends_at, or
+-- from starts_at on when ends_at is NULL) the product sells at
+-- sale_price_cents (base currency) instead of its regular prices. Times are
+-- UTC; schedules of a product do not overlap, and cancelled ones are kept.
+CREATE TABLE price_schedules (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  sale_price_cents INT NOT NULL CHECK (sale_price_cents > 0),
+  starts_at TIMESTAMP NOT NULL,
+  ends_at TIMESTAMP CHECK (ends_at > starts_at),
+  admin_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  cancelled_at TIMESTAMP
+);
+
+CREATE INDEX idx_price_schedules_product ON price_schedules (product_id, starts_at)
+  WHERE cancelled_at IS NULL;
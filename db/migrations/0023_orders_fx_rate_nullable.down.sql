@@ -0,0 +1,5 @@
+-- Orders placed without a rate take the current one, or 1 when there is none.
+UPDATE orders o
+   SET fx_rate = COALESCE((SELECT r.rate FROM fx_rates r WHERE r.currency = o.currency), 1)
+ WHERE o.fx_rate IS NULL;
+ALTER TABLE orders ALTER COLUMN fx_rate SET NOT NULL;
@@ -0,0 +1,4 @@
+-- An order in a currency without an exchange rate can be placed when every
+-- price in it is explicit; it records no rate, and reports convert it at the
+-- currency's current one.
+ALTER TABLE orders ALTER COLUMN fx_rate DROP NOT NULL;
@@ -0,0 +1,3 @@
+-- The pending order a cart item was checked out in. The item leaves the cart
+-- once that order is paid; changing the item detaches it.
+ALTER TABLE cart_items ADD COLUMN order_id INT REFERENCES orders(id) ON DELETE SET NULL;
@@ -0,0 +1,11 @@
+-- A saved card becoming expiring or expired, recorded by the card expiry job
+-- so the user can be told to replace it.
+CREATE TABLE card_expiry_events (
+  id SERIAL PRIMARY KEY,
+  card_id INT NOT NULL REFERENCES credit_cards(id) ON DELETE CASCADE,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(16) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_card_expiry_events_user ON card_expiry_events (user_id, id);
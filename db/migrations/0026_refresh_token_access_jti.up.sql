@@ -0,0 +1,6 @@
+-- The access token issued with each refresh token, so revoking every session
+-- of a user can denylist the access tokens that are still live.
+ALTER TABLE refresh_tokens ADD COLUMN access_jti VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN access_expires_at TIMESTAMP;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens(user_id);
@@ -0,0 +1,5 @@
+DELETE FROM product_price_history WHERE variant_sku IS NOT NULL;
+DROP INDEX IF EXISTS idx_product_price_history_variant;
+ALTER TABLE product_price_history DROP COLUMN IF EXISTS price_override_cents;
+ALTER TABLE product_price_history DROP COLUMN IF EXISTS variant_sku;
+ALTER TABLE product_price_history DROP COLUMN IF EXISTS variant_id;
@@ -0,0 +1,16 @@
+-- Variant price overrides in the price history: a row for every change of a
+-- variant's override, keyed by variant. Rows outlive their variant, like
+-- order lines, keeping its SKU.
+ALTER TABLE product_price_history
+  ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE SET NULL,
+  ADD COLUMN variant_sku VARCHAR(64),
+  ADD COLUMN price_override_cents INT;
+
+CREATE INDEX idx_product_price_history_variant ON product_price_history (variant_id, id);
+
+-- Start the history of every variant with a price override.
+INSERT INTO product_price_history (product_id, variant_id, variant_sku, name, price_cents, price_override_cents)
+SELECT p.id, v.id, v.sku, p.name, p.price_cents, v.price_cents
+  FROM product_variants v
+  JOIN products p ON p.id = v.product_id
+ WHERE v.price_cents IS NOT NULL;
@@ -0,0 +1,11 @@
+// Package migrations embeds the versioned SQL migrations so the server binary
+// can apply them without access to the source tree.
+//
+// Files are named NNNN_description.up.sql / NNNN_description.down.sql and are
+// applied in version order.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -3,9 +3,9 @@ module github.com/Brossef/rescounts-task
 go 1.24.3
 
 require (
-	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
-	github.com/stripe/stripe-go/v82 v82.2.0 // indirect
-	golang.org/x/crypto v0.38.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/gorilla/mux v1.8.1
+	github.com/lib/pq v1.10.9
+	github.com/stripe/stripe-go/v82 v82.2.0
+	golang.org/x/crypto v0.38.0
 )
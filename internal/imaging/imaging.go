@@ -0,0 +1,149 @@
+// Package imaging decodes uploaded images and makes their thumbnails, using
+// only the standard library's JPEG, PNG and GIF codecs.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Content types of the formats Decode accepts.
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+)
+
+// MaxPixels bounds the decoded size of an image, so a small file cannot
+// expand into gigabytes of memory: 12 MP decode to at most 96 MB (16-bit RGBA),
+// plenty for a 4000x3000 product photo.
+const MaxPixels = 12_000_000
+
+var (
+	// ErrUnsupportedFormat is returned for anything but JPEG, PNG or GIF.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooLarge is returned for images of more than MaxPixels.
+	ErrTooLarge = errors.New("image dimensions too large")
+)
+
+// Decode decodes a JPEG, PNG or GIF (its first frame) and returns it with its
+// content type.
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	var img image.Image
+	var contentType string
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		contentType = TypeJPEG
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+		contentType = TypePNG
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+		contentType = TypeGIF
+	default:
+		return nil, "", ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return img, contentType, nil
+}
+
+// Thumbnail scales img down so that neither side exceeds maxSide, keeping its
+// aspect ratio; each output pixel averages the source pixels it covers.
+// Images already small enough are copied unscaled.
+func Thumbnail(img image.Image, maxSide int) *image.NRGBA {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	dstW, dstH := srcW, srcH
+	if srcW > maxSide || srcH > maxSide {
+		if srcW >= srcH {
+			dstW, dstH = maxSide, max(1, srcH*maxSide/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*maxSide/srcH), maxSide
+		}
+	}
+
+	// Work on a non-premultiplied copy so averaging reads plain channel values
+	src := image.NewNRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	if dstW == srcW && dstH == srcH {
+		return src
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			// Weight colours by alpha so transparent pixels do not darken edges
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					pa := uint64(p[3])
+					r += uint64(p[0]) * pa
+					g += uint64(p[1]) * pa
+					bl += uint64(p[2]) * pa
+					a += pa
+					n++
+				}
+			}
+			if a == 0 {
+				continue // fully transparent
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8((r + a/2) / a),
+				G: uint8((g + a/2) / a),
+				B: uint8((bl + a/2) / a),
+				A: uint8((a + n/2) / n),
+			})
+		}
+	}
+	return dst
+}
+
+// Encode encodes img as contentType: PNG for TypePNG and TypeGIF (keeping
+// transparency), JPEG otherwise. It returns the content type it used.
+func Encode(img image.Image, contentType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if contentType == TypePNG || contentType == TypeGIF {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), TypePNG, nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), TypeJPEG, nil
+}
+
+// Extension returns the file extension for a content type Decode or Encode returns.
+func Extension(contentType string) string {
+	switch contentType {
+	case TypePNG:
+		return ".png"
+	case TypeGIF:
+		return ".gif"
+	default:
+		return ".jpg"
+	}
+}
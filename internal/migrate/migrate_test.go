@@ -0,0 +1,212 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq" // registering the driver
+
+	"github.com/Brossef/rescounts-task/db/migrations"
+	"github.com/Brossef/rescounts-task/internal/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	got, err := migrate.Load(fstest.MapFS{
+		"0002_b.up.sql":   {Data: []byte("B")},
+		"0001_a.up.sql":   {Data: []byte("A")},
+		"0001_a.down.sql": {Data: []byte("-A")},
+		"README.md":       {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []migrate.Migration{{Version: 1, Name: "a", Up: "A", Down: "-A"}, {Version: 2, Name: "b", Up: "B"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Load = %+v, want %+v", got, want)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"two names": {"0001_a.up.sql": {Data: []byte("A")}, "0001_b.down.sql": {Data: []byte("-B")}},
+		"no up":     {"0001_a.down.sql": {Data: []byte("-A")}},
+	} {
+		if _, err := migrate.Load(fsys); err == nil {
+			t.Errorf("Load with %s: want an error", name)
+		}
+	}
+}
+
+// The tests below run against a real database only when TEST_DATABASE_URL is
+// set, like the postgres store tests, each in a schema of its own.
+
+// openDB returns a connection to a new, empty schema, skipping the test when no
+// database is configured, and the schema's name.
+func openDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	// Extensions such as pg_trgm may already live in public
+	path := schema + ",public"
+	switch {
+	case !strings.Contains(dsn, "://"):
+		dsn += " search_path=" + path
+	case strings.Contains(dsn, "?"):
+		dsn += "&search_path=" + path
+	default:
+		dsn += "?search_path=" + path
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, schema
+}
+
+// tables returns the tables of schema other than schema_migrations, sorted.
+func tables(t *testing.T, db *sql.DB, schema string) []string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.tables
+		 WHERE table_schema = $1 AND table_name <> 'schema_migrations'
+		 ORDER BY table_name;`, schema)
+	if err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("listing tables: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestUpAndDownAreIdempotent(t *testing.T) {
+	db, schema := openDB(t)
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	var versions []int
+	for _, mig := range all {
+		versions = append(versions, mig.Version)
+	}
+
+	up, err := m.Up()
+	if err != nil || !slices.Equal(up, versions) {
+		t.Fatalf("Up = %v, %v; want every migration, in order", up, err)
+	}
+	schemaTables := tables(t, db, schema)
+	if up, err := m.Up(); err != nil || len(up) != 0 {
+		t.Fatalf("second Up = %v, %v; want nothing to apply", up, err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil || len(statuses) != len(versions) {
+		t.Fatalf("Status = %v, %v; want %d migrations", statuses, err, len(versions))
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Fatalf("migration %d_%s is not applied", s.Version, s.Name)
+		}
+	}
+
+	// Rolling back one step at a time, the last first
+	down, err := m.Down(1)
+	if err != nil || !slices.Equal(down, versions[len(versions)-1:]) {
+		t.Fatalf("Down(1) = %v, %v; want the last migration", down, err)
+	}
+	if up, err := m.Up(); err != nil || !slices.Equal(up, versions[len(versions)-1:]) {
+		t.Fatalf("Up after Down(1) = %v, %v; want the last migration again", up, err)
+	}
+
+	down, err = m.Down(len(versions) + 1)
+	if err != nil || len(down) != len(versions) || !slices.IsSortedFunc(down, func(a, b int) int { return b - a }) {
+		t.Fatalf("Down(all) = %v, %v; want every migration, newest first", down, err)
+	}
+	if left := tables(t, db, schema); len(left) != 0 {
+		t.Fatalf("tables left after rolling everything back: %v", left)
+	}
+	if down, err := m.Down(1); err != nil || len(down) != 0 {
+		t.Fatalf("Down on an empty schema = %v, %v; want nothing to roll back", down, err)
+	}
+
+	// The down scripts leave nothing in the way of migrating again
+	if up, err := m.Up(); err != nil || !slices.Equal(up, versions) {
+		t.Fatalf("Up after Down(all) = %v, %v; want every migration", up, err)
+	}
+	if got := tables(t, db, schema); !slices.Equal(got, schemaTables) {
+		t.Fatalf("tables = %v, want %v as first migrated", got, schemaTables)
+	}
+}
+
+func TestBaselineSkipsRecordedMigrations(t *testing.T) {
+	db, schema := openDB(t)
+	m, err := migrate.New(db, fstest.MapFS{
+		"0001_widgets.up.sql":    {Data: []byte("CREATE TABLE widgets (id INT);")},
+		"0001_widgets.down.sql":  {Data: []byte("DROP TABLE widgets;")},
+		"0002_gadgets.up.sql":    {Data: []byte("CREATE TABLE gadgets (id INT);")},
+		"0002_gadgets.down.sql":  {Data: []byte("DROP TABLE gadgets;")},
+		"0003_sprockets.up.sql":  {Data: []byte("CREATE TABLE sprockets (id INT);")},
+		"0003_sprockets.up.sql~": {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if _, err := m.Baseline(4); err == nil {
+		t.Fatal("Baseline(4): want an error for an unknown version")
+	}
+	// The schema of 0001 exists already, created by hand
+	if _, err := db.Exec("CREATE TABLE widgets (id INT);"); err != nil {
+		t.Fatalf("creating widgets: %v", err)
+	}
+	if done, err := m.Baseline(1); err != nil || !slices.Equal(done, []int{1}) {
+		t.Fatalf("Baseline(1) = %v, %v; want [1]", done, err)
+	}
+	if done, err := m.Baseline(1); err != nil || len(done) != 0 {
+		t.Fatalf("second Baseline(1) = %v, %v; want nothing to record", done, err)
+	}
+	if up, err := m.Up(); err != nil || !slices.Equal(up, []int{2, 3}) {
+		t.Fatalf("Up = %v, %v; want [2 3]", up, err)
+	}
+	if got := tables(t, db, schema); !slices.Equal(got, []string{"gadgets", "sprockets", "widgets"}) {
+		t.Fatalf("tables = %v, want gadgets, sprockets and widgets", got)
+	}
+
+	// 0003 has no down script, so nothing is rolled back past it
+	if _, err := m.Down(1); err == nil {
+		t.Fatal("Down(1) without a down script: want an error")
+	}
+}
@@ -0,0 +1,77 @@
+// Package money converts amounts between the base currency and the other
+// currencies products can be sold in.
+//
+// Amounts are integers in the currency's minor unit ("cents"). Only currencies
+// with two decimal places are supported, so cents convert one-to-one at the
+// exchange rate. Rates are exact decimals (big.Rat), never floats.
+package money
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Base is the currency product prices are entered in and reports are totalled in.
+const Base = "cad"
+
+// notTwoDecimal lists ISO 4217 currencies whose minor unit is not 1/100.
+var notTwoDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "isk": true, "jpy": true,
+	"kmf": true, "krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true,
+	"vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+	"bhd": true, "iqd": true, "jod": true, "kwd": true, "lyd": true, "omr": true, "tnd": true,
+}
+
+// NormalizeCurrency lower-cases an ISO 4217 code and reports whether it is a
+// three-letter code of a supported (two-decimal) currency.
+func NormalizeCurrency(code string) (string, bool) {
+	c := strings.ToLower(strings.TrimSpace(code))
+	if len(c) != 3 || notTwoDecimal[c] {
+		return c, false
+	}
+	for _, r := range c {
+		if r < 'a' || r > 'z' {
+			return c, false
+		}
+	}
+	return c, true
+}
+
+// ParseRate parses a positive decimal exchange rate such as "0.7315".
+func ParseRate(s string) (*big.Rat, bool) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 || strings.ContainsAny(s, "/eE") {
+		return nil, false
+	}
+	return r, true
+}
+
+// FormatRate formats a rate with up to 8 decimals and no trailing zeros.
+func FormatRate(r *big.Rat) string {
+	s := r.FloatString(8)
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+// Convert converts base-currency cents to a currency whose rate is the amount of
+// that currency one unit of the base buys, rounding half up.
+func Convert(cents int64, rate *big.Rat) int64 {
+	return roundHalfUp(new(big.Rat).Mul(big.NewRat(cents, 1), rate))
+}
+
+// ToBase converts cents of a currency back to the base currency.
+func ToBase(cents int64, rate *big.Rat) int64 {
+	return roundHalfUp(new(big.Rat).Quo(big.NewRat(cents, 1), rate))
+}
+
+// Round rounds a non-negative amount of cents to whole cents, half up like Convert.
+func Round(cents *big.Rat) int64 {
+	return roundHalfUp(cents)
+}
+
+// roundHalfUp rounds a non-negative rational to the nearest integer.
+func roundHalfUp(r *big.Rat) int64 {
+	num := new(big.Int).Mul(r.Num(), big.NewInt(2))
+	num.Add(num, r.Denom())
+	den := new(big.Int).Mul(r.Denom(), big.NewInt(2))
+	return new(big.Int).Quo(num, den).Int64()
+}
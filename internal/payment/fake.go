@@ -0,0 +1,380 @@
+package payment
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fake is a deterministic in-memory Provider for tests and
+// local development (PAYMENT_PROVIDER=fake). Behaviour is driven by the payment
+// method ID, mirroring Stripe's test payment methods:
+//
+//	pm_card_visa, pm_card_mastercard, …      succeed
+//	pm_card_chargeDeclined, …                are declined
+//	pm_card_authenticationRequired, …        need 3-D Secure (requires_action)
+//	pm_fake_threeDSecureFail                 need 3-D Secure, which then fails
+//	pm_fake_networkError                     fail as if Stripe were unreachable
+//
+// Further IDs can be added to the Decline/ThreeDS/NetworkError sets. SetupIntents
+// follow the same rules when confirmed with a payment method.
+//
+// There is no browser to run a 3-D Secure challenge in, so a requires_action
+// intent is treated as authenticated the next time it is fetched: it moves to
+// succeeded, or to requires_payment_method for ThreeDSFailPaymentMethods.
+type Fake struct {
+	DeclinePaymentMethods      map[string]bool
+	ThreeDSPaymentMethods      map[string]bool
+	ThreeDSFailPaymentMethods  map[string]bool
+	NetworkErrorPaymentMethods map[string]bool
+
+	mu             sync.Mutex
+	nextID         int
+	customers      map[string]string // customer ID -> email
+	paymentMethods map[string]string // payment method ID -> customer ID
+	defaultMethods map[string]string // customer ID -> default payment method ID
+	intents        map[string]*fakeIntent
+	setupIntents   map[string]*SetupIntentInfo
+	idempotent     map[string]idempotentCall
+}
+
+// idempotentCall is the first CreatePaymentIntent made with an idempotency key.
+type idempotentCall struct {
+	Params   IntentParams
+	IntentID string
+}
+
+type fakeIntent struct {
+	IntentInfo
+	PaymentMethodID string
+	RefundedCents   int64
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		DeclinePaymentMethods: map[string]bool{
+			"pm_card_chargeDeclined":                  true,
+			"pm_card_chargeDeclinedInsufficientFunds": true,
+			"pm_card_chargeDeclinedExpiredCard":       true,
+		},
+		ThreeDSPaymentMethods: map[string]bool{
+			"pm_card_authenticationRequired": true,
+			"pm_card_threeDSecure2Required":  true,
+			"pm_fake_threeDSecureFail":       true,
+		},
+		ThreeDSFailPaymentMethods: map[string]bool{
+			"pm_fake_threeDSecureFail": true,
+		},
+		NetworkErrorPaymentMethods: map[string]bool{
+			"pm_fake_networkError": true,
+		},
+		customers:      map[string]string{},
+		paymentMethods: map[string]string{},
+		defaultMethods: map[string]string{},
+		intents:        map[string]*fakeIntent{},
+		setupIntents:   map[string]*SetupIntentInfo{},
+		idempotent:     map[string]idempotentCall{},
+	}
+}
+
+// newID returns sequential IDs (cus_fake_1, pi_fake_2, …) so runs are reproducible.
+func (f *Fake) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s_fake_%d", prefix, f.nextID)
+}
+
+func (f *Fake) CreateCustomer(email string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.newID("cus")
+	f.customers[id] = email
+	return id, nil
+}
+
+func (f *Fake) AttachPaymentMethod(paymentMethodID, customerID string) (*MethodInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.attach(paymentMethodID, customerID); err != nil {
+		return nil, err
+	}
+	return fakeMethodInfo(paymentMethodID), nil
+}
+
+// attach attaches a payment method to a customer; f.mu must be held.
+func (f *Fake) attach(paymentMethodID, customerID string) error {
+	if f.NetworkErrorPaymentMethods[paymentMethodID] {
+		return fmt.Errorf("%w: simulated network error", ErrUnavailable)
+	}
+	if !strings.HasPrefix(paymentMethodID, "pm_") {
+		return &Error{Code: "resource_missing", Message: "No such PaymentMethod: '" + paymentMethodID + "'"}
+	}
+	if _, ok := f.customers[customerID]; !ok {
+		return &Error{Code: "resource_missing", Message: "No such customer: '" + customerID + "'"}
+	}
+	if owner, ok := f.paymentMethods[paymentMethodID]; ok && owner != customerID {
+		return &Error{Code: "payment_method_unexpected_state", Message: "The payment method is already attached to another customer."}
+	}
+	f.paymentMethods[paymentMethodID] = customerID
+	return nil
+}
+
+// fakeMethodInfo derives card details from the payment method ID. Each ID is its
+// own card, so its fingerprint is derived from the ID too.
+func fakeMethodInfo(paymentMethodID string) *MethodInfo {
+	info := &MethodInfo{
+		ID:          paymentMethodID,
+		Brand:       "visa",
+		Last4:       "4242",
+		ExpMonth:    12,
+		ExpYear:     2034,
+		Fingerprint: "fp_" + strings.TrimPrefix(paymentMethodID, "pm_"),
+	}
+	switch {
+	case strings.Contains(paymentMethodID, "mastercard"):
+		info.Brand, info.Last4 = "mastercard", "4444"
+	case strings.Contains(paymentMethodID, "amex"):
+		info.Brand, info.Last4 = "amex", "8431"
+	}
+	return info
+}
+
+func (f *Fake) GetPaymentMethod(paymentMethodID string) (*MethodInfo, error) {
+	if f.NetworkErrorPaymentMethods[paymentMethodID] {
+		return nil, fmt.Errorf("%w: simulated network error", ErrUnavailable)
+	}
+	if !strings.HasPrefix(paymentMethodID, "pm_") {
+		return nil, &Error{Code: "resource_missing", Message: "No such PaymentMethod: '" + paymentMethodID + "'"}
+	}
+	return fakeMethodInfo(paymentMethodID), nil
+}
+
+func (f *Fake) DetachPaymentMethod(paymentMethodID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.NetworkErrorPaymentMethods[paymentMethodID] {
+		return fmt.Errorf("%w: simulated network error", ErrUnavailable)
+	}
+	if _, ok := f.paymentMethods[paymentMethodID]; !ok {
+		return &Error{Code: "payment_method_unexpected_state", Message: "The payment method is not attached to a customer."}
+	}
+	if customerID := f.paymentMethods[paymentMethodID]; f.defaultMethods[customerID] == paymentMethodID {
+		delete(f.defaultMethods, customerID)
+	}
+	delete(f.paymentMethods, paymentMethodID)
+	return nil
+}
+
+func (f *Fake) SetDefaultPaymentMethod(customerID, paymentMethodID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.NetworkErrorPaymentMethods[paymentMethodID] {
+		return fmt.Errorf("%w: simulated network error", ErrUnavailable)
+	}
+	if _, ok := f.customers[customerID]; !ok {
+		return &Error{Code: "resource_missing", Message: "No such customer: '" + customerID + "'"}
+	}
+	if f.paymentMethods[paymentMethodID] != customerID {
+		return &Error{Code: "resource_missing", Message: "The payment method is not attached to this customer."}
+	}
+	f.defaultMethods[customerID] = paymentMethodID
+	return nil
+}
+
+func (f *Fake) CreatePaymentIntent(params IntentParams) (*IntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if call, ok := f.idempotent[params.IdempotencyKey]; ok {
+		if call.Params != params {
+			return nil, &Error{
+				Code:    "idempotency_error",
+				Message: "Keys for idempotent requests can only be used with the same parameters they were first used with.",
+			}
+		}
+		info := f.intents[call.IntentID].IntentInfo
+		return &info, nil
+	}
+
+	pmID := params.PaymentMethodID
+	if f.NetworkErrorPaymentMethods[pmID] {
+		return nil, fmt.Errorf("%w: simulated network error", ErrUnavailable)
+	}
+	if owner, ok := f.paymentMethods[pmID]; !ok || owner != params.CustomerID {
+		return nil, &Error{Code: "resource_missing", Message: "The payment method does not belong to this customer."}
+	}
+	if f.DeclinePaymentMethods[pmID] {
+		return nil, &Error{Code: "card_declined", Message: "Your card was declined."}
+	}
+
+	id := f.newID("pi")
+	intent := &fakeIntent{
+		IntentInfo: IntentInfo{
+			ID:           id,
+			Status:       "requires_confirmation",
+			ClientSecret: id + "_secret",
+			AmountCents:  params.AmountCents,
+		},
+		PaymentMethodID: pmID,
+	}
+	if params.Confirm {
+		f.confirm(intent)
+	}
+	f.intents[id] = intent
+	if params.IdempotencyKey != "" {
+		f.idempotent[params.IdempotencyKey] = idempotentCall{Params: params, IntentID: id}
+	}
+
+	info := intent.IntentInfo
+	return &info, nil
+}
+
+// confirm moves an intent out of requires_confirmation.
+func (f *Fake) confirm(intent *fakeIntent) {
+	intent.Status = "succeeded"
+	if f.ThreeDSPaymentMethods[intent.PaymentMethodID] {
+		intent.Status = "requires_action"
+	}
+}
+
+func (f *Fake) GetPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[paymentIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such payment_intent: '" + paymentIntentID + "'"}
+	}
+	if intent.Status == "requires_action" {
+		intent.Status = "succeeded"
+		if f.ThreeDSFailPaymentMethods[intent.PaymentMethodID] {
+			intent.Status = "requires_payment_method"
+		}
+	}
+	info := intent.IntentInfo
+	return &info, nil
+}
+
+func (f *Fake) ConfirmPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[paymentIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such payment_intent: '" + paymentIntentID + "'"}
+	}
+	if intent.Status != "requires_confirmation" {
+		return nil, &Error{Code: "payment_intent_unexpected_state", Message: "This PaymentIntent's status is " + intent.Status + "."}
+	}
+	f.confirm(intent)
+	info := intent.IntentInfo
+	return &info, nil
+}
+
+func (f *Fake) CancelPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[paymentIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such payment_intent: '" + paymentIntentID + "'"}
+	}
+	switch intent.Status {
+	case IntentStatusSucceeded, IntentStatusProcessing, IntentStatusCanceled:
+		return nil, &Error{Code: "payment_intent_unexpected_state", Message: "This PaymentIntent's status is " + intent.Status + "."}
+	}
+	intent.Status = IntentStatusCanceled
+	info := intent.IntentInfo
+	return &info, nil
+}
+
+func (f *Fake) CreateSetupIntent(customerID string) (*SetupIntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.customers[customerID]; !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such customer: '" + customerID + "'"}
+	}
+	id := f.newID("seti")
+	si := &SetupIntentInfo{
+		ID:           id,
+		Status:       "requires_payment_method",
+		ClientSecret: id + "_secret",
+		CustomerID:   customerID,
+	}
+	f.setupIntents[id] = si
+
+	info := *si
+	return &info, nil
+}
+
+func (f *Fake) GetSetupIntent(setupIntentID string) (*SetupIntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	si, ok := f.setupIntents[setupIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such setupintent: '" + setupIntentID + "'"}
+	}
+	// As with payments, a pending 3-D Secure challenge counts as completed.
+	if si.Status == "requires_action" {
+		si.Status = "succeeded"
+		if f.ThreeDSFailPaymentMethods[si.PaymentMethodID] {
+			si.Status = "requires_payment_method"
+		}
+	}
+	info := *si
+	return &info, nil
+}
+
+func (f *Fake) ConfirmSetupIntent(setupIntentID, paymentMethodID string) (*SetupIntentInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	si, ok := f.setupIntents[setupIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such setupintent: '" + setupIntentID + "'"}
+	}
+	if si.Status != "requires_payment_method" && si.Status != "requires_confirmation" {
+		return nil, &Error{Code: "setup_intent_unexpected_state", Message: "This SetupIntent's status is " + si.Status + "."}
+	}
+	if f.DeclinePaymentMethods[paymentMethodID] {
+		return nil, &Error{Code: "card_declined", Message: "Your card was declined."}
+	}
+	if err := f.attach(paymentMethodID, si.CustomerID); err != nil {
+		return nil, err
+	}
+	si.PaymentMethodID = paymentMethodID
+	si.Status = "succeeded"
+	if f.ThreeDSPaymentMethods[paymentMethodID] {
+		si.Status = "requires_action"
+	}
+	info := *si
+	return &info, nil
+}
+
+func (f *Fake) CreateRefund(paymentIntentID string, amountCents int64) (*RefundInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[paymentIntentID]
+	if !ok {
+		return nil, &Error{Code: "resource_missing", Message: "No such payment_intent: '" + paymentIntentID + "'"}
+	}
+	if intent.Status != "succeeded" {
+		return nil, &Error{Code: "charge_not_refundable", Message: "This PaymentIntent has not succeeded."}
+	}
+	remaining := intent.AmountCents - intent.RefundedCents
+	if amountCents == 0 {
+		amountCents = remaining
+	}
+	if amountCents <= 0 || amountCents > remaining {
+		return nil, &Error{Code: "amount_too_large", Message: "Refund amount exceeds the remaining charge."}
+	}
+	intent.RefundedCents += amountCents
+
+	return &RefundInfo{ID: f.newID("re"), Status: "succeeded", AmountCents: amountCents}, nil
+}
@@ -0,0 +1,133 @@
+// Package payment abstracts the payment processor behind Provider, with a
+// Stripe implementation and an in-memory fake.
+package payment
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PaymentIntent statuses the handlers branch on (see https://docs.stripe.com/payments/paymentintents/lifecycle).
+const (
+	IntentStatusSucceeded             = "succeeded"
+	IntentStatusProcessing            = "processing"
+	IntentStatusRequiresAction        = "requires_action"
+	IntentStatusRequiresConfirmation  = "requires_confirmation"
+	IntentStatusRequiresPaymentMethod = "requires_payment_method"
+	IntentStatusCanceled              = "canceled"
+)
+
+// Provider is everything the handlers need from a payment processor.
+// The Stripe implementation talks to the real API; the fake one keeps state in
+// memory so the server can run offline.
+type Provider interface {
+	// CreateCustomer registers a customer and returns its provider ID.
+	CreateCustomer(email string) (string, error)
+	// AttachPaymentMethod attaches an existing payment method to a customer.
+	AttachPaymentMethod(paymentMethodID, customerID string) (*MethodInfo, error)
+	// DetachPaymentMethod removes a payment method from its customer.
+	DetachPaymentMethod(paymentMethodID string) error
+	// SetDefaultPaymentMethod makes an attached payment method the customer's default.
+	SetDefaultPaymentMethod(customerID, paymentMethodID string) error
+	// GetPaymentMethod fetches a payment method's card details.
+	GetPaymentMethod(paymentMethodID string) (*MethodInfo, error)
+	// CreateSetupIntent starts saving a card for off-session use by a customer.
+	CreateSetupIntent(customerID string) (*SetupIntentInfo, error)
+	// GetSetupIntent fetches the current state of a SetupIntent.
+	GetSetupIntent(setupIntentID string) (*SetupIntentInfo, error)
+	// ConfirmSetupIntent confirms a SetupIntent with a payment method.
+	ConfirmSetupIntent(setupIntentID, paymentMethodID string) (*SetupIntentInfo, error)
+	// CreatePaymentIntent creates (and optionally confirms) a payment.
+	CreatePaymentIntent(params IntentParams) (*IntentInfo, error)
+	// GetPaymentIntent fetches the current state of a payment.
+	GetPaymentIntent(paymentIntentID string) (*IntentInfo, error)
+	// ConfirmPaymentIntent confirms a payment that is waiting for confirmation.
+	ConfirmPaymentIntent(paymentIntentID string) (*IntentInfo, error)
+	// CancelPaymentIntent cancels a payment that has not succeeded; it fails
+	// for one that succeeded or is being processed.
+	CancelPaymentIntent(paymentIntentID string) (*IntentInfo, error)
+	// CreateRefund refunds amountCents of a payment; 0 refunds whatever is left.
+	CreateRefund(paymentIntentID string, amountCents int64) (*RefundInfo, error)
+}
+
+// MethodInfo is the card metadata we store in credit_cards.
+type MethodInfo struct {
+	ID       string
+	Brand    string
+	Last4    string
+	ExpMonth int
+	ExpYear  int
+	// Fingerprint identifies the card number: it is the same for every
+	// payment method created from the same card.
+	Fingerprint string
+}
+
+// IntentParams describes a charge against a customer's payment method.
+type IntentParams struct {
+	AmountCents     int64
+	Currency        string
+	CustomerID      string
+	PaymentMethodID string
+	Confirm         bool
+	// IdempotencyKey, when set, makes the provider return the original intent
+	// for repeated calls instead of charging again.
+	IdempotencyKey string
+	// OrderID, when set, is recorded in the intent's metadata (order_id) so its
+	// webhooks can be matched to the order even if this call's response is lost.
+	OrderID int
+}
+
+// IntentInfo is the subset of a PaymentIntent the handlers act on.
+type IntentInfo struct {
+	ID           string
+	Status       string
+	ClientSecret string
+	AmountCents  int64
+}
+
+// SetupIntentInfo is the subset of a SetupIntent the handlers act on.
+// PaymentMethodID is set once a payment method was supplied.
+type SetupIntentInfo struct {
+	ID              string
+	Status          string
+	ClientSecret    string
+	CustomerID      string
+	PaymentMethodID string
+}
+
+// RefundInfo describes a refund created by the provider.
+type RefundInfo struct {
+	ID          string
+	Status      string
+	AmountCents int64
+}
+
+// ErrUnavailable wraps failures to reach the provider at all
+// (network errors, timeouts), as opposed to the provider rejecting a request.
+var ErrUnavailable = errors.New("payment provider unavailable")
+
+// Error is returned when the provider rejects a request, e.g. a declined card.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New builds the provider called name ("stripe", the default, or "fake").
+// stripeKey is only required for Stripe.
+func New(name, stripeKey string) (Provider, error) {
+	switch name {
+	case "", "stripe":
+		if stripeKey == "" {
+			return nil, errors.New("STRIPE_SECRET_KEY is not set")
+		}
+		return NewStripe(stripeKey), nil
+	case "fake":
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", name)
+	}
+}
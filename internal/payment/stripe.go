@@ -0,0 +1,206 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/customer"
+	"github.com/stripe/stripe-go/v82/paymentintent"
+	"github.com/stripe/stripe-go/v82/paymentmethod"
+	"github.com/stripe/stripe-go/v82/refund"
+	"github.com/stripe/stripe-go/v82/setupintent"
+)
+
+// Stripe implements Provider against the Stripe API.
+type Stripe struct{}
+
+func NewStripe(secretKey string) *Stripe {
+	stripe.Key = secretKey
+	return &Stripe{}
+}
+
+func (p *Stripe) CreateCustomer(email string) (string, error) {
+	cust, err := customer.New(&stripe.CustomerParams{
+		Email: stripe.String(email),
+	})
+	if err != nil {
+		return "", stripeErr(err)
+	}
+	return cust.ID, nil
+}
+
+func (p *Stripe) AttachPaymentMethod(paymentMethodID, customerID string) (*MethodInfo, error) {
+	pm, err := paymentmethod.Attach(paymentMethodID, &stripe.PaymentMethodAttachParams{
+		Customer: stripe.String(customerID),
+	})
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return methodInfo(pm), nil
+}
+
+func (p *Stripe) GetPaymentMethod(paymentMethodID string) (*MethodInfo, error) {
+	pm, err := paymentmethod.Get(paymentMethodID, nil)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return methodInfo(pm), nil
+}
+
+func methodInfo(pm *stripe.PaymentMethod) *MethodInfo {
+	info := &MethodInfo{ID: pm.ID}
+	if card := pm.Card; card != nil {
+		info.Brand = string(card.Brand)
+		info.Last4 = card.Last4
+		info.ExpMonth = int(card.ExpMonth)
+		info.ExpYear = int(card.ExpYear)
+		info.Fingerprint = card.Fingerprint
+	}
+	return info
+}
+
+func (p *Stripe) DetachPaymentMethod(paymentMethodID string) error {
+	_, err := paymentmethod.Detach(paymentMethodID, nil)
+	return stripeErr(err)
+}
+
+func (p *Stripe) SetDefaultPaymentMethod(customerID, paymentMethodID string) error {
+	_, err := customer.Update(customerID, &stripe.CustomerParams{
+		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+			DefaultPaymentMethod: stripe.String(paymentMethodID),
+		},
+	})
+	return stripeErr(err)
+}
+
+func (p *Stripe) CreatePaymentIntent(params IntentParams) (*IntentInfo, error) {
+	piParams := &stripe.PaymentIntentParams{
+		Amount:             stripe.Int64(params.AmountCents),
+		Currency:           stripe.String(params.Currency),
+		Customer:           stripe.String(params.CustomerID),
+		PaymentMethod:      stripe.String(params.PaymentMethodID),
+		Confirm:            stripe.Bool(params.Confirm),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}), // ← restrict to card
+	}
+	if params.IdempotencyKey != "" {
+		piParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	if params.OrderID != 0 {
+		piParams.AddMetadata("order_id", strconv.Itoa(params.OrderID))
+	}
+	pi, err := paymentintent.New(piParams)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return paymentIntentInfo(pi), nil
+}
+
+func (p *Stripe) GetPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	pi, err := paymentintent.Get(paymentIntentID, nil)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return paymentIntentInfo(pi), nil
+}
+
+func (p *Stripe) ConfirmPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	pi, err := paymentintent.Confirm(paymentIntentID, nil)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return paymentIntentInfo(pi), nil
+}
+
+func (p *Stripe) CancelPaymentIntent(paymentIntentID string) (*IntentInfo, error) {
+	pi, err := paymentintent.Cancel(paymentIntentID, nil)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return paymentIntentInfo(pi), nil
+}
+
+func (p *Stripe) CreateSetupIntent(customerID string) (*SetupIntentInfo, error) {
+	si, err := setupintent.New(&stripe.SetupIntentParams{
+		Customer:           stripe.String(customerID),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Usage:              stripe.String(string(stripe.SetupIntentUsageOffSession)),
+	})
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return setupIntentInfo(si), nil
+}
+
+func (p *Stripe) GetSetupIntent(setupIntentID string) (*SetupIntentInfo, error) {
+	si, err := setupintent.Get(setupIntentID, nil)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return setupIntentInfo(si), nil
+}
+
+func (p *Stripe) ConfirmSetupIntent(setupIntentID, paymentMethodID string) (*SetupIntentInfo, error) {
+	si, err := setupintent.Confirm(setupIntentID, &stripe.SetupIntentConfirmParams{
+		PaymentMethod: stripe.String(paymentMethodID),
+	})
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return setupIntentInfo(si), nil
+}
+
+func setupIntentInfo(si *stripe.SetupIntent) *SetupIntentInfo {
+	info := &SetupIntentInfo{
+		ID:           si.ID,
+		Status:       string(si.Status),
+		ClientSecret: si.ClientSecret,
+	}
+	if si.Customer != nil {
+		info.CustomerID = si.Customer.ID
+	}
+	if si.PaymentMethod != nil {
+		info.PaymentMethodID = si.PaymentMethod.ID
+	}
+	return info
+}
+
+func (p *Stripe) CreateRefund(paymentIntentID string, amountCents int64) (*RefundInfo, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+	}
+	if amountCents > 0 {
+		params.Amount = stripe.Int64(amountCents)
+	}
+	re, err := refund.New(params)
+	if err != nil {
+		return nil, stripeErr(err)
+	}
+	return &RefundInfo{ID: re.ID, Status: string(re.Status), AmountCents: re.Amount}, nil
+}
+
+func paymentIntentInfo(pi *stripe.PaymentIntent) *IntentInfo {
+	return &IntentInfo{
+		ID:           pi.ID,
+		Status:       string(pi.Status),
+		ClientSecret: pi.ClientSecret,
+		AmountCents:  pi.Amount,
+	}
+}
+
+// stripeErr maps Stripe API errors to *Error and everything else
+// (connection failures, timeouts) to ErrUnavailable.
+func stripeErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *stripe.Error
+	if errors.As(err, &se) {
+		if se.Type == stripe.ErrorTypeAPI {
+			return fmt.Errorf("%w: %s", ErrUnavailable, se.Msg)
+		}
+		return &Error{Code: string(se.Code), Message: se.Msg}
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
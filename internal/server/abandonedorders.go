@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+)
+
+// abandonedOrderAge is how long a pending order holds its stock. Stripe sends
+// an intent's webhooks within minutes, and a 3-D Secure challenge that is still
+// open after this long has been abandoned.
+const abandonedOrderAge = time.Hour
+
+// RunAbandonedOrderJob runs failAbandonedOrders once at start and then every
+// interval until ctx is done.
+func (s *Server) RunAbandonedOrderJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.failAbandonedOrders(abandonedOrderAge)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// failAbandonedOrders fails the orders still pending after olderThan so their
+// stock can be sold again: those that never got a PaymentIntent because the
+// provider was unreachable, and those whose intent is stuck (e.g. in
+// requires_action), once the intent is canceled. If an intent was created
+// after all, its webhook still finds the order by the intent's order_id: the
+// order takes its stock back, or is left in needs_review when it is gone.
+func (s *Server) failAbandonedOrders(olderThan time.Duration) {
+	ids, err := s.stores.Orders.FailAbandoned(olderThan, s.cancelAbandonedIntent)
+	if err != nil {
+		log.Printf("ERROR failing abandoned orders: %v\n", err)
+	}
+	for _, id := range ids {
+		log.Printf("NOTICE: order %d failed: no payment was recorded within %v\n", id, olderThan)
+	}
+}
+
+// cancelAbandonedIntent cancels the PaymentIntent of an abandoned order and
+// reports whether it is canceled. An intent that succeeded or is processing
+// cannot be canceled; its webhook settles the order.
+func (s *Server) cancelAbandonedIntent(paymentIntentID string) bool {
+	_, err := s.payments.CancelPaymentIntent(paymentIntentID)
+	if err == nil {
+		return true
+	}
+	// Canceled by an earlier run whose transaction did not commit
+	if pi, gerr := s.payments.GetPaymentIntent(paymentIntentID); gerr == nil && pi.Status == payment.IntentStatusCanceled {
+		return true
+	}
+	log.Printf("NOTICE: keeping the order of payment intent %s pending: %v\n", paymentIntentID, err)
+	return false
+}
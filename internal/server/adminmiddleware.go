@@ -1,10 +1,10 @@
-package main
+package server
 
 import (
 	"net/http"
 )
 
-func adminMiddleware(next http.Handler) http.Handler {
+func (s *Server) adminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract user_id from context
 		uidVal := r.Context().Value("user_id")
@@ -19,12 +19,7 @@ func adminMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Check if user_id exists in `admins` table
-		var exists bool
-		err := db.QueryRow(
-			`SELECT EXISTS(SELECT 1 FROM admins WHERE user_id = $1);`,
-			userID,
-		).Scan(&exists)
-
+		exists, err := s.stores.Admins.IsAdmin(userID)
 		if err != nil {
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
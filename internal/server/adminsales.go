@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// salesTotalsResponse sums sales per currency and overall in the base currency.
+type salesTotalsResponse struct {
+	BaseCurrency string                     `json:"base_currency"`
+	Currencies   []store.CurrencySalesTotal `json:"currencies"`
+	BaseNetCents int64                      `json:"base_net_cents"`
+}
+
+// getSalesHandler allows admins to filter by date range (from/to), username,
+// redeemed coupon code and/or currency.
+func (s *Server) getSalesHandler(w http.ResponseWriter, r *http.Request) {
+	// 1) Parse query params
+	filter, msg := salesFilter(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// 2) Order lines joined with orders, users and products
+	sales, err := s.stores.Orders.ListSales(filter)
+	if err != nil {
+		http.Error(w, "Failed to query sales: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 3) Return as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sales)
+}
+
+// getSalesTotalsHandler sums the paid orders matching the /admin/sales filters per
+// currency, and their net total in the base currency.
+func (s *Server) getSalesTotalsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, msg := salesFilter(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	totals, err := s.stores.Orders.SalesTotals(filter)
+	if err != nil {
+		http.Error(w, "Failed to query sales totals", http.StatusInternalServerError)
+		return
+	}
+
+	resp := salesTotalsResponse{BaseCurrency: money.Base, Currencies: totals}
+	for _, t := range totals {
+		resp.BaseNetCents += t.BaseNetCents
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// salesFilter parses the query of the sales reports; the returned message is
+// empty when it is valid.
+func salesFilter(r *http.Request) (store.SalesFilter, string) {
+	q := r.URL.Query()
+	fromStr := q.Get("from") // e.g. "2025-01-01"
+	toStr := q.Get("to")     // e.g. "2025-06-01"
+
+	filter := store.SalesFilter{
+		Username:   q.Get("username"), // exact match
+		CouponCode: q.Get("coupon"),   // case-insensitive
+	}
+	if fromStr != "" {
+		from, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return filter, "Invalid 'from' date: use YYYY-MM-DD"
+		}
+		filter.From = from
+	}
+	if toStr != "" {
+		to, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return filter, "Invalid 'to' date: use YYYY-MM-DD"
+		}
+		filter.To = to.AddDate(0, 0, 1) // include entire “to” day
+	}
+	if c := q.Get("currency"); c != "" {
+		currency, ok := money.NormalizeCurrency(c)
+		if !ok {
+			return filter, "Unsupported currency: " + c
+		}
+		filter.Currency = currency
+	}
+	return filter, ""
+}
@@ -1,17 +1,15 @@
-package main
+package server
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Brossef/rescounts-task/internal/store"
 )
 
 type signupRequest struct {
@@ -33,9 +31,11 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
-// loginResponse returns a JWT token.
+// loginResponse returns a short-lived JWT access token and a refresh token.
 type loginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
 }
 
 // jwtClaims defines the JWT payload.
@@ -45,23 +45,33 @@ type jwtClaims struct {
 	jwt.RegisteredClaims
 }
 
-// createJWT creates a signed token.
-func createJWT(userID int, username string) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
+// newAccessToken picks the unique jti and expiry of an access token, so it can
+// be recorded with its refresh token before it is signed.
+func newAccessToken() (store.AccessToken, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return store.AccessToken{}, err
+	}
+	return store.AccessToken{JTI: jti, ExpiresAt: time.Now().Add(accessTokenTTL)}, nil
+}
+
+// createJWT creates a signed access token with the jti of access so it can be revoked.
+func (s *Server) createJWT(userID int, username string, access store.AccessToken) (string, error) {
 	claims := jwtClaims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        access.JTI,
+			ExpiresAt: jwt.NewNumericDate(access.ExpiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
+	return token.SignedString(s.cfg.JWTSecret)
 }
 
-func signupHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) signupHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode JSON
 	var req signupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -84,16 +94,10 @@ func signupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert into users table
-	var newUserID int
-	query := `
-		INSERT INTO users (username, email, password)
-		VALUES ($1, $2, $3)
-		RETURNING id;
-	`
-	err = db.QueryRow(query, req.Username, req.Email, string(hashedPw)).Scan(&newUserID)
+	newUserID, err := s.stores.Users.Create(req.Username, req.Email, string(hashedPw))
 	if err != nil {
-		// If duplicate email/username, Postgres will error
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		// Duplicate email/username
+		if err == store.ErrConflict {
 			http.Error(w, "Email or username already taken", http.StatusConflict)
 			return
 		}
@@ -111,7 +115,7 @@ func signupHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode JSON
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -126,20 +130,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch user row by email
-	var (
-		storedHash string
-		userID     int
-		username   string
-	)
-	query := `
-		SELECT id, username, password
-		FROM users
-		WHERE email = $1;
-	`
-	row := db.QueryRow(query, req.Email)
-	if err := row.Scan(&userID, &username, &storedHash); err != nil {
-		if err == sql.ErrNoRows {
+	// Fetch user by email
+	user, err := s.stores.Users.GetByEmail(req.Email)
+	if err != nil {
+		if err == store.ErrNotFound {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -148,26 +142,24 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		// wrong password
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Create JWT
-	tokenString, err := createJWT(userID, username)
+	// Create access + refresh tokens
+	resp, err := s.issueTokens(user.ID, user.Username)
 	if err != nil {
 		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
 
-	// Return JSON with token
+	// Return JSON with tokens
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(loginResponse{
-		Token: tokenString,
-	})
+	json.NewEncoder(w).Encode(resp)
 }
-func jwtMiddleware(next http.Handler) http.Handler {
+func (s *Server) jwtMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -175,10 +167,9 @@ func jwtMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		secret := []byte(os.Getenv("JWT_SECRET"))
 
 		token, err := jwt.ParseWithClaims(tokenString, &jwtClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
+			return s.cfg.JWTSecret, nil
 		})
 		if err != nil || !token.Valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
@@ -186,8 +177,25 @@ func jwtMiddleware(next http.Handler) http.Handler {
 		}
 
 		claims := token.Claims.(*jwtClaims)
-		// store userID in context for handlers to read
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// Tokens without a jti predate revocation support and cannot be revoked
+		if claims.ID == "" {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		// The denylist is checked on every request rather than cached: it is a
+		// primary key lookup, and a cache would let a revoked token through
+		// until it expired.
+		revoked, err := s.stores.Tokens.IsAccessTokenRevoked(claims.ID)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		// store userID (and the claims) in context for handlers to read
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 	})
 }
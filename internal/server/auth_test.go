@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSignupRejectsDuplicateEmail(t *testing.T) {
+	ts := newTestServer(t)
+	ts.login("alice")
+
+	rec := ts.do("POST", "/signup", "", signupRequest{Username: "alice2", Email: "alice@example.com", Password: "x"})
+	decode(t, rec, http.StatusConflict, nil)
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	ts := newTestServer(t)
+	ts.login("alice")
+
+	rec := ts.do("POST", "/login", "", loginRequest{Email: "alice@example.com", Password: "wrong"})
+	decode(t, rec, http.StatusUnauthorized, nil)
+}
+
+func TestProtectedRoutesNeedToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	decode(t, ts.do("GET", "/products", "", nil), http.StatusUnauthorized, nil)
+	decode(t, ts.do("GET", "/products", "not-a-jwt", nil), http.StatusUnauthorized, nil)
+}
+
+func TestAdminRoutesNeedAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	_, tokens := ts.login("alice")
+
+	rec := ts.do("POST", "/admin/products", tokens.Token, map[string]any{"name": "Mug", "price_cents": 1000})
+	decode(t, rec, http.StatusForbidden, nil)
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	ts := newTestServer(t)
+	_, tokens := ts.login("alice")
+
+	var rotated loginResponse
+	decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}), http.StatusOK, &rotated)
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Replaying the old token revokes the family, including the rotated token
+	decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}), http.StatusUnauthorized, nil)
+	decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: rotated.RefreshToken}), http.StatusUnauthorized, nil)
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	ts := newTestServer(t)
+	_, tokens := ts.login("alice")
+
+	decode(t, ts.do("POST", "/auth/logout", tokens.Token, refreshRequest{RefreshToken: tokens.RefreshToken}), http.StatusNoContent, nil)
+
+	decode(t, ts.do("GET", "/products", tokens.Token, nil), http.StatusUnauthorized, nil)
+	decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}), http.StatusUnauthorized, nil)
+}
+
+func TestAdminRevokesUserSessions(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	userID, first := ts.login("alice")
+	relogin := loginRequest{Email: "alice@example.com", Password: "secret-password"}
+	var second loginResponse
+	decode(t, ts.do("POST", "/login", "", relogin), http.StatusOK, &second)
+	var refreshed loginResponse
+	decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: second.RefreshToken}), http.StatusOK, &refreshed)
+	_, other := ts.login("bob")
+
+	path := fmt.Sprintf("/admin/users/%d/revoke-sessions", userID)
+	decode(t, ts.do("POST", path, other.Token, nil), http.StatusForbidden, nil)
+	decode(t, ts.do("POST", path, admin, nil), http.StatusNoContent, nil)
+
+	// Every access token still live is refused, and no session can be refreshed
+	for _, tokens := range []loginResponse{first, second, refreshed} {
+		decode(t, ts.do("GET", "/products", tokens.Token, nil), http.StatusUnauthorized, nil)
+		decode(t, ts.do("POST", "/auth/refresh", "", refreshRequest{RefreshToken: tokens.RefreshToken}), http.StatusUnauthorized, nil)
+	}
+	decode(t, ts.do("GET", "/products", other.Token, nil), http.StatusOK, nil)
+
+	// Logging in again starts a new session
+	var again loginResponse
+	decode(t, ts.do("POST", "/login", "", relogin), http.StatusOK, &again)
+	decode(t, ts.do("GET", "/products", again.Token, nil), http.StatusOK, nil)
+
+	decode(t, ts.do("POST", "/admin/users/999/revoke-sessions", admin, nil), http.StatusNotFound, nil)
+}
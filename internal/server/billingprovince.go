@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// billingProvinceBody is the payload and response of /users/billing-province.
+type billingProvinceBody struct {
+	Province string `json:"province"`
+}
+
+// setBillingProvinceHandler saves the province sales tax is charged for when a
+// purchase does not name one.
+func (s *Server) setBillingProvinceHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req billingProvinceBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	province, ok := tax.NormalizeProvince(req.Province)
+	if !ok {
+		http.Error(w, "province must be one of "+strings.Join(tax.Provinces(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.stores.Users.SetBillingProvince(userID, province); err != nil {
+		http.Error(w, "Failed to save billing province", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(billingProvinceBody{Province: province})
+}
+
+func (s *Server) getBillingProvinceHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(billingProvinceBody{Province: user.BillingProvince})
+}
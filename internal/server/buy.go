@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// buyRequest pays with card_id (one of the caller's credit_cards) or
+// payment_method_id (a Stripe PM registered to the caller). With neither, the
+// caller's default card is used. coupon_code is optional; billing_province
+// defaults to the one saved with PUT /users/billing-province and currency to
+// the base currency.
+type buyRequest struct {
+	Items           []store.BuyItem `json:"items"`
+	CardID          int             `json:"card_id"`
+	PaymentMethodID string          `json:"payment_method_id"`
+	CouponCode      string          `json:"coupon_code"`
+	BillingProvince string          `json:"billing_province"`
+	Currency        string          `json:"currency"`
+	// cartItemIDs are the cart items being checked out, if any (see
+	// store.NewOrder.CartItemIDs).
+	cartItemIDs []int
+}
+
+type buyResponse struct {
+	Success             bool   `json:"success"`
+	OrderID             int    `json:"order_id"`
+	OrderStatus         string `json:"order_status"`
+	PaymentStatus       string `json:"payment_status"`
+	StripePaymentIntent string `json:"stripe_payment_intent_id"`
+	Currency            string `json:"currency"`
+	TotalCents          int64  `json:"total_cents"`
+	DiscountCents       int64  `json:"discount_cents"`
+	TaxCents            int64  `json:"tax_cents"`
+	TaxProvince         string `json:"tax_province,omitempty"`
+	CouponCode          string `json:"coupon_code,omitempty"`
+	// ClientSecret is only set when the customer must complete an action
+	// (3-D Secure) with Stripe.js before the payment can succeed.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// paymentStatusUnknown is the payment_status of an order whose PaymentIntent
+// could not be created or read because the payment provider was unreachable.
+const paymentStatusUnknown = "unknown"
+
+func (s *Server) buyProductsHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode JSON payload
+	var req buyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Items) == 0 {
+		http.Error(w, "items are required", http.StatusBadRequest)
+		return
+	}
+
+	// Extract logged-in user_id from context
+	uidVal := r.Context().Value("user_id")
+	if uidVal == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := uidVal.(int)
+
+	s.placeOrder(w, r, userID, req)
+}
+
+// placeOrder charges the user for req.Items with the card req selects and writes
+// the outcome. It reports whether an order was placed, i.e. paid or pending an
+// action or webhook; on false the response is an error and nothing was charged.
+func (s *Server) placeOrder(w http.ResponseWriter, r *http.Request, userID int, req buyRequest) bool {
+	if req.CardID != 0 && req.PaymentMethodID != "" {
+		http.Error(w, "send either card_id or payment_method_id, not both", http.StatusBadRequest)
+		return false
+	}
+
+	// Fetch this user's stripe_customer_id
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return false
+	}
+	if user.StripeCustomerID == "" {
+		http.Error(w, "No Stripe customer on file. Add a credit card first.", http.StatusBadRequest)
+		return false
+	}
+
+	for _, it := range req.Items {
+		if it.Quantity <= 0 {
+			http.Error(w, "Quantity must be > 0", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	// Sales tax depends on where the customer is billed
+	province := req.BillingProvince
+	if province == "" {
+		province = user.BillingProvince
+	}
+	if province == "" {
+		http.Error(w, "billing_province is required (none on file)", http.StatusBadRequest)
+		return false
+	}
+	province, ok := tax.NormalizeProvince(province)
+	if !ok {
+		http.Error(w, "Unknown billing_province: "+province, http.StatusBadRequest)
+		return false
+	}
+
+	currency := money.Base
+	if req.Currency != "" {
+		if currency, ok = money.NormalizeCurrency(req.Currency); !ok {
+			http.Error(w, "Unsupported currency: "+req.Currency, http.StatusBadRequest)
+			return false
+		}
+	}
+
+	// The card must be one of the caller's saved, unexpired cards
+	card, herr := s.resolvePaymentCard(userID, req)
+	if herr != nil {
+		http.Error(w, herr.msg, herr.status)
+		return false
+	}
+
+	// Reserve stock and record a pending order, priced in currency
+	order, err := s.stores.Orders.CreatePending(store.NewOrder{
+		UserID:      userID,
+		Items:       req.Items,
+		Currency:    currency,
+		CouponCode:  strings.TrimSpace(req.CouponCode),
+		Province:    province,
+		CartItemIDs: req.cartItemIDs,
+	})
+	if err != nil {
+		var (
+			notFound        store.ProductNotFoundError
+			archived        store.ProductArchivedError
+			variantNotFound *store.VariantNotFoundError
+			variantRequired store.VariantRequiredError
+			shortfall       *store.InsufficientStockError
+			priceChanged    *store.PriceChangedError
+			coupon          store.CouponError
+			unknown         store.UnsupportedCurrencyError
+		)
+		switch {
+		case errors.As(err, &notFound):
+			http.Error(w, notFound.Error(), http.StatusBadRequest)
+		case errors.As(err, &archived):
+			http.Error(w, archived.Error(), http.StatusBadRequest)
+		case errors.As(err, &variantNotFound):
+			http.Error(w, variantNotFound.Error(), http.StatusBadRequest)
+		case errors.As(err, &variantRequired):
+			http.Error(w, variantRequired.Error(), http.StatusBadRequest)
+		case errors.As(err, &shortfall):
+			writeInsufficientStock(w, shortfall.Items)
+		case errors.As(err, &priceChanged):
+			http.Error(w, "Prices changed during checkout; review them and check out again", http.StatusConflict)
+		case errors.As(err, &coupon):
+			http.Error(w, coupon.Error(), http.StatusUnprocessableEntity)
+		case errors.As(err, &unknown):
+			http.Error(w, unknown.Error(), http.StatusBadRequest)
+		case errors.Is(err, store.ErrCartCheckedOut):
+			http.Error(w, cartCheckedOutMessage, http.StatusConflict)
+		default:
+			http.Error(w, "Failed to record purchase", http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	// Create a Stripe PaymentIntent restricted to "card"
+	pi, err := s.payments.CreatePaymentIntent(payment.IntentParams{
+		AmountCents:     order.TotalCents,
+		Currency:        currency,
+		CustomerID:      user.StripeCustomerID,
+		PaymentMethodID: card.StripePaymentMethodID,
+		Confirm:         true,
+		IdempotencyKey:  stripeIdempotencyKey(r, userID),
+		OrderID:         order.ID,
+	})
+	if errors.Is(err, payment.ErrUnavailable) {
+		// The intent may have been created anyway, so the order stays pending
+		// rather than risk failing a charged order
+		log.Printf("ERROR creating payment intent for order %d: %v\n", order.ID, err)
+		writePaymentUnknown(w, order)
+		return true
+	}
+	if err != nil {
+		// Release the reservation so the stock can be sold again
+		if ferr := s.stores.Orders.Fail(order.ID); ferr != nil {
+			log.Printf("ERROR releasing stock for order %d: %v\n", order.ID, ferr)
+		}
+		writePaymentError(w, "Stripe payment failed", err)
+		return false
+	}
+
+	// Only a succeeded intent finalizes the order; 3-D Secure and async
+	// payments leave it pending until /users/orders/{id}/confirm or a webhook.
+	return s.writePaymentOutcome(w, order, pi)
+}
+
+// resolvePaymentCard finds the saved card a purchase is paid with: the one named
+// by card_id or payment_method_id, or else the caller's default card.
+func (s *Server) resolvePaymentCard(userID int, req buyRequest) (*store.Card, *httpError) {
+	var (
+		card *store.Card
+		err  error
+	)
+	switch {
+	case req.CardID != 0:
+		card, err = s.stores.Cards.Get(req.CardID)
+	case req.PaymentMethodID != "":
+		card, err = s.stores.Cards.GetByPaymentMethod(req.PaymentMethodID)
+	default:
+		card, err = s.stores.Cards.GetDefault(userID)
+		if err == store.ErrNotFound {
+			return nil, &httpError{http.StatusBadRequest, "No default card on file; send card_id or payment_method_id"}
+		}
+	}
+	if err == store.ErrNotFound {
+		return nil, &httpError{http.StatusNotFound, "Card not found"}
+	}
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, "Failed to fetch card"}
+	}
+
+	if card.UserID != userID {
+		return nil, &httpError{http.StatusForbidden, "Card does not belong to this user"}
+	}
+	if card.Expired(time.Now()) {
+		return nil, &httpError{http.StatusUnprocessableEntity, fmt.Sprintf("Card has expired (%02d/%d)", card.ExpMonth, card.ExpYear)}
+	}
+	return card, nil
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+func TestBuyChargesAndTakesStock(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+
+	var resp buyResponse
+	rec := ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 2}}})
+	decode(t, rec, http.StatusOK, &resp)
+
+	// 2 x $10.00 plus 13% Ontario HST
+	if !resp.Success || resp.OrderStatus != store.OrderStatusPaid || resp.TaxCents != 260 || resp.TotalCents != 2260 {
+		t.Fatalf("response = %+v, want a paid order of 2260 cents with 260 cents tax", resp)
+	}
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("order status = %q, want paid", got)
+	}
+	if got := ts.stock(p.ID); got != 3 {
+		t.Fatalf("stock = %d, want 3", got)
+	}
+}
+
+func TestBuyInsufficientStock(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 1)
+	_, token := ts.shopper("alice")
+
+	var resp insufficientStockResponse
+	rec := ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 2}}})
+	decode(t, rec, http.StatusConflict, &resp)
+	if len(resp.Items) != 1 || resp.Items[0].ProductID != p.ID || resp.Items[0].Available != 1 {
+		t.Fatalf("shortfalls = %+v, want product %d with 1 available", resp.Items, p.ID)
+	}
+	if got := ts.stock(p.ID); got != 1 {
+		t.Fatalf("stock = %d, want 1", got)
+	}
+}
+
+func TestBuyVariants(t *testing.T) {
+	ts := newTestServer(t)
+	p, m, xl := ts.shirt(ts.admin())
+	_, token := ts.shopper("alice")
+
+	decode(t, ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}), http.StatusBadRequest, nil)
+
+	// Only the xl is short, of its own stock
+	var short insufficientStockResponse
+	decode(t, ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{
+		{ProductID: p.ID, VariantID: m.ID, Quantity: 2}, {ProductID: p.ID, VariantID: xl.ID, Quantity: 2},
+	}}), http.StatusConflict, &short)
+	if len(short.Items) != 1 || short.Items[0].VariantID != xl.ID || short.Items[0].Requested != 2 || short.Items[0].Available != 1 {
+		t.Fatalf("shortfalls = %+v, want the xl with 1 available", short.Items)
+	}
+	if gotM, gotXL := ts.variantStock(p.ID, m.ID), ts.variantStock(p.ID, xl.ID); gotM != 5 || gotXL != 1 {
+		t.Fatalf("stock = m %d, xl %d; want nothing taken (5 and 1)", gotM, gotXL)
+	}
+
+	// The xl sells at its $30.00 override plus 13% HST
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, VariantID: xl.ID, Quantity: 1}}}), http.StatusOK, &resp)
+	if resp.OrderStatus != store.OrderStatusPaid || resp.TotalCents != 3390 {
+		t.Fatalf("response = %+v, want a paid order of 3390 cents", resp)
+	}
+	if got := ts.variantStock(p.ID, xl.ID); got != 0 {
+		t.Fatalf("xl stock = %d, want 0", got)
+	}
+}
+
+func TestBuyDeclinedReleasesStock(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_chargeDeclined"}), http.StatusCreated, nil)
+
+	rec := ts.do("POST", "/users/buy", token, buyRequest{
+		Items:           []store.BuyItem{{ProductID: p.ID, Quantity: 2}},
+		PaymentMethodID: "pm_card_chargeDeclined",
+	})
+	if rec.Code < 400 {
+		t.Fatalf("status = %d, want an error for a declined card; body: %s", rec.Code, rec.Body)
+	}
+	if got := ts.stock(p.ID); got != 5 {
+		t.Fatalf("stock = %d, want the reservation released (5)", got)
+	}
+}
+
+func TestBuyThreeDSecureStaysPending(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_authenticationRequired"}), http.StatusCreated, nil)
+
+	var resp buyResponse
+	rec := ts.do("POST", "/users/buy", token, buyRequest{
+		Items:           []store.BuyItem{{ProductID: p.ID, Quantity: 1}},
+		PaymentMethodID: "pm_card_authenticationRequired",
+	})
+	decode(t, rec, http.StatusAccepted, &resp)
+	if resp.OrderStatus != store.OrderStatusPending || resp.ClientSecret == "" {
+		t.Fatalf("response = %+v, want a pending order with a client secret", resp)
+	}
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPending {
+		t.Fatalf("order status = %q, want pending", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want 4 held for the pending order", got)
+	}
+}
+
+func TestBuyIdempotencyKeyReplays(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+	req := buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}
+
+	first := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	second := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	if first.Code != http.StatusOK || second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %s, want the first response %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want one purchase (4)", got)
+	}
+
+	// The same key with another body is refused
+	req.Items[0].Quantity = 2
+	decode(t, ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1"), http.StatusUnprocessableEntity, nil)
+}
+
+func TestBuyProviderUnavailableKeepsOrderPending(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	ts.payments.NetworkErrorPaymentMethods["pm_card_visa"] = true
+	req := buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}
+
+	var resp buyResponse
+	first := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	decode(t, first, http.StatusAccepted, &resp)
+	if resp.OrderStatus != store.OrderStatusPending || resp.PaymentStatus != paymentStatusUnknown {
+		t.Fatalf("response = %+v, want a pending order with an unknown payment", resp)
+	}
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPending {
+		t.Fatalf("order status = %q, want pending", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want 4 held for the pending order", got)
+	}
+
+	// The key is kept: a retry does not place a second order
+	replay := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	if replay.Code != http.StatusAccepted || replay.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %s, want the first response", replay.Code, replay.Body)
+	}
+	decode(t, ts.do("POST", "/users/orders/1/confirm", token, nil), http.StatusConflict, nil)
+
+	// The intent was created after all; its webhook carries the order ID
+	ts.sendEvent("payment_intent.succeeded.unlinked")
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("order status = %q after the webhook, want paid", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want 4", got)
+	}
+}
+
+// failingOrders fails every SetPaymentIntent, as when the database goes away
+// after the provider created the intent.
+type failingOrders struct{ store.OrderStore }
+
+func (failingOrders) SetPaymentIntent(int, string, string) error {
+	return errors.New("connection refused")
+}
+
+func TestBuyKeepsOrderPendingWhenIntentCannotBeRecorded(t *testing.T) {
+	ts := newTestServer(t, func(s *store.Stores) { s.Orders = failingOrders{s.Orders} })
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	req := buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}
+
+	var resp buyResponse
+	first := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	decode(t, first, http.StatusAccepted, &resp)
+	if resp.OrderStatus != store.OrderStatusPending || resp.PaymentStatus != paymentStatusUnknown {
+		t.Fatalf("response = %+v, want a pending order with an unknown payment", resp)
+	}
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPending {
+		t.Fatalf("order status = %q, want pending", got)
+	}
+
+	// The card was charged, so the key is kept rather than inviting a second order
+	replay := ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1")
+	if replay.Code != http.StatusAccepted || replay.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %s, want the first response", replay.Code, replay.Body)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want one order (4)", got)
+	}
+}
+
+// crashingIdempotencyKeys never stores a response, as if the server died after
+// running the handler, and treats every unanswered claim as stale.
+type crashingIdempotencyKeys struct{ store.IdempotencyStore }
+
+func (c crashingIdempotencyKeys) Claim(userID int, key, requestHash string, _ time.Duration) (bool, error) {
+	return c.IdempotencyStore.Claim(userID, key, requestHash, 0)
+}
+
+func (crashingIdempotencyKeys) Save(int, string, store.StoredResponse) error { return nil }
+
+func TestBuyStaleIdempotencyClaimIsRetriedWithoutSecondCharge(t *testing.T) {
+	ts := newTestServer(t, func(s *store.Stores) { s.IdempotencyKeys = crashingIdempotencyKeys{s.IdempotencyKeys} })
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	req := buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}
+
+	var first buyResponse
+	decode(t, ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1"), http.StatusOK, &first)
+
+	// The lost claim is taken over instead of answering 409 forever; the rerun
+	// places a new order, which the provider refuses under the same key
+	decode(t, ts.do("POST", "/users/buy", token, req, "Idempotency-Key", "order-1"), http.StatusBadRequest, nil)
+	if got := ts.orderStatus(first.OrderID+1, userID); got != store.OrderStatusFailed {
+		t.Fatalf("retried order status = %q, want failed", got)
+	}
+	if got := ts.orderStatus(first.OrderID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("first order status = %q, want paid", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want one purchase (4)", got)
+	}
+}
+
+func TestAbandonedOrdersReleaseStock(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	ts.payments.NetworkErrorPaymentMethods["pm_card_visa"] = true
+
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}}), http.StatusAccepted, &resp)
+
+	ids, err := ts.stores.Orders.FailAbandoned(0, ts.srv.cancelAbandonedIntent)
+	if err != nil || len(ids) != 1 || ids[0] != resp.OrderID {
+		t.Fatalf("FailAbandoned = %v, %v; want order %d", ids, err, resp.OrderID)
+	}
+	if got := ts.stock(p.ID); got != 5 {
+		t.Fatalf("stock = %d, want the reservation released (5)", got)
+	}
+
+	// A late success takes the stock back
+	ts.sendEvent("payment_intent.succeeded.unlinked")
+	if got := ts.orderStatus(resp.OrderID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("order status = %q after a late success, want paid", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d after a late success, want 4", got)
+	}
+}
+
+func TestAbandonedThreeDSecureOrdersCancelTheirIntent(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_authenticationRequired"}), http.StatusCreated, nil)
+	buy := buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}, PaymentMethodID: "pm_card_authenticationRequired"}
+
+	var abandoned, paid buyResponse
+	decode(t, ts.do("POST", "/users/buy", token, buy), http.StatusAccepted, &abandoned)
+	decode(t, ts.do("POST", "/users/buy", token, buy), http.StatusAccepted, &paid)
+	// The second challenge is finished, but its webhook has not arrived yet
+	if _, err := ts.payments.GetPaymentIntent(paid.StripePaymentIntent); err != nil {
+		t.Fatalf("finishing 3-D Secure: %v", err)
+	}
+
+	ids, err := ts.stores.Orders.FailAbandoned(0, ts.srv.cancelAbandonedIntent)
+	if err != nil || len(ids) != 1 || ids[0] != abandoned.OrderID {
+		t.Fatalf("FailAbandoned = %v, %v; want order %d", ids, err, abandoned.OrderID)
+	}
+	if got := ts.orderStatus(abandoned.OrderID, userID); got != store.OrderStatusFailed {
+		t.Fatalf("abandoned order status = %q, want failed", got)
+	}
+	if pi, err := ts.payments.GetPaymentIntent(abandoned.StripePaymentIntent); err != nil || pi.Status != payment.IntentStatusCanceled {
+		t.Fatalf("abandoned intent = %+v, %v; want canceled", pi, err)
+	}
+	if got := ts.orderStatus(paid.OrderID, userID); got != store.OrderStatusPending {
+		t.Fatalf("order with a succeeded intent = %q, want pending for its webhook", got)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want the abandoned reservation released (4)", got)
+	}
+
+	// The customer can no longer finish the canceled payment
+	decode(t, ts.do("POST", "/users/orders/"+strconv.Itoa(abandoned.OrderID)+"/confirm", token, nil), http.StatusConflict, nil)
+}
+
+func TestBuyInCurrencyWithoutRate(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	var explicit store.Product
+	body := map[string]any{"name": "Mug", "price_cents": 1000, "stock_quantity": 5, "prices": map[string]int{"usd": 800}}
+	decode(t, ts.do("POST", "/admin/products", admin, body), http.StatusCreated, &explicit)
+	converted := ts.product(admin, "Bowl", 1000, 5)
+	userID, token := ts.shopper("alice")
+
+	// Every price is explicit: no rate is needed, and none is recorded
+	var resp buyResponse
+	rec := ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: explicit.ID, Quantity: 1}}, Currency: "usd"})
+	decode(t, rec, http.StatusOK, &resp)
+	if resp.TotalCents != 904 {
+		t.Fatalf("total = %d, want 904 (800 USD plus 13%% HST)", resp.TotalCents)
+	}
+	o, err := ts.stores.Orders.GetForUser(resp.OrderID, userID)
+	if err != nil || o.FXRate != "" {
+		t.Fatalf("order = %+v, %v; want no exchange rate", o, err)
+	}
+	sales, err := ts.stores.Orders.ListSales(store.SalesFilter{})
+	if err != nil || len(sales) != 1 || sales[0].BaseTotalPriceCents != nil {
+		t.Fatalf("sales = %+v, %v; want one line without a base amount", sales, err)
+	}
+
+	// A line priced by conversion needs the rate
+	rec = ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: explicit.ID, Quantity: 1}, {ProductID: converted.ID, Quantity: 1}}, Currency: "usd"})
+	decode(t, rec, http.StatusBadRequest, nil)
+	if got := ts.stock(explicit.ID); got != 4 {
+		t.Fatalf("stock = %d, want 4", got)
+	}
+
+	// Reports convert at the rate set since
+	decode(t, ts.do("PUT", "/admin/fx-rates/usd", admin, fxRateRequest{Rate: "0.8"}), http.StatusOK, nil)
+	sales, err = ts.stores.Orders.ListSales(store.SalesFilter{})
+	if err != nil || len(sales) != 1 || sales[0].BaseTotalPriceCents == nil || *sales[0].BaseTotalPriceCents != 1000 {
+		t.Fatalf("sales = %+v, %v; want a base amount of 1000", sales, err)
+	}
+}
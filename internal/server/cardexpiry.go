@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// RunCardExpiryJob flags saved cards as expiring or expired, once at start and
+// then every interval until ctx is done. Each change is recorded as a card
+// expiry event the user can list (and logged); expired cards are refused at
+// checkout.
+func (s *Server) RunCardExpiryJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.checkCardExpiry(time.Now()); err != nil {
+			log.Printf("ERROR checking card expiry: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkCardExpiry updates the expiry status of every card that is not yet expired.
+func (s *Server) checkCardExpiry(now time.Time) error {
+	cards, err := s.stores.Cards.ListUnexpired()
+	if err != nil {
+		return err
+	}
+	for _, c := range cards {
+		status := c.ExpiryStatusAt(now)
+		if status == c.ExpiryStatus {
+			continue
+		}
+		if err := s.stores.Cards.SetExpiryStatus(c.ID, status); err != nil {
+			return err
+		}
+		if status != store.CardStatusValid {
+			log.Printf("NOTICE: card %d (%s ending %s, %02d/%d) of user %d is %s\n",
+				c.ID, c.Brand, c.Last4, c.ExpMonth, c.ExpYear, c.UserID, status)
+		}
+	}
+	return nil
+}
+
+// listCardExpiryEventsHandler lists the caller's card expiry events, newest
+// first, so a client can tell the user to replace a card.
+func (s *Server) listCardExpiryEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	events, err := s.stores.Cards.ListExpiryEvents(userID)
+	if err != nil {
+		http.Error(w, "Failed to query card expiry events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
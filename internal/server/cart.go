@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// cartResponse is the caller's cart. TotalCents is at current prices, which is
+// what checkout charges.
+type cartResponse struct {
+	Items        []store.CartItem `json:"items"`
+	TotalCents   int64            `json:"total_cents"`
+	PriceChanged bool             `json:"price_changed"`
+}
+
+func newCartResponse(items []store.CartItem) cartResponse {
+	resp := cartResponse{Items: items}
+	for _, it := range items {
+		resp.TotalCents += int64(it.CurrentPriceCents) * int64(it.Quantity)
+		if it.PriceChanged {
+			resp.PriceChanged = true
+		}
+	}
+	return resp
+}
+
+// cartItemRequest is the payload for adding an item or changing its quantity.
+// VariantID is required when adding a product sold in variants.
+type cartItemRequest struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// cartCheckoutRequest selects the card, coupon, province and currency like buyRequest. Checkout is refused while
+// prices differ from when items were added, unless AcceptPriceChanges is set.
+type cartCheckoutRequest struct {
+	CardID             int    `json:"card_id"`
+	PaymentMethodID    string `json:"payment_method_id"`
+	CouponCode         string `json:"coupon_code"`
+	BillingProvince    string `json:"billing_province"`
+	Currency           string `json:"currency"`
+	AcceptPriceChanges bool   `json:"accept_price_changes"`
+}
+
+// cartCheckedOutMessage answers a checkout of items already checked out in a
+// pending order.
+const cartCheckedOutMessage = "Cart is already being checked out; complete or wait for the pending order first"
+
+// priceChangedResponse is the 409 body returned by checkout when prices changed.
+type priceChangedResponse struct {
+	Error string           `json:"error"`
+	Items []store.CartItem `json:"items"`
+}
+
+func (s *Server) getCartHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := s.stores.Carts.List(userID)
+	if err != nil {
+		http.Error(w, "Failed to query cart", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCartResponse(items))
+}
+
+// addCartItemHandler puts a product in the cart, or adds to its quantity if it
+// is already there. Stock is only checked (and reserved) at checkout.
+func (s *Server) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req cartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.ProductID == 0 {
+		http.Error(w, "product_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity <= 0 {
+		http.Error(w, "Quantity must be > 0", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.stores.Carts.Add(userID, req.ProductID, req.VariantID, req.Quantity)
+	if err != nil {
+		var (
+			notFound        store.ProductNotFoundError
+			archived        store.ProductArchivedError
+			variantNotFound *store.VariantNotFoundError
+			variantRequired store.VariantRequiredError
+		)
+		switch {
+		case errors.As(err, &notFound):
+			http.Error(w, notFound.Error(), http.StatusNotFound)
+		case errors.As(err, &archived):
+			http.Error(w, archived.Error(), http.StatusBadRequest)
+		case errors.As(err, &variantNotFound):
+			http.Error(w, variantNotFound.Error(), http.StatusNotFound)
+		case errors.As(err, &variantRequired):
+			http.Error(w, variantRequired.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to add cart item", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+// updateCartItemHandler sets the quantity of a cart item.
+func (s *Server) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse {item_id} from URL
+	itemID, err := strconv.Atoi(mux.Vars(r)["item_id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req cartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Quantity <= 0 {
+		http.Error(w, "Quantity must be > 0 (use DELETE to remove an item)", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.stores.Carts.SetQuantity(userID, itemID, req.Quantity)
+	if err == store.ErrNotFound {
+		http.Error(w, "Cart item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+func (s *Server) deleteCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse {item_id} from URL
+	itemID, err := strconv.Atoi(mux.Vars(r)["item_id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.stores.Carts.Remove(userID, itemID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Cart item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete cart item", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) clearCartHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.stores.Carts.Clear(userID); err != nil {
+		http.Error(w, "Failed to clear cart", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cartCheckoutHandler buys the cart's contents through the /users/buy flow, at
+// the prices the caller saw: the order is refused if one changes meanwhile. The
+// items leave the cart once the order is paid, which may be after 3-D Secure or
+// a webhook; items added or changed meanwhile stay.
+func (s *Server) cartCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional: without it the default card is used
+	var req cartCheckoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	items, err := s.stores.Carts.List(userID)
+	if err != nil {
+		http.Error(w, "Failed to query cart", http.StatusInternalServerError)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "Cart is empty", http.StatusBadRequest)
+		return
+	}
+
+	// Items of a pending order (e.g. awaiting 3-D Secure) are not charged twice
+	for _, it := range items {
+		if it.OrderID != 0 {
+			http.Error(w, cartCheckedOutMessage, http.StatusConflict)
+			return
+		}
+	}
+
+	// Let the user review price changes before charging the new prices
+	var changed []store.CartItem
+	for _, it := range items {
+		if it.PriceChanged {
+			changed = append(changed, it)
+		}
+	}
+	if len(changed) > 0 && !req.AcceptPriceChanges {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(priceChangedResponse{
+			Error: "prices changed since items were added; checkout again with accept_price_changes",
+			Items: changed,
+		})
+		return
+	}
+
+	buy := buyRequest{
+		Items:           make([]store.BuyItem, 0, len(items)),
+		CardID:          req.CardID,
+		PaymentMethodID: req.PaymentMethodID,
+		CouponCode:      req.CouponCode,
+		BillingProvince: req.BillingProvince,
+		Currency:        req.Currency,
+	}
+	for _, it := range items {
+		price := it.PriceCents
+		if req.AcceptPriceChanges {
+			price = it.CurrentPriceCents
+		}
+		buy.Items = append(buy.Items, store.BuyItem{
+			ProductID:          it.ProductID,
+			VariantID:          it.VariantID,
+			Quantity:           it.Quantity,
+			ExpectedPriceCents: &price,
+		})
+		buy.cartItemIDs = append(buy.cartItemIDs, it.ID)
+	}
+
+	s.placeOrder(w, r, userID, buy)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// shirt creates a $20.00 shirt sold in sizes m (stock 5, at the product's
+// price) and xl (stock 1, at a $30.00 price override).
+func (ts *testServer) shirt(admin string) (p store.Product, m, xl store.ProductVariant) {
+	ts.t.Helper()
+	p = ts.product(admin, "Shirt", 2000, 0)
+	decode(ts.t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/options", p.ID), admin,
+		optionsRequest{Options: []store.ProductOption{{Name: "size", Values: []string{"m", "xl"}}}}), http.StatusOK, nil)
+	decode(ts.t, ts.do("POST", fmt.Sprintf("/admin/products/%d/variants", p.ID), admin,
+		variantRequest{SKU: "SHIRT-M", Options: map[string]string{"size": "m"}, StockQuantity: 5}), http.StatusCreated, &m)
+	override := 3000
+	decode(ts.t, ts.do("POST", fmt.Sprintf("/admin/products/%d/variants", p.ID), admin,
+		variantRequest{SKU: "SHIRT-XL", Options: map[string]string{"size": "xl"}, PriceOverrideCents: &override, StockQuantity: 1}), http.StatusCreated, &xl)
+	return p, m, xl
+}
+
+// variantStock returns a variant's current stock.
+func (ts *testServer) variantStock(productID, variantID int) int {
+	ts.t.Helper()
+	p, err := ts.stores.Products.Get(productID)
+	if err != nil {
+		ts.t.Fatalf("getting product %d: %v", productID, err)
+	}
+	for _, v := range p.Variants {
+		if v.ID == variantID {
+			return v.StockQuantity
+		}
+	}
+	ts.t.Fatalf("product %d has no variant %d", productID, variantID)
+	return 0
+}
+
+func TestCartMergesItems(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 1}), http.StatusCreated, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 2}), http.StatusCreated, nil)
+
+	var cart cartResponse
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 3 || cart.TotalCents != 3000 {
+		t.Fatalf("cart = %+v, want one line of 3 mugs for 3000 cents", cart)
+	}
+}
+
+func TestCartCheckout(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 2}), http.StatusCreated, nil)
+
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, nil), http.StatusOK, &resp)
+	if resp.OrderStatus != store.OrderStatusPaid || resp.TotalCents != 2260 {
+		t.Fatalf("response = %+v, want a paid order of 2260 cents", resp)
+	}
+	if got := ts.stock(p.ID); got != 3 {
+		t.Fatalf("stock = %d, want 3", got)
+	}
+
+	var cart cartResponse
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("cart still holds %d items after checkout", len(cart.Items))
+	}
+	decode(t, ts.do("POST", "/users/cart/checkout", token, nil), http.StatusBadRequest, nil)
+}
+
+func TestCartCheckoutAsksToAcceptPriceChanges(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 1}), http.StatusCreated, nil)
+
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d", p.ID), admin, map[string]any{"name": "Mug", "price_cents": 1200, "stock_quantity": 5}), http.StatusOK, nil)
+
+	var changed priceChangedResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, nil), http.StatusConflict, &changed)
+	if len(changed.Items) != 1 || changed.Items[0].CurrentPriceCents != 1200 {
+		t.Fatalf("changed items = %+v, want the mug at 1200", changed.Items)
+	}
+
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, cartCheckoutRequest{AcceptPriceChanges: true}), http.StatusOK, &resp)
+	if resp.TotalCents != 1356 {
+		t.Fatalf("total = %d, want 1356 at the new price", resp.TotalCents)
+	}
+}
+
+func TestCartKeepsItemsUntilOrderIsPaid(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	mug := ts.product(admin, "Mug", 1000, 5)
+	bowl := ts.product(admin, "Bowl", 500, 5)
+	_, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_authenticationRequired"}), http.StatusCreated, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: mug.ID, Quantity: 1}), http.StatusCreated, nil)
+
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, cartCheckoutRequest{PaymentMethodID: "pm_card_authenticationRequired"}), http.StatusAccepted, &resp)
+
+	// Pending 3-D Secure, the cart is kept, and can be added to meanwhile
+	var cart cartResponse
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 1 {
+		t.Fatalf("cart holds %d items while the order is pending, want 1", len(cart.Items))
+	}
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: bowl.ID, Quantity: 1}), http.StatusCreated, nil)
+
+	decode(t, ts.do("POST", fmt.Sprintf("/users/orders/%d/confirm", resp.OrderID), token, nil), http.StatusOK, &resp)
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].ProductID != bowl.ID {
+		t.Fatalf("cart = %+v after payment, want only the bowl added since checkout", cart.Items)
+	}
+}
+
+func TestCreatePendingComparesExpectedPrices(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, _ := ts.shopper("alice")
+
+	stale := 900
+	_, err := ts.stores.Orders.CreatePending(store.NewOrder{
+		UserID:   userID,
+		Items:    []store.BuyItem{{ProductID: p.ID, Quantity: 1, ExpectedPriceCents: &stale}},
+		Currency: money.Base,
+		Province: "ON",
+	})
+	var changed *store.PriceChangedError
+	if !errors.As(err, &changed) || len(changed.Items) != 1 || changed.Items[0].CurrentCents != 1000 {
+		t.Fatalf("err = %v, want a *PriceChangedError for the mug at 1000", err)
+	}
+	if got := ts.stock(p.ID); got != 5 {
+		t.Fatalf("stock = %d, want 5", got)
+	}
+}
+
+func TestCartCannotBeCheckedOutTwice(t *testing.T) {
+	ts := newTestServer(t)
+	p := ts.product(ts.admin(), "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_authenticationRequired"}), http.StatusCreated, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 1}), http.StatusCreated, nil)
+	checkout := cartCheckoutRequest{PaymentMethodID: "pm_card_authenticationRequired"}
+
+	var first buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, checkout), http.StatusAccepted, &first)
+	var cart cartResponse
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].OrderID != first.OrderID {
+		t.Fatalf("cart = %+v, want the mug checked out in order %d", cart.Items, first.OrderID)
+	}
+
+	// Neither the handler nor the store takes the items again
+	decode(t, ts.do("POST", "/users/cart/checkout", token, checkout), http.StatusConflict, nil)
+	_, err := ts.stores.Orders.CreatePending(store.NewOrder{
+		UserID:      userID,
+		Items:       []store.BuyItem{{ProductID: p.ID, Quantity: 1}},
+		Currency:    money.Base,
+		Province:    "ON",
+		CartItemIDs: []int{cart.Items[0].ID},
+	})
+	if !errors.Is(err, store.ErrCartCheckedOut) {
+		t.Fatalf("CreatePending = %v, want ErrCartCheckedOut", err)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want one reservation (4)", got)
+	}
+
+	// Once the order fails, the items can be checked out again
+	if err := ts.stores.Orders.Fail(first.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	var second buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, checkout), http.StatusAccepted, &second)
+	decode(t, ts.do("POST", fmt.Sprintf("/users/orders/%d/confirm", second.OrderID), token, nil), http.StatusOK, nil)
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("cart = %+v after payment, want it empty", cart.Items)
+	}
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want 4", got)
+	}
+}
+
+func TestCartVariants(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p, m, xl := ts.shirt(admin)
+	other := ts.product(admin, "Mug", 1000, 5)
+	_, token := ts.shopper("alice")
+
+	// A product with variants is added as one of them, and only as its own
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, Quantity: 1}), http.StatusBadRequest, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: other.ID, VariantID: m.ID, Quantity: 1}), http.StatusNotFound, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, VariantID: 999, Quantity: 1}), http.StatusNotFound, nil)
+
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, VariantID: m.ID, Quantity: 2}), http.StatusCreated, nil)
+	decode(t, ts.do("POST", "/users/cart/items", token, cartItemRequest{ProductID: p.ID, VariantID: xl.ID, Quantity: 1}), http.StatusCreated, nil)
+	var cart cartResponse
+	decode(t, ts.do("GET", "/users/cart/items", token, nil), http.StatusOK, &cart)
+	// The xl's price override wins over the product's price
+	if len(cart.Items) != 2 || cart.TotalCents != 7000 {
+		t.Fatalf("cart = %+v, want 2 m at 2000 and an xl at 3000", cart)
+	}
+
+	var resp buyResponse
+	decode(t, ts.do("POST", "/users/cart/checkout", token, nil), http.StatusOK, &resp)
+	if resp.OrderStatus != store.OrderStatusPaid || resp.TotalCents != 7910 {
+		t.Fatalf("response = %+v, want a paid order of 7910 cents", resp)
+	}
+	if gotM, gotXL := ts.variantStock(p.ID, m.ID), ts.variantStock(p.ID, xl.ID); gotM != 3 || gotXL != 0 {
+		t.Fatalf("stock = m %d, xl %d; want 3 and 0", gotM, gotXL)
+	}
+}
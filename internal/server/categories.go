@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// slugPattern is the form of category slugs: lower-case words joined by dashes.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// categoryRequest is the payload for creating or replacing a category. An
+// omitted slug is derived from the name; an omitted parent_id is top-level.
+type categoryRequest struct {
+	ParentID *int   `json:"parent_id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+}
+
+// categoryNode is a category with its subcategories, as listed by GET /categories.
+type categoryNode struct {
+	store.Category
+	Children []categoryNode `json:"children"`
+}
+
+// input validates the request; the returned message is empty when it is valid.
+func (req categoryRequest) input() (store.CategoryInput, string) {
+	in := store.CategoryInput{
+		ParentID: req.ParentID,
+		Name:     strings.TrimSpace(req.Name),
+		Slug:     strings.TrimSpace(req.Slug),
+	}
+	if in.Slug == "" {
+		in.Slug = slugify(in.Name)
+	}
+
+	switch {
+	case in.Name == "" || len(in.Name) > 100:
+		return in, "name is required (max 100 characters)"
+	case !slugPattern.MatchString(in.Slug) || len(in.Slug) > 100:
+		return in, "slug must be lower-case letters, digits and dashes (max 100 characters)"
+	}
+	return in, ""
+}
+
+// slugify lower-cases s and joins its runs of ASCII letters and digits with dashes.
+func slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	return strings.Join(words, "-")
+}
+
+// listCategoriesHandler returns the category tree, each level sorted by name.
+func (s *Server) listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := s.stores.Categories.List()
+	if err != nil {
+		http.Error(w, "Failed to query categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categoryTree(categories, nil))
+}
+
+// categoryTree nests the categories under parent (nil for the top level),
+// keeping their order.
+func categoryTree(categories []store.Category, parent *int) []categoryNode {
+	nodes := make([]categoryNode, 0)
+	for _, c := range categories {
+		if (parent == nil) != (c.ParentID == nil) || (parent != nil && *parent != *c.ParentID) {
+			continue
+		}
+		nodes = append(nodes, categoryNode{Category: c, Children: categoryTree(categories, &c.ID)})
+	}
+	return nodes
+}
+
+// listCategoryProductsHandler lists the products of a category and of all its
+// subcategories, with the paging, sorting and filters of GET /products.
+func (s *Server) listCategoryProductsHandler(w http.ResponseWriter, r *http.Request) {
+	category, err := s.stores.Categories.GetBySlug(mux.Vars(r)["slug"])
+	if err == store.ErrNotFound {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to query category", http.StatusInternalServerError)
+		return
+	}
+
+	q, msg := productQuery(r.URL.Query())
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q.CategorySlug = category.Slug
+	s.writeProductPage(w, r, q)
+}
+
+func (s *Server) createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	category, err := s.stores.Categories.Create(in)
+	if err != nil {
+		writeCategoryStoreError(w, err, "Failed to create category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// updateCategoryHandler renames and/or moves a category; its subcategories move
+// with it.
+func (s *Server) updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	category, err := s.stores.Categories.Update(categoryID, in)
+	if err != nil {
+		writeCategoryStoreError(w, err, "Failed to update category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// deleteCategoryHandler deletes a category without subcategories; its products
+// are unassigned from it but kept.
+func (s *Server) deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.stores.Categories.Delete(categoryID); err != nil {
+		writeCategoryStoreError(w, err, "Failed to delete category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCategoryStoreError maps CategoryStore errors to HTTP responses.
+func writeCategoryStoreError(w http.ResponseWriter, err error, fallback string) {
+	var unknown store.CategoryNotFoundError
+	switch {
+	case err == store.ErrNotFound:
+		http.Error(w, "Category not found", http.StatusNotFound)
+	case err == store.ErrConflict:
+		http.Error(w, "Category slug already exists", http.StatusConflict)
+	case err == store.ErrCategoryCycle:
+		http.Error(w, "A category cannot be moved under itself or one of its subcategories", http.StatusConflict)
+	case err == store.ErrCategoryNotEmpty:
+		http.Error(w, "Category has subcategories; move or delete them first", http.StatusConflict)
+	case errors.As(err, &unknown):
+		http.Error(w, "Parent category not found: "+strconv.Itoa(int(unknown)), http.StatusBadRequest)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
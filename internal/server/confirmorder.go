@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// writePaymentOutcome records the PaymentIntent on a pending order and answers the
+// client according to the intent's status:
+//
+//	succeeded              → order paid, 200
+//	requires_action        → order stays pending, 202 with client_secret for 3-D Secure
+//	processing             → order stays pending, 202 (a webhook finishes it)
+//	anything else          → order failed and stock released, 400
+//
+// If the intent cannot be recorded on the order, the charge may already have
+// gone through, so the order stays pending and the answer is the same 202 as
+// writePaymentUnknown; the intent's webhook finds the order by its metadata.
+// It reports whether the order is paid or still pending.
+func (s *Server) writePaymentOutcome(w http.ResponseWriter, order *store.Order, pi *payment.IntentInfo) bool {
+	orderID := order.ID
+	resp := newBuyResponse(order)
+	resp.PaymentStatus = pi.Status
+	resp.StripePaymentIntent = pi.ID
+	httpStatus := http.StatusAccepted
+
+	switch pi.Status {
+	case payment.IntentStatusSucceeded:
+		resp.Success = true
+		resp.OrderStatus = store.OrderStatusPaid
+		httpStatus = http.StatusOK
+	case payment.IntentStatusRequiresAction, payment.IntentStatusRequiresConfirmation:
+		resp.OrderStatus = store.OrderStatusPending
+		resp.ClientSecret = pi.ClientSecret
+	case payment.IntentStatusProcessing:
+		resp.OrderStatus = store.OrderStatusPending
+	default:
+		if err := s.stores.Orders.SetPaymentIntent(orderID, pi.ID, store.OrderStatusPending); err != nil {
+			log.Printf("ERROR recording payment intent %s for order %d: %v\n", pi.ID, orderID, err)
+		}
+		if err := s.stores.Orders.Fail(orderID); err != nil {
+			log.Printf("ERROR releasing stock for order %d: %v\n", orderID, err)
+		}
+		http.Error(w, "Payment failed (status: "+pi.Status+")", http.StatusBadRequest)
+		return false
+	}
+
+	if err := s.stores.Orders.SetPaymentIntent(orderID, pi.ID, resp.OrderStatus); err != nil {
+		log.Printf("ERROR recording payment intent %s for order %d: %v\n", pi.ID, orderID, err)
+		writePaymentUnknown(w, order)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(resp)
+	return true
+}
+
+// newBuyResponse describes an order before its payment outcome is filled in.
+func newBuyResponse(order *store.Order) buyResponse {
+	return buyResponse{
+		OrderID:       order.ID,
+		TotalCents:    order.TotalCents,
+		DiscountCents: order.DiscountCents,
+		TaxCents:      order.TaxCents,
+		TaxProvince:   order.TaxProvince,
+		CouponCode:    order.CouponCode,
+		Currency:      order.Currency,
+	}
+}
+
+// writePaymentUnknown answers for a pending order whose PaymentIntent may or may
+// not have been created because the provider could not be reached, or could not
+// be recorded on the order. The order
+// keeps its stock until the intent's webhook arrives or RunAbandonedOrderJob
+// gives up on it, so the client is told to check the order later (202).
+func writePaymentUnknown(w http.ResponseWriter, order *store.Order) {
+	resp := newBuyResponse(order)
+	resp.OrderStatus = store.OrderStatusPending
+	resp.PaymentStatus = paymentStatusUnknown
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// confirmOrderHandler is called by the client after it finished the action
+// (3-D Secure) required by a pending order's PaymentIntent. It re-reads the intent,
+// confirms it if Stripe is still waiting for confirmation, and finalizes the order.
+func (s *Server) confirmOrderHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse {id} from URL
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	// The order must belong to the caller
+	order, err := s.stores.Orders.GetForUser(orderID, userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if order.Status != store.OrderStatusPending {
+		http.Error(w, "Order is not awaiting payment (status: "+order.Status+")", http.StatusConflict)
+		return
+	}
+	if order.StripePaymentIntentID == "" {
+		http.Error(w, "The payment provider has not reported on this order's payment yet; check its status later", http.StatusConflict)
+		return
+	}
+
+	pi, err := s.payments.GetPaymentIntent(order.StripePaymentIntentID)
+	if err != nil {
+		writePaymentError(w, "Failed to fetch payment", err)
+		return
+	}
+	if pi.Status == payment.IntentStatusRequiresConfirmation {
+		pi, err = s.payments.ConfirmPaymentIntent(order.StripePaymentIntentID)
+		if err != nil {
+			writePaymentError(w, "Payment confirmation failed", err)
+			return
+		}
+	}
+
+	s.writePaymentOutcome(w, order, pi)
+}
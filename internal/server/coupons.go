@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// couponRequest is the payload for creating or replacing a coupon. Omitted
+// limits and validity bounds mean "no limit"; active defaults to true.
+type couponRequest struct {
+	Code                  string     `json:"code"`
+	DiscountType          string     `json:"discount_type"`
+	Value                 int        `json:"value"`
+	MinOrderCents         int        `json:"min_order_cents"`
+	MaxRedemptions        *int       `json:"max_redemptions"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user"`
+	StartsAt              *time.Time `json:"starts_at"`
+	EndsAt                *time.Time `json:"ends_at"`
+	Active                *bool      `json:"active"`
+	ProductIDs            []int      `json:"product_ids"`
+}
+
+// input validates the request; the returned message is empty when it is valid.
+func (req couponRequest) input() (store.CouponInput, string) {
+	in := store.CouponInput{
+		Code:                  strings.TrimSpace(req.Code),
+		DiscountType:          req.DiscountType,
+		Value:                 req.Value,
+		MinOrderCents:         req.MinOrderCents,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		StartsAt:              req.StartsAt,
+		EndsAt:                req.EndsAt,
+		Active:                req.Active == nil || *req.Active,
+		ProductIDs:            req.ProductIDs,
+	}
+
+	switch {
+	case in.Code == "" || len(in.Code) > 50:
+		return in, "code is required (max 50 characters)"
+	case in.DiscountType != store.CouponPercent && in.DiscountType != store.CouponFixed:
+		return in, "discount_type must be 'percent' or 'fixed'"
+	case in.Value <= 0:
+		return in, "value must be > 0"
+	case in.DiscountType == store.CouponPercent && in.Value > 100:
+		return in, "value of a percent coupon must be <= 100"
+	case in.MinOrderCents < 0:
+		return in, "min_order_cents must be >= 0"
+	case in.MaxRedemptions != nil && *in.MaxRedemptions <= 0:
+		return in, "max_redemptions must be > 0"
+	case in.MaxRedemptionsPerUser != nil && *in.MaxRedemptionsPerUser <= 0:
+		return in, "max_redemptions_per_user must be > 0"
+	case in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt):
+		return in, "ends_at must be after starts_at"
+	}
+	return in, ""
+}
+
+func (s *Server) createCouponHandler(w http.ResponseWriter, r *http.Request) {
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	coupon, err := s.stores.Coupons.Create(in)
+	if err != nil {
+		writeCouponStoreError(w, err, "Failed to create coupon")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// listCouponsHandler returns every coupon with its redemption totals.
+func (s *Server) listCouponsHandler(w http.ResponseWriter, r *http.Request) {
+	coupons, err := s.stores.Coupons.List()
+	if err != nil {
+		http.Error(w, "Failed to query coupons", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+func (s *Server) getCouponHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	couponID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	coupon, err := s.stores.Coupons.Get(couponID)
+	if err != nil {
+		writeCouponStoreError(w, err, "Failed to query coupon")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// updateCouponHandler replaces a coupon. Past redemptions are kept and still
+// count towards its limits.
+func (s *Server) updateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	couponID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	coupon, err := s.stores.Coupons.Update(couponID, in)
+	if err != nil {
+		writeCouponStoreError(w, err, "Failed to update coupon")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// deleteCouponHandler removes a coupon. Orders that redeemed it keep its code;
+// set active to false instead to keep it in the coupon list.
+func (s *Server) deleteCouponHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	couponID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.stores.Coupons.Delete(couponID); err != nil {
+		writeCouponStoreError(w, err, "Failed to delete coupon")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCouponStoreError answers a failed CouponStore call.
+func writeCouponStoreError(w http.ResponseWriter, err error, msg string) {
+	var notFound store.ProductNotFoundError
+	switch {
+	case err == store.ErrNotFound:
+		http.Error(w, "Coupon not found", http.StatusNotFound)
+	case err == store.ErrConflict:
+		http.Error(w, "A coupon with this code already exists", http.StatusConflict)
+	case errors.As(err, &notFound):
+		http.Error(w, notFound.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
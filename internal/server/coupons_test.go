@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// coupon creates a coupon through the admin API.
+func (ts *testServer) coupon(admin string, req couponRequest) store.Coupon {
+	ts.t.Helper()
+	var c store.Coupon
+	decode(ts.t, ts.do("POST", "/admin/coupons", admin, req), http.StatusCreated, &c)
+	return c
+}
+
+// buyWithCoupon buys one unit of each product with code and returns the
+// response status and, when the order was placed, its response.
+func (ts *testServer) buyWithCoupon(token, code string, productIDs ...int) (int, buyResponse) {
+	ts.t.Helper()
+	req := buyRequest{CouponCode: code}
+	for _, id := range productIDs {
+		req.Items = append(req.Items, store.BuyItem{ProductID: id, Quantity: 1})
+	}
+	rec := ts.do("POST", "/users/buy", token, req)
+	var resp buyResponse
+	if rec.Code == http.StatusOK {
+		decode(ts.t, rec, http.StatusOK, &resp)
+	}
+	return rec.Code, resp
+}
+
+// shopperWithCard is shopper with another payment method than pm_card_visa,
+// which a single customer can have attached.
+func (ts *testServer) shopperWithCard(name, paymentMethodID string) string {
+	ts.t.Helper()
+	_, tokens := ts.login(name)
+	decode(ts.t, ts.do("POST", "/users/creditcards", tokens.Token, addCCRequest{PaymentMethodID: paymentMethodID}), http.StatusCreated, nil)
+	decode(ts.t, ts.do("PUT", "/users/billing-province", tokens.Token, billingProvinceBody{Province: "ON"}), http.StatusOK, nil)
+	return tokens.Token
+}
+
+func TestCouponCodesAreCaseInsensitive(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Mug", 1000, 5)
+	ts.coupon(admin, couponRequest{Code: "SPRING15", DiscountType: store.CouponPercent, Value: 15})
+
+	decode(t, ts.do("POST", "/admin/coupons", admin,
+		couponRequest{Code: "spring15", DiscountType: store.CouponFixed, Value: 100}), http.StatusConflict, nil)
+
+	_, token := ts.shopper("alice")
+	status, resp := ts.buyWithCoupon(token, "Spring15", p.ID)
+	if status != http.StatusOK || resp.CouponCode != "SPRING15" || resp.DiscountCents != 150 {
+		t.Fatalf("buy = %d %+v, want SPRING15 taking 150 cents off", status, resp)
+	}
+}
+
+func TestCouponValidityWindow(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Mug", 1000, 5)
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	ts.coupon(admin, couponRequest{Code: "EXPIRED", DiscountType: store.CouponFixed, Value: 100, EndsAt: &past})
+	ts.coupon(admin, couponRequest{Code: "LATER", DiscountType: store.CouponFixed, Value: 100, StartsAt: &future})
+	inactive := false
+	ts.coupon(admin, couponRequest{Code: "OFF", DiscountType: store.CouponFixed, Value: 100, Active: &inactive})
+	ts.coupon(admin, couponRequest{Code: "NOW", DiscountType: store.CouponFixed, Value: 100, StartsAt: &past, EndsAt: &future})
+
+	_, token := ts.shopper("alice")
+	for code, want := range map[string]int{
+		"EXPIRED": http.StatusUnprocessableEntity,
+		"LATER":   http.StatusUnprocessableEntity,
+		"OFF":     http.StatusUnprocessableEntity,
+		"UNKNOWN": http.StatusUnprocessableEntity,
+		"NOW":     http.StatusOK,
+	} {
+		if status, _ := ts.buyWithCoupon(token, code, p.ID); status != want {
+			t.Errorf("buy with %s = %d, want %d", code, status, want)
+		}
+	}
+	// Refused coupons take no stock
+	if got := ts.stock(p.ID); got != 4 {
+		t.Fatalf("stock = %d, want one purchase (4)", got)
+	}
+}
+
+func TestCouponRedemptionLimits(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Mug", 1000, 10)
+	one, two := 1, 2
+	ts.coupon(admin, couponRequest{
+		Code: "TWICE", DiscountType: store.CouponFixed, Value: 100,
+		MaxRedemptions: &two, MaxRedemptionsPerUser: &one,
+	})
+
+	_, alice := ts.shopper("alice")
+	// Each further shopper needs a card of their own
+	bob, carol := ts.shopperWithCard("bob", "pm_card_mastercard"), ts.shopperWithCard("carol", "pm_card_amex")
+	for _, tc := range []struct {
+		who, token string
+		want       int
+	}{
+		{"alice", alice, http.StatusOK},
+		{"alice again", alice, http.StatusUnprocessableEntity}, // per-user limit
+		{"bob", bob, http.StatusOK},
+		{"carol", carol, http.StatusUnprocessableEntity}, // global limit
+	} {
+		if status, _ := ts.buyWithCoupon(tc.token, "TWICE", p.ID); status != tc.want {
+			t.Errorf("%s = %d, want %d", tc.who, status, tc.want)
+		}
+	}
+
+	var c store.Coupon
+	decode(t, ts.do("GET", "/admin/coupons/1", admin, nil), http.StatusOK, &c)
+	if c.TimesRedeemed != 2 || c.DiscountedCents != 200 {
+		t.Fatalf("coupon = %+v, want 2 redemptions worth 200 cents", c)
+	}
+}
+
+func TestCouponDiscountRounding(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	odd := ts.product(admin, "Odd", 1099, 10)
+	even := ts.product(admin, "Even", 1000, 10)
+	small := ts.product(admin, "Small", 300, 10)
+	ts.coupon(admin, couponRequest{Code: "PCT15", DiscountType: store.CouponPercent, Value: 15})
+	ts.coupon(admin, couponRequest{Code: "FIXED5", DiscountType: store.CouponFixed, Value: 500})
+	ts.coupon(admin, couponRequest{Code: "SMALLONLY", DiscountType: store.CouponFixed, Value: 500, ProductIDs: []int{small.ID}})
+	_, token := ts.shopper("alice")
+
+	for _, tc := range []struct {
+		code                 string
+		products             []int
+		discount, tax, total int64
+	}{
+		// 15% of 1099 is 164.85: rounded down; 13% HST on the 935 left is 121.55
+		{"PCT15", []int{odd.ID}, 164, 122, 1057},
+		// 15% of 2099 is 314.85, spread 164/150 over the lines; tax is rounded
+		// per line, 121.55 + 110.5
+		{"PCT15", []int{odd.ID, even.ID}, 314, 233, 2018},
+		{"FIXED5", []int{odd.ID}, 500, 78, 677},
+		// A fixed amount never exceeds what it applies to
+		{"SMALLONLY", []int{small.ID, even.ID}, 300, 130, 1130},
+	} {
+		status, resp := ts.buyWithCoupon(token, tc.code, tc.products...)
+		if status != http.StatusOK || resp.DiscountCents != tc.discount || resp.TaxCents != tc.tax || resp.TotalCents != tc.total {
+			t.Errorf("%s on %v = %d %+v, want %d off, %d tax, %d total",
+				tc.code, tc.products, status, resp, tc.discount, tc.tax, tc.total)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// This struct mirrors the incoming JSON payload.
+type addCCRequest struct {
+	PaymentMethodID string `json:"payment_method_id"`
+}
+
+// This struct is what we return for a row of credit_cards.
+type creditCardResponse struct {
+	ID                 int    `json:"id"`
+	StripePaymentMthID string `json:"stripe_payment_method_id"`
+	Brand              string `json:"brand"`
+	Last4              string `json:"last4"`
+	ExpMonth           int    `json:"exp_month"`
+	ExpYear            int    `json:"exp_year"`
+	IsDefault          bool   `json:"is_default"`
+	ExpiryStatus       string `json:"expiry_status"`
+}
+
+func newCreditCardResponse(c *store.Card) creditCardResponse {
+	return creditCardResponse{
+		ID:                 c.ID,
+		StripePaymentMthID: c.StripePaymentMethodID,
+		Brand:              c.Brand,
+		Last4:              c.Last4,
+		ExpMonth:           c.ExpMonth,
+		ExpYear:            c.ExpYear,
+		IsDefault:          c.IsDefault,
+		ExpiryStatus:       c.ExpiryStatus,
+	}
+}
+
+// addCreditCardHandler attaches a Stripe PaymentMethod to the user’s Stripe Customer,
+// then saves metadata in our `credit_cards` table.
+func (s *Server) addCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode request JSON
+	var req addCCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.PaymentMethodID == "" {
+		http.Error(w, "payment_method_id is required", http.StatusBadRequest)
+		return
+	}
+
+	// Extract logged-in user_id from context
+	ctx := r.Context()
+	uidVal := ctx.Value("user_id")
+	if uidVal == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := uidVal.(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Fetch the user's email and existing stripe_customer_id
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// If stripe_customer_id is empty, create a Stripe Customer and update users
+	customerID, herr := s.ensureStripeCustomer(user)
+	if herr != nil {
+		http.Error(w, herr.msg, herr.status)
+		return
+	}
+
+	// Attach the PaymentMethod to that Stripe Customer
+	pm, err := s.payments.AttachPaymentMethod(req.PaymentMethodID, customerID)
+	if err != nil {
+		// if PM is invalid or already attached
+		writePaymentError(w, "Failed to attach payment method", err)
+		return
+	}
+
+	// Insert into credit_cards table
+	card, existed, err := s.saveCard(userID, customerID, pm)
+	if err != nil {
+		writeSaveCardError(w, err)
+		return
+	}
+
+	// Return the credit card record as JSON
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newCreditCardResponse(card))
+}
+
+// ensureStripeCustomer returns the user's Stripe customer ID, creating the
+// customer on first use.
+func (s *Server) ensureStripeCustomer(user *store.User) (string, *httpError) {
+	if user.StripeCustomerID != "" {
+		return user.StripeCustomerID, nil
+	}
+
+	// Create a new Stripe Customer
+	customerID, err := s.payments.CreateCustomer(user.Email)
+	if err != nil {
+		return "", &httpError{http.StatusInternalServerError, "Failed to create Stripe customer"}
+	}
+
+	// Update users.stripe_customer_id
+	if err := s.stores.Users.SetStripeCustomerID(user.ID, customerID); err != nil {
+		return "", &httpError{http.StatusInternalServerError, "Server error updating stripe_customer_id"}
+	}
+	user.StripeCustomerID = customerID
+	return customerID, nil
+}
+
+// duplicateCardError reports a payment method for a card the user already saved.
+type duplicateCardError struct {
+	Card *store.Card
+}
+
+func (e *duplicateCardError) Error() string {
+	return "This card is already saved (card_id " + strconv.Itoa(e.Card.ID) + ")"
+}
+
+// saveCard stores a payment method attached to the user's customer as one of
+// their cards. A payment method that is already saved for the user is returned
+// as is (existed is true). A new payment method for a card the user already
+// saved, detected by fingerprint, is detached again and reported as
+// *duplicateCardError.
+func (s *Server) saveCard(userID int, customerID string, pm *payment.MethodInfo) (card *store.Card, existed bool, err error) {
+	card, err = s.stores.Cards.GetByPaymentMethod(pm.ID)
+	if err == nil && card.UserID == userID {
+		return card, true, nil
+	}
+	if err != nil && err != store.ErrNotFound {
+		return nil, false, err
+	}
+
+	if pm.Fingerprint != "" {
+		dup, err := s.stores.Cards.GetByFingerprint(userID, pm.Fingerprint)
+		if err == nil {
+			if derr := s.payments.DetachPaymentMethod(pm.ID); derr != nil {
+				log.Printf("ERROR detaching duplicate payment method %s: %v\n", pm.ID, derr)
+			}
+			return nil, false, &duplicateCardError{Card: dup}
+		}
+		if err != store.ErrNotFound {
+			return nil, false, err
+		}
+	}
+
+	card = &store.Card{
+		UserID:                userID,
+		StripePaymentMethodID: pm.ID,
+		Brand:                 pm.Brand,
+		Last4:                 pm.Last4,
+		ExpMonth:              pm.ExpMonth,
+		ExpYear:               pm.ExpYear,
+		Fingerprint:           pm.Fingerprint,
+	}
+	card.ExpiryStatus = card.ExpiryStatusAt(time.Now())
+	if err := s.stores.Cards.Create(card); err != nil {
+		// The webhook and the complete endpoint may race to save the same card
+		if err == store.ErrConflict {
+			if existing, gerr := s.stores.Cards.GetByPaymentMethod(pm.ID); gerr == nil && existing.UserID == userID {
+				return existing, true, nil
+			}
+		}
+		// Log the full error and the attempted values
+		log.Printf(
+			"ERROR inserting credit_card row: %v\n   Values: userID=%d, pm.ID=%q, brand=%q, last4=%q, expMonth=%d, expYear=%d\n",
+			err, userID, pm.ID, pm.Brand, pm.Last4, pm.ExpMonth, pm.ExpYear,
+		)
+		return nil, false, err
+	}
+
+	// The first card becomes the default, in Stripe too
+	if card.IsDefault {
+		s.syncDefaultCard(customerID, card.StripePaymentMethodID)
+	}
+	return card, false, nil
+}
+
+// writeSaveCardError answers a failed saveCard.
+func writeSaveCardError(w http.ResponseWriter, err error) {
+	var dup *duplicateCardError
+	switch {
+	case errors.As(err, &dup):
+		http.Error(w, dup.Error(), http.StatusConflict)
+	case err == store.ErrConflict:
+		http.Error(w, "This card is already saved", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save credit card", http.StatusInternalServerError)
+	}
+}
+
+// listCreditCardsHandler returns the caller's saved cards, default card first.
+func (s *Server) listCreditCardsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	cards, err := s.stores.Cards.ListForUser(userID)
+	if err != nil {
+		http.Error(w, "Failed to query credit cards", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]creditCardResponse, 0, len(cards))
+	for i := range cards {
+		resp = append(resp, newCreditCardResponse(&cards[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setDefaultCreditCardHandler makes one of the caller's cards the default used by
+// /users/buy and by Stripe (the customer's invoice_settings.default_payment_method).
+func (s *Server) setDefaultCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse {card_id} from URL
+	cardID, err := strconv.Atoi(mux.Vars(r)["card_id"])
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return
+	}
+
+	card, err := s.stores.Cards.GetForUser(cardID, userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Credit card not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if card.Expired(time.Now()) {
+		http.Error(w, "Card has expired", http.StatusUnprocessableEntity)
+		return
+	}
+
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	if user.StripeCustomerID != "" {
+		if err := s.payments.SetDefaultPaymentMethod(user.StripeCustomerID, card.StripePaymentMethodID); err != nil {
+			writePaymentError(w, "Failed to set default payment method", err)
+			return
+		}
+	}
+
+	if err := s.stores.Cards.SetDefault(userID, cardID); err != nil {
+		http.Error(w, "Failed to set default card", http.StatusInternalServerError)
+		return
+	}
+	card.IsDefault = true
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCreditCardResponse(card))
+}
+
+// syncDefaultCard mirrors a default card chosen by the server to Stripe. Failures
+// are only logged: checkout reads the default from our own table.
+func (s *Server) syncDefaultCard(customerID, paymentMethodID string) {
+	if err := s.payments.SetDefaultPaymentMethod(customerID, paymentMethodID); err != nil {
+		log.Printf("ERROR setting default payment method %s for customer %s: %v\n", paymentMethodID, customerID, err)
+	}
+}
+
+func (s *Server) deleteCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	ctx := r.Context()
+	uidVal := ctx.Value("user_id")
+	if uidVal == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := uidVal.(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse {card_id} from URL
+	vars := mux.Vars(r)
+	cardIDStr := vars["card_id"]
+	cardID, err := strconv.Atoi(cardIDStr)
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return
+	}
+
+	// Look up that credit_card row to ensure it belongs to this user, and get the Stripe PM ID
+	card, err := s.stores.Cards.GetForUser(cardID, userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Credit card not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Detach the PaymentMethod in Stripe
+	err = s.payments.DetachPaymentMethod(card.StripePaymentMethodID)
+	if err != nil {
+		// It’s possible this PM was already detached; you could choose to ignore certain errors,
+		// but for now return an error if Stripe says so.
+		writePaymentError(w, "Failed to detach payment method", err)
+		return
+	}
+
+	// Delete the row from credit_cards (another card may become the default)
+	err = s.stores.Cards.Delete(cardID)
+	if err == store.ErrNotFound {
+		// Just in case
+		http.Error(w, "Credit card not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Server error deleting credit card", http.StatusInternalServerError)
+		return
+	}
+	if card.IsDefault {
+		if next, err := s.stores.Cards.GetDefault(userID); err == nil {
+			if user, err := s.stores.Users.Get(userID); err == nil && user.StripeCustomerID != "" {
+				s.syncDefaultCard(user.StripeCustomerID, next.StripePaymentMethodID)
+			}
+		}
+	}
+
+	// Return 204 No Content
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// savedCard saves a card for userID directly in the store, e.g. one that has
+// expired, which the payment provider would not attach.
+func (ts *testServer) savedCard(userID int, pmID string, expMonth, expYear int) *store.Card {
+	ts.t.Helper()
+	c := &store.Card{
+		UserID:                userID,
+		StripePaymentMethodID: pmID,
+		Brand:                 "visa",
+		Last4:                 "0005",
+		ExpMonth:              expMonth,
+		ExpYear:               expYear,
+		ExpiryStatus:          store.CardStatusValid,
+	}
+	if err := ts.stores.Cards.Create(c); err != nil {
+		ts.t.Fatalf("saving card: %v", err)
+	}
+	return c
+}
+
+func TestDeleteDefaultCardPromotesNewestUnexpired(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.shopper("alice")
+	decode(t, ts.do("POST", "/users/creditcards", token, addCCRequest{PaymentMethodID: "pm_card_mastercard"}), http.StatusCreated, nil)
+	cards, err := ts.stores.Cards.ListForUser(userID)
+	if err != nil || len(cards) != 2 || !cards[0].IsDefault {
+		t.Fatalf("cards = %+v, %v; want two with a default", cards, err)
+	}
+	def, mastercard := cards[0], cards[1]
+	ts.savedCard(userID, "pm_expired", 1, 2020)
+
+	decode(t, ts.do("DELETE", fmt.Sprintf("/users/creditcards/%d", def.ID), token, nil), http.StatusNoContent, nil)
+	got, err := ts.stores.Cards.GetDefault(userID)
+	if err != nil || got.ID != mastercard.ID {
+		t.Fatalf("default = %+v, %v; want card %d, not the newer expired one", got, err, mastercard.ID)
+	}
+
+	decode(t, ts.do("DELETE", fmt.Sprintf("/users/creditcards/%d", mastercard.ID), token, nil), http.StatusNoContent, nil)
+	if got, err := ts.stores.Cards.GetDefault(userID); err != store.ErrNotFound {
+		t.Fatalf("default = %+v, %v; want none when only an expired card is left", got, err)
+	}
+}
+
+func TestCardExpiryJobRecordsEvents(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login("alice")
+	now := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	expiring := ts.savedCard(userID, "pm_expiring", 6, 2025)
+	ts.savedCard(userID, "pm_valid", 12, 2030)
+
+	if err := ts.srv.checkCardExpiry(now); err != nil {
+		t.Fatal(err)
+	}
+	// A status is only recorded when it changes
+	if err := ts.srv.checkCardExpiry(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.srv.checkCardExpiry(now.AddDate(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []store.CardExpiryEvent
+	decode(t, ts.do("GET", "/users/creditcards/expiry-events", token.Token, nil), http.StatusOK, &events)
+	if len(events) != 2 || events[0].Status != store.CardStatusExpired || events[1].Status != store.CardStatusExpiring ||
+		events[0].CardID != expiring.ID || events[1].CardID != expiring.ID {
+		t.Fatalf("events = %+v, want card %d expired, then expiring before that", events, expiring.ID)
+	}
+
+	_, other := ts.login("bob")
+	decode(t, ts.do("GET", "/users/creditcards/expiry-events", other.Token, nil), http.StatusOK, &events)
+	if len(events) != 0 {
+		t.Fatalf("another user sees %d events", len(events))
+	}
+}
+
+func TestExpiredDefaultCardPromotesNewestUnexpired(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.login("alice")
+	def := ts.savedCard(userID, "pm_old", 1, 2020)
+	ts.savedCard(userID, "pm_valid", 12, 2030)
+	newest := ts.savedCard(userID, "pm_newest", 11, 2029)
+
+	if err := ts.stores.Cards.SetExpiryStatus(def.ID, store.CardStatusExpired); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ts.stores.Cards.GetDefault(userID)
+	if err != nil || got.ID != newest.ID {
+		t.Fatalf("default = %+v, %v; want card %d", got, err, newest.ID)
+	}
+
+	// With nothing to hand over to, the expired card stays the default
+	bobID, _ := ts.login("bob")
+	only := ts.savedCard(bobID, "pm_only", 1, 2020)
+	if err := ts.stores.Cards.SetExpiryStatus(only.ID, store.CardStatusExpired); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ts.stores.Cards.GetDefault(bobID); err != nil || got.ID != only.ID {
+		t.Fatalf("default = %+v, %v; want card %d", got, err, only.ID)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// fxRateRequest is the payload of PUT /admin/fx-rates/{currency}: how much of
+// the currency one unit of the base currency buys, as a decimal string.
+type fxRateRequest struct {
+	Rate string `json:"rate"`
+}
+
+func (s *Server) listFXRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := s.stores.FXRates.List()
+	if err != nil {
+		http.Error(w, "Failed to query exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// setFXRateHandler creates or replaces the rate of a currency. Orders already
+// placed keep the rate they were priced at.
+func (s *Server) setFXRateHandler(w http.ResponseWriter, r *http.Request) {
+	currency, ok := fxRateCurrency(w, r)
+	if !ok {
+		return
+	}
+
+	var req fxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	rate, ok := money.ParseRate(req.Rate)
+	if !ok {
+		http.Error(w, `rate must be a positive decimal string, e.g. "0.7315"`, http.StatusBadRequest)
+		return
+	}
+
+	saved, err := s.stores.FXRates.Set(currency, money.FormatRate(rate))
+	if err != nil {
+		http.Error(w, "Failed to save exchange rate", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// deleteFXRateHandler stops sales in a currency at converted prices; products
+// with an explicit price in it can still be bought in it.
+func (s *Server) deleteFXRateHandler(w http.ResponseWriter, r *http.Request) {
+	currency, ok := fxRateCurrency(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.stores.FXRates.Delete(currency)
+	if err == store.ErrNotFound {
+		http.Error(w, "Exchange rate not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete exchange rate", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fxRateCurrency reads the {currency} of an /admin/fx-rates URL, writing a 400
+// unless it is a supported currency other than the base one.
+func fxRateCurrency(w http.ResponseWriter, r *http.Request) (string, bool) {
+	currency, ok := money.NormalizeCurrency(mux.Vars(r)["currency"])
+	if !ok {
+		http.Error(w, "Unsupported currency: "+currency, http.StatusBadRequest)
+		return "", false
+	}
+	if currency == money.Base {
+		http.Error(w, "The base currency has no exchange rate", http.StatusBadRequest)
+		return "", false
+	}
+	return currency, true
+}
+
+// resolveCurrency validates a requested currency ("" is the base currency) and
+// returns its exchange rate, nil for the base currency.
+func (s *Server) resolveCurrency(code string) (string, *big.Rat, *httpError) {
+	if code == "" {
+		return money.Base, nil, nil
+	}
+	currency, ok := money.NormalizeCurrency(code)
+	if !ok {
+		return "", nil, &httpError{http.StatusBadRequest, "Unsupported currency: " + code}
+	}
+	if currency == money.Base {
+		return currency, nil, nil
+	}
+
+	fx, err := s.stores.FXRates.Get(currency)
+	if err == store.ErrNotFound {
+		return "", nil, &httpError{http.StatusBadRequest, "Unsupported currency: " + code}
+	}
+	if err != nil {
+		return "", nil, &httpError{http.StatusInternalServerError, "Failed to fetch exchange rate"}
+	}
+	rate, ok := money.ParseRate(fx.Rate)
+	if !ok {
+		return "", nil, &httpError{http.StatusInternalServerError, "Invalid exchange rate for " + currency}
+	}
+	return currency, rate, nil
+}
+
+// productPrices validates the explicit currency prices of a product payload; the
+// returned message is empty when they are valid.
+func productPrices(prices map[string]int) (map[string]int, string) {
+	if prices == nil {
+		return nil, ""
+	}
+	out := make(map[string]int, len(prices))
+	for code, cents := range prices {
+		currency, ok := money.NormalizeCurrency(code)
+		switch {
+		case !ok:
+			return nil, "prices: unsupported currency " + code
+		case currency == money.Base:
+			return nil, "prices: the " + money.Base + " price is price_cents"
+		case cents <= 0:
+			return nil, "prices: " + code + " must be > 0"
+		}
+		out[currency] = cents
+	}
+	return out, ""
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (s *Server) getUserHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user_id from context
+	uidVal := r.Context().Value("user_id")
+	if uidVal == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := uidVal.(int)
+
+	// Order lines joined with their orders and products
+	history, err := s.stores.Orders.ListHistory(userID)
+	if err != nil {
+		http.Error(w, "Failed to query purchase history", http.StatusInternalServerError)
+		return
+	}
+
+	// Return as JSON array
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// Idempotency keys longer than this are rejected.
+const maxIdempotencyKeyLen = 255
+
+// idempotencyClaimTimeout is how long a claimed key waits for its request's
+// response before a retry takes it over: far longer than a checkout takes, so
+// only a request lost to a crash is run again. The rerun forwards the same
+// provider idempotency key, so it cannot charge twice (see stripeIdempotencyKey).
+const idempotencyClaimTimeout = 10 * time.Minute
+
+type idempotencyKeyContextKey struct{}
+
+// idempotencyKeyFromContext returns the Idempotency-Key of the current request, if any.
+func idempotencyKeyFromContext(r *http.Request) string {
+	key, _ := r.Context().Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// stripeIdempotencyKey derives the key forwarded to the payment provider. Client keys
+// are only unique per user, so the user ID is folded in. Returns "" when the
+// request carried no Idempotency-Key.
+func stripeIdempotencyKey(r *http.Request, userID int) string {
+	key := idempotencyKeyFromContext(r)
+	if key == "" {
+		return ""
+	}
+	return "user-" + strconv.Itoa(userID) + "-" + key
+}
+
+// recordingResponseWriter passes writes through while keeping a copy of the
+// status and body so they can be stored for replay.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotencyMiddleware makes a JWT-protected POST endpoint safe to retry. When the
+// client sends an Idempotency-Key header, the first response for that key is stored
+// per user and replayed for repeats; reusing a key with a different body yields 422.
+// Requests without the header are passed through untouched.
+func (s *Server) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(int)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(sum[:])
+
+		// Claim the key; only one request per (user, key) gets to run the handler.
+		claimed, err := s.stores.IdempotencyKeys.Claim(userID, key, requestHash, idempotencyClaimTimeout)
+		if err != nil {
+			http.Error(w, "Server error (idempotency key)", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			s.replayIdempotentResponse(w, userID, key, requestHash)
+			return
+		}
+
+		rec := &recordingResponseWriter{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), idempotencyKeyContextKey{}, key)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= 500 {
+			// Server-side failures are not final: release the key so the client can retry.
+			if err := s.stores.IdempotencyKeys.Release(userID, key); err != nil {
+				log.Printf("ERROR releasing idempotency key %q for user %d: %v\n", key, userID, err)
+			}
+			return
+		}
+		if err := s.stores.IdempotencyKeys.Save(userID, key, store.StoredResponse{
+			Status:      rec.status,
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		}); err != nil {
+			log.Printf("ERROR storing idempotent response for key %q user %d: %v\n", key, userID, err)
+		}
+	})
+}
+
+// replayIdempotentResponse answers a repeated request from the stored response.
+func (s *Server) replayIdempotentResponse(w http.ResponseWriter, userID int, key, requestHash string) {
+	rec, err := s.stores.IdempotencyKeys.Get(userID, key)
+	if err != nil {
+		if err == store.ErrNotFound {
+			// The original request failed and released the key in the meantime.
+			http.Error(w, "A request with this Idempotency-Key failed; retry it", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Server error (idempotency key)", http.StatusInternalServerError)
+		return
+	}
+
+	if rec.RequestHash != requestHash {
+		http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+		return
+	}
+	if rec.Response == nil {
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	if rec.Response.ContentType != "" {
+		w.Header().Set("Content-Type", rec.Response.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Response.Status)
+	w.Write(rec.Response.Body)
+}
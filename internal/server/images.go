@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/imaging"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+const (
+	// maxImageBytes bounds the size of an uploaded image file.
+	maxImageBytes = 10 << 20
+	// thumbnailSize is the longest side of generated thumbnails, in pixels.
+	thumbnailSize = 320
+	// maxConcurrentImageDecodes bounds the memory uploads take: each decoded
+	// image holds up to imaging.MaxPixels pixels.
+	maxConcurrentImageDecodes = 2
+)
+
+// reorderImagesRequest is the payload of PUT /admin/products/{id}/images: every
+// image ID of the product, in the new display order.
+type reorderImagesRequest struct {
+	ImageIDs []int `json:"image_ids"`
+}
+
+// uploadProductImageHandler accepts a multipart/form-data upload with the file
+// in the "image" field (JPEG, PNG or GIF) and "primary=true" to make it the
+// product's primary image. It stores the original and a thumbnail.
+func (s *Server) uploadProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	// Leave room for the multipart headers and the other fields
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+	if err := r.ParseMultipartForm(maxImageBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image must be at most "+strconv.Itoa(maxImageBytes>>20)+" MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "image file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxImageBytes {
+		http.Error(w, "Image must be at most "+strconv.Itoa(maxImageBytes>>20)+" MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	primary := false
+	if v := r.FormValue("primary"); v != "" {
+		primary, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "primary must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Decoded images are large: wait for a slot, unless the client gives up first
+	select {
+	case s.imageSlots <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	// The declared content type is ignored: the format is sniffed from the data
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		<-s.imageSlots
+		if errors.Is(err, imaging.ErrTooLarge) {
+			http.Error(w, "Image dimensions are too large", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "image must be a JPEG, PNG or GIF file", http.StatusUnsupportedMediaType)
+		return
+	}
+	thumb, thumbType, err := imaging.Encode(imaging.Thumbnail(img, thumbnailSize), contentType)
+	<-s.imageSlots
+	if err != nil {
+		http.Error(w, "Failed to create thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := s.stores.Products.Get(prodID); err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query product", http.StatusInternalServerError)
+		return
+	}
+
+	name, err := randomToken(16)
+	if err != nil {
+		http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		return
+	}
+	dir := "products/" + strconv.Itoa(prodID) + "/"
+	image := store.ProductImage{
+		ProductID:    prodID,
+		Key:          dir + name + imaging.Extension(contentType),
+		ThumbnailKey: dir + name + "_thumb" + imaging.Extension(thumbType),
+		ContentType:  contentType,
+		Width:        img.Bounds().Dx(),
+		Height:       img.Bounds().Dy(),
+	}
+	if err := s.media.Put(image.Key, data, contentType); err != nil {
+		log.Printf("ERROR storing image %s: %v\n", image.Key, err)
+		http.Error(w, "Failed to store image", http.StatusBadGateway)
+		return
+	}
+	if err := s.media.Put(image.ThumbnailKey, thumb, thumbType); err != nil {
+		log.Printf("ERROR storing image %s: %v\n", image.ThumbnailKey, err)
+		s.deleteImageFiles(image)
+		http.Error(w, "Failed to store image", http.StatusBadGateway)
+		return
+	}
+
+	err = s.stores.Images.Create(&image, primary)
+	if err != nil {
+		s.deleteImageFiles(image)
+	}
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to record image", http.StatusInternalServerError)
+		return
+	}
+	s.setImageURLs(&image)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+// reorderProductImagesHandler sets the display order of a product's images.
+func (s *Server) reorderProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req reorderImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	images, err := s.stores.Images.Reorder(prodID, req.ImageIDs)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrImageOrder {
+		http.Error(w, "image_ids must list each of the product's images once", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reorder images", http.StatusInternalServerError)
+		return
+	}
+	for i := range images {
+		s.setImageURLs(&images[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+// setPrimaryProductImageHandler makes an image its product's primary one.
+func (s *Server) setPrimaryProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	prodID, imageID, ok := productImageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.stores.Images.SetPrimary(prodID, imageID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to set primary image", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteProductImageHandler removes an image and its files.
+func (s *Server) deleteProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	prodID, imageID, ok := productImageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := s.stores.Images.Delete(prodID, imageID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+		return
+	}
+	s.deleteImageFiles(*image)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// productImageIDs parses {id} and {image_id}, answering 400 if either is invalid.
+func productImageIDs(w http.ResponseWriter, r *http.Request) (prodID, imageID int, ok bool) {
+	vars := mux.Vars(r)
+	prodID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	imageID, err = strconv.Atoi(vars["image_id"])
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return prodID, imageID, true
+}
+
+// deleteImageFiles removes an image's files from storage. Failures only leave
+// orphaned files behind, so they are logged rather than reported.
+func (s *Server) deleteImageFiles(image store.ProductImage) {
+	for _, key := range []string{image.Key, image.ThumbnailKey} {
+		if err := s.media.Delete(key); err != nil {
+			log.Printf("ERROR deleting image %s: %v\n", key, err)
+		}
+	}
+}
+
+// setImageURLs fills in the download URLs of an image.
+func (s *Server) setImageURLs(image *store.ProductImage) {
+	image.URL = s.media.URL(image.Key)
+	image.ThumbnailURL = s.media.URL(image.ThumbnailKey)
+}
+
+// setProductImageURLs fills in the download URLs of a product's images.
+func (s *Server) setProductImageURLs(p *store.Product) {
+	for i := range p.Images {
+		s.setImageURLs(&p.Images[i])
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// insufficientStockResponse is the 409 body returned by checkout.
+type insufficientStockResponse struct {
+	Error string                 `json:"error"`
+	Items []store.StockShortfall `json:"items"`
+}
+
+// writeInsufficientStock answers a checkout that cannot be fulfilled.
+func writeInsufficientStock(w http.ResponseWriter, shortfalls []store.StockShortfall) {
+	sort.Slice(shortfalls, func(i, j int) bool {
+		if shortfalls[i].ProductID != shortfalls[j].ProductID {
+			return shortfalls[i].ProductID < shortfalls[j].ProductID
+		}
+		return shortfalls[i].VariantID < shortfalls[j].VariantID
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(insufficientStockResponse{
+		Error: "insufficient stock",
+		Items: shortfalls,
+	})
+}
+
+// stockAdjustmentRequest is the payload for POST /admin/products/{id}/stock.
+type stockAdjustmentRequest struct {
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"`
+	Unlimited *bool  `json:"unlimited_stock,omitempty"`
+}
+
+// adjustStockHandler lets admins add or remove stock (delta) with a reason, and
+// optionally toggle unlimited stock.
+func (s *Server) adjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	vars := mux.Vars(r)
+	prodID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	adj, ok := decodeStockAdjustment(w, r)
+	if !ok {
+		return
+	}
+	level, err := s.stores.Products.AdjustStock(prodID, adj)
+	writeStockLevel(w, level, err, "Product not found")
+}
+
+// decodeStockAdjustment reads a stockAdjustmentRequest made by the calling
+// admin, answering 400 if it is invalid.
+func decodeStockAdjustment(w http.ResponseWriter, r *http.Request) (store.StockAdjustment, bool) {
+	var req stockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return store.StockAdjustment{}, false
+	}
+	defer r.Body.Close()
+
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return store.StockAdjustment{}, false
+	}
+	if req.Delta == 0 && req.Unlimited == nil {
+		http.Error(w, "delta or unlimited_stock is required", http.StatusBadRequest)
+		return store.StockAdjustment{}, false
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	return store.StockAdjustment{
+		Delta:     req.Delta,
+		Reason:    req.Reason,
+		AdminID:   adminID,
+		Unlimited: req.Unlimited,
+	}, true
+}
+
+// writeStockLevel answers a stock adjustment with the new level, or its error;
+// notFound is the message for store.ErrNotFound.
+func writeStockLevel(w http.ResponseWriter, level *store.StockLevel, err error, notFound string) {
+	if err != nil {
+		var negErr *store.NegativeStockError
+		switch {
+		case err == store.ErrNotFound:
+			http.Error(w, notFound, http.StatusNotFound)
+		case errors.As(err, &negErr):
+			http.Error(w, "Adjustment would make stock negative (current: "+strconv.Itoa(negErr.Current)+")", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to update stock", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(level)
+}
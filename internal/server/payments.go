@@ -0,0 +1,34 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+)
+
+// writePaymentError reports a provider failure: 502 when the provider could not
+// be reached, 400 when it rejected the request.
+func writePaymentError(w http.ResponseWriter, prefix string, err error) {
+	if errors.Is(err, payment.ErrUnavailable) {
+		http.Error(w, prefix+": payment provider unavailable, try again", http.StatusBadGateway)
+		return
+	}
+	http.Error(w, prefix+": "+err.Error(), http.StatusBadRequest)
+}
+
+// isPaymentError reports whether err is the provider rejecting a request.
+func isPaymentError(err error) bool {
+	var pe *payment.Error
+	return errors.As(err, &pe)
+}
+
+// httpError is a client-facing failure raised from inside a store callback.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// priceScheduleRequest is the payload for scheduling a price. An omitted
+// starts_at starts it now; an omitted ends_at runs it until it is cancelled.
+type priceScheduleRequest struct {
+	SalePriceCents int        `json:"sale_price_cents"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
+
+// input validates the request; the returned message is empty when it is valid.
+func (req priceScheduleRequest) input(now time.Time) (store.PriceScheduleInput, string) {
+	in := store.PriceScheduleInput{
+		SalePriceCents: req.SalePriceCents,
+		StartsAt:       now,
+		EndsAt:         req.EndsAt,
+	}
+	if req.StartsAt != nil {
+		in.StartsAt = *req.StartsAt
+	}
+
+	switch {
+	case in.SalePriceCents <= 0:
+		return in, "sale_price_cents must be > 0"
+	case in.EndsAt != nil && !in.EndsAt.After(in.StartsAt):
+		return in, "ends_at must be after starts_at"
+	case in.EndsAt != nil && !in.EndsAt.After(now):
+		return in, "ends_at must be in the future"
+	}
+	return in, ""
+}
+
+// listPriceSchedulesHandler returns a product's price schedules, including
+// ended and cancelled ones, by start time.
+func (s *Server) listPriceSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	schedules, err := s.stores.PriceSchedules.List(prodID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to query price schedules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// createPriceScheduleHandler schedules a sale price for a product.
+func (s *Server) createPriceScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req priceScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input(time.Now())
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	in.AdminID, _ = r.Context().Value("user_id").(int)
+
+	schedule, err := s.stores.PriceSchedules.Create(prodID, in)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrScheduleOverlap {
+		http.Error(w, "The schedule overlaps another price schedule of the product", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create price schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// cancelPriceScheduleHandler cancels a price schedule that has not ended; a
+// running one stops immediately. The schedule is kept, as cancelled.
+func (s *Server) cancelPriceScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prodID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	scheduleID, err := strconv.Atoi(vars["schedule_id"])
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := s.stores.PriceSchedules.Cancel(prodID, scheduleID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Price schedule not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrScheduleEnded {
+		http.Error(w, "Price schedule has already ended or been cancelled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to cancel price schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// Page sizes of GET /products.
+const (
+	defaultProductLimit = 20
+	maxProductLimit     = 100
+)
+
+// productListResponse is one page of GET /products. NextCursor is omitted on the
+// last page.
+type productListResponse struct {
+	Products   []store.Product `json:"products"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Total      int             `json:"total"`
+}
+
+// productCursor is the opaque next_cursor of GET /products. It remembers the
+// sort it was issued for, so it is not reused with another one.
+type productCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// listProductsHandler lists the catalog a page at a time, priced in the optional
+// ?currency= (default the base currency), sorted and filtered by the query.
+func (s *Server) listProductsHandler(w http.ResponseWriter, r *http.Request) {
+	q, msg := productQuery(r.URL.Query())
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	s.writeProductPage(w, r, q)
+}
+
+// writeProductPage answers a product listing with the page q selects.
+func (s *Server) writeProductPage(w http.ResponseWriter, r *http.Request, q store.ProductQuery) {
+	currency, rate, herr := s.resolveCurrency(r.URL.Query().Get("currency"))
+	if herr != nil {
+		http.Error(w, herr.msg, herr.status)
+		return
+	}
+	q.Currency, q.Rate = currency, rate
+
+	page, err := s.stores.Products.List(q)
+	if err != nil {
+		http.Error(w, "Failed to query products", http.StatusInternalServerError)
+		return
+	}
+	for i := range page.Products {
+		priceProduct(&page.Products[i], currency, rate)
+		s.setProductImageURLs(&page.Products[i])
+	}
+
+	resp := productListResponse{Products: page.Products, Total: page.Total}
+	if page.Next != nil {
+		raw, _ := json.Marshal(productCursor{Sort: q.Sort, Desc: q.Desc, Value: page.Next.Value, ID: page.Next.ID})
+		resp.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	// Return as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// priceProduct prices a product and its variants in currency (see
+// store.Product.PriceIn and VariantPriceIn), keeping its regular price in
+// OriginalPriceCents.
+func priceProduct(p *store.Product, currency string, rate *big.Rat) {
+	// Variants first: their prices derive from the product's base price
+	for i := range p.Variants {
+		p.Variants[i].PriceCents = p.VariantPriceIn(&p.Variants[i], currency, rate)
+	}
+	p.OriginalPriceCents = p.RegularPriceIn(currency, rate)
+	p.PriceCents = p.PriceIn(currency, rate)
+	p.Currency = currency
+}
+
+// productQuery parses the paging, sorting and filters of GET /products; the
+// returned message is empty when they are valid.
+func productQuery(params url.Values) (store.ProductQuery, string) {
+	q := store.ProductQuery{
+		Limit:        defaultProductLimit,
+		Sort:         store.ProductSortID,
+		CategorySlug: params.Get("category"),
+		Tag:          normalizeTag(params.Get("tag")),
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxProductLimit {
+			return q, "limit must be between 1 and " + strconv.Itoa(maxProductLimit)
+		}
+		q.Limit = limit
+	}
+
+	if v := params.Get("sort"); v != "" {
+		switch v {
+		case store.ProductSortID, store.ProductSortPrice, store.ProductSortName, store.ProductSortCreatedAt:
+			q.Sort = v
+		default:
+			return q, "sort must be 'id', 'price', 'name' or 'created_at'"
+		}
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, "order must be 'asc' or 'desc'"
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{{"min_price", &q.MinPriceCents}, {"max_price", &q.MaxPriceCents}} {
+		v := params.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		cents, err := strconv.Atoi(v)
+		if err != nil || cents < 0 {
+			return q, bound.name + " must be a number of cents >= 0"
+		}
+		*bound.dst = &cents
+	}
+	if q.MinPriceCents != nil && q.MaxPriceCents != nil && *q.MinPriceCents > *q.MaxPriceCents {
+		return q, "min_price must be <= max_price"
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		var c productCursor
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || json.Unmarshal(raw, &c) != nil {
+			return q, "Invalid cursor"
+		}
+		if c.Sort != q.Sort || c.Desc != q.Desc {
+			return q, "cursor was issued for another sort or order"
+		}
+		q.After = &store.ProductCursor{Value: c.Value, ID: c.ID}
+	}
+	return q, ""
+}
+
+func (s *Server) createProductHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode JSON body into a Product struct
+	var payload struct {
+		Name           string         `json:"name"`
+		Description    string         `json:"description"`
+		PriceCents     int            `json:"price_cents"`
+		StockQuantity  int            `json:"stock_quantity"`
+		UnlimitedStock bool           `json:"unlimited_stock"`
+		TaxCategory    string         `json:"tax_category"`
+		Prices         map[string]int `json:"prices"`
+		CategoryIDs    []int          `json:"category_ids"`
+		Tags           []string       `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Basic validation
+	if payload.Name == "" || payload.PriceCents <= 0 {
+		http.Error(w, "name and price_cents are required (price_cents > 0)", http.StatusBadRequest)
+		return
+	}
+	if payload.StockQuantity < 0 {
+		http.Error(w, "stock_quantity must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if payload.TaxCategory == "" {
+		payload.TaxCategory = tax.CategoryTaxable
+	}
+	if !tax.ValidCategory(payload.TaxCategory) {
+		http.Error(w, "tax_category must be 'taxable', 'exempt' or 'zero_rated'", http.StatusBadRequest)
+		return
+	}
+	prices, msg := productPrices(payload.Prices)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tags, msg := productTags(payload.Tags)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Insert into products
+	adminID, _ := r.Context().Value("user_id").(int)
+	newProduct, err := s.stores.Products.Create(store.ProductInput{
+		Name:           payload.Name,
+		Description:    payload.Description,
+		PriceCents:     payload.PriceCents,
+		StockQuantity:  payload.StockQuantity,
+		UnlimitedStock: payload.UnlimitedStock,
+		TaxCategory:    payload.TaxCategory,
+		Prices:         prices,
+		CategoryIDs:    payload.CategoryIDs,
+		Tags:           tags,
+		AdminID:        adminID,
+	})
+	var unknown store.CategoryNotFoundError
+	if errors.As(err, &unknown) {
+		http.Error(w, unknown.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create product", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created product (including new ID)
+	priceProduct(newProduct, money.Base, nil)
+	s.setProductImageURLs(newProduct)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newProduct)
+}
+
+func (s *Server) updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+	prodID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	// Decode JSON payload (same fields as create); an omitted tax_category,
+	// prices, category_ids or tags is kept
+	var payload struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		PriceCents  int            `json:"price_cents"`
+		TaxCategory string         `json:"tax_category"`
+		Prices      map[string]int `json:"prices"`
+		CategoryIDs []int          `json:"category_ids"`
+		Tags        []string       `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Basic validation
+	if payload.Name == "" || payload.PriceCents <= 0 {
+		http.Error(w, "name and price_cents are required (price_cents > 0)", http.StatusBadRequest)
+		return
+	}
+	if payload.TaxCategory != "" && !tax.ValidCategory(payload.TaxCategory) {
+		http.Error(w, "tax_category must be 'taxable', 'exempt' or 'zero_rated'", http.StatusBadRequest)
+		return
+	}
+	prices, msg := productPrices(payload.Prices)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tags, msg := productTags(payload.Tags)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Stock is changed through /admin/products/{id}/stock
+	adminID, _ := r.Context().Value("user_id").(int)
+	updated, err := s.stores.Products.Update(prodID, store.ProductInput{
+		Name:        payload.Name,
+		Description: payload.Description,
+		PriceCents:  payload.PriceCents,
+		TaxCategory: payload.TaxCategory,
+		Prices:      prices,
+		CategoryIDs: payload.CategoryIDs,
+		Tags:        tags,
+		AdminID:     adminID,
+	})
+	var unknown store.CategoryNotFoundError
+	if errors.As(err, &unknown) {
+		http.Error(w, unknown.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		return
+	}
+
+	// Return 200 OK with the updated product
+	priceProduct(updated, money.Base, nil)
+	s.setProductImageURLs(updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// deleteProductHandler archives a product: it leaves the catalog and can no
+// longer be bought, but is kept, with its images, for past orders and a restore.
+func (s *Server) deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+	prodID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.stores.Products.Archive(prodID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to archive product", http.StatusInternalServerError)
+		return
+	}
+
+	// Return 204 No Content
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreProductHandler puts an archived product back in the catalog.
+func (s *Server) restoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	product, err := s.stores.Products.Restore(prodID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore product", http.StatusInternalServerError)
+		return
+	}
+
+	priceProduct(product, money.Base, nil)
+	s.setProductImageURLs(product)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// productPriceHistoryHandler returns a product's price history, newest first.
+func (s *Server) productPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	history, err := s.stores.Products.PriceHistory(prodID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to query price history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// listArchivedProductsHandler lists archived products, with the paging,
+// sorting and filters of GET /products.
+func (s *Server) listArchivedProductsHandler(w http.ResponseWriter, r *http.Request) {
+	q, msg := productQuery(r.URL.Query())
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q.Archived = true
+	s.writeProductPage(w, r, q)
+}
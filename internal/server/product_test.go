@@ -0,0 +1,292 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/storage"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/store/memstore"
+)
+
+func TestListProductsPages(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	for i, price := range []int{300, 100, 200} {
+		ts.product(admin, fmt.Sprintf("Product %d", i), price, 5)
+	}
+
+	var page productListResponse
+	decode(t, ts.do("GET", "/products?sort=price&limit=2", admin, nil), http.StatusOK, &page)
+	if page.Total != 3 || len(page.Products) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page = %+v, want 2 of 3 products and a cursor", page)
+	}
+	if page.Products[0].PriceCents != 100 || page.Products[1].PriceCents != 200 {
+		t.Fatalf("first page prices = %d, %d; want 100, 200", page.Products[0].PriceCents, page.Products[1].PriceCents)
+	}
+
+	var next productListResponse
+	decode(t, ts.do("GET", "/products?sort=price&limit=2&cursor="+page.NextCursor, admin, nil), http.StatusOK, &next)
+	if len(next.Products) != 1 || next.Products[0].PriceCents != 300 || next.NextCursor != "" {
+		t.Fatalf("last page = %+v, want the 300 product and no cursor", next)
+	}
+
+	// A cursor only continues the sort it was issued for
+	decode(t, ts.do("GET", "/products?sort=name&limit=2&cursor="+page.NextCursor, admin, nil), http.StatusBadRequest, nil)
+}
+
+func TestArchivedProductsAreHidden(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Mug", 1000, 5)
+
+	decode(t, ts.do("DELETE", fmt.Sprintf("/admin/products/%d", p.ID), admin, nil), http.StatusNoContent, nil)
+
+	var page productListResponse
+	decode(t, ts.do("GET", "/products", admin, nil), http.StatusOK, &page)
+	if page.Total != 0 {
+		t.Fatalf("listed %d products after archiving, want 0", page.Total)
+	}
+
+	decode(t, ts.do("POST", fmt.Sprintf("/admin/products/%d/restore", p.ID), admin, nil), http.StatusOK, nil)
+	decode(t, ts.do("GET", "/products", admin, nil), http.StatusOK, &page)
+	if page.Total != 1 {
+		t.Fatalf("listed %d products after restoring, want 1", page.Total)
+	}
+}
+
+func TestCreateProductValidates(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+
+	decode(t, ts.do("POST", "/admin/products", admin, map[string]any{"name": "Mug"}), http.StatusBadRequest, nil)
+	decode(t, ts.do("POST", "/admin/products", admin, map[string]any{"name": "Mug", "price_cents": 100, "stock_quantity": -1}), http.StatusBadRequest, nil)
+	decode(t, ts.do("POST", "/admin/products", admin, map[string]any{"name": "Mug", "price_cents": 100, "category_ids": []int{42}}), http.StatusBadRequest, nil)
+}
+
+func TestPricePrecedence(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	var p store.Product
+	body := map[string]any{"name": "Shirt", "price_cents": 2000, "stock_quantity": 5, "prices": map[string]int{"usd": 1500}}
+	decode(t, ts.do("POST", "/admin/products", admin, body), http.StatusCreated, &p)
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/options", p.ID), admin,
+		optionsRequest{Options: []store.ProductOption{{Name: "size", Values: []string{"m", "xl"}}}}), http.StatusOK, nil)
+	xl := 3000
+	for _, v := range []variantRequest{
+		{SKU: "SHIRT-M", Options: map[string]string{"size": "m"}, StockQuantity: 5},
+		{SKU: "SHIRT-XL", Options: map[string]string{"size": "xl"}, PriceOverrideCents: &xl, StockQuantity: 5},
+	} {
+		decode(t, ts.do("POST", fmt.Sprintf("/admin/products/%d/variants", p.ID), admin, v), http.StatusCreated, nil)
+	}
+	// Explicit prices win over the rate
+	for currency, rate := range map[string]string{"usd": "0.9", "eur": "0.5"} {
+		decode(t, ts.do("PUT", "/admin/fx-rates/"+currency, admin, fxRateRequest{Rate: rate}), http.StatusOK, nil)
+	}
+
+	// prices returns the product's price and original price, then its variants', in currency
+	prices := func(currency string) []int {
+		t.Helper()
+		var page productListResponse
+		decode(t, ts.do("GET", "/products?currency="+currency, admin, nil), http.StatusOK, &page)
+		if len(page.Products) != 1 || len(page.Products[0].Variants) != 2 {
+			t.Fatalf("products = %+v, want the shirt with 2 variants", page.Products)
+		}
+		got := page.Products[0]
+		return []int{got.PriceCents, got.OriginalPriceCents, got.Variants[0].PriceCents, got.Variants[1].PriceCents}
+	}
+	for currency, want := range map[string][]int{
+		"cad": {2000, 2000, 2000, 3000},
+		"usd": {1500, 1500, 1500, 2250}, // the override keeps its ratio to the explicit price
+		"eur": {1000, 1000, 1000, 1500},
+	} {
+		if got := prices(currency); !slices.Equal(got, want) {
+			t.Errorf("%s prices = %v, want %v", currency, got, want)
+		}
+	}
+
+	// A sale at 25% off discounts the explicit price and every variant alike
+	decode(t, ts.do("POST", fmt.Sprintf("/admin/products/%d/price-schedules", p.ID), admin, priceScheduleRequest{SalePriceCents: 1500}), http.StatusCreated, nil)
+	for currency, want := range map[string][]int{
+		"cad": {1500, 2000, 1500, 2250},
+		"usd": {1125, 1500, 1125, 1688},
+		"eur": {750, 1000, 750, 1125},
+	} {
+		if got := prices(currency); !slices.Equal(got, want) {
+			t.Errorf("%s sale prices = %v, want %v", currency, got, want)
+		}
+	}
+}
+
+// category creates a category as admin and returns it.
+func (ts *testServer) category(admin, name string, parentID *int) store.Category {
+	ts.t.Helper()
+	var c store.Category
+	decode(ts.t, ts.do("POST", "/admin/categories", admin, categoryRequest{Name: name, ParentID: parentID}), http.StatusCreated, &c)
+	return c
+}
+
+// listedNames returns the names of the products GET path lists.
+func (ts *testServer) listedNames(token, path string) []string {
+	ts.t.Helper()
+	var page productListResponse
+	decode(ts.t, ts.do("GET", path, token, nil), http.StatusOK, &page)
+	names := make([]string, 0, len(page.Products))
+	for _, p := range page.Products {
+		names = append(names, p.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestCategoryCannotMoveUnderItself(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	electronics := ts.category(admin, "Electronics", nil)
+	phones := ts.category(admin, "Phones", &electronics.ID)
+	android := ts.category(admin, "Android Phones", &phones.ID)
+	if android.Slug != "android-phones" {
+		t.Fatalf("slug = %q, want android-phones", android.Slug)
+	}
+
+	path := fmt.Sprintf("/admin/categories/%d", electronics.ID)
+	for _, parent := range []int{electronics.ID, phones.ID, android.ID} {
+		decode(t, ts.do("PUT", path, admin, categoryRequest{Name: "Electronics", ParentID: &parent}), http.StatusConflict, nil)
+	}
+	unknown := 999
+	decode(t, ts.do("PUT", path, admin, categoryRequest{Name: "Electronics", ParentID: &unknown}), http.StatusBadRequest, nil)
+	decode(t, ts.do("DELETE", path, admin, nil), http.StatusConflict, nil)
+
+	// Moving the leaf up and the old root under it is fine
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/categories/%d", android.ID), admin, categoryRequest{Name: "Android Phones"}), http.StatusOK, nil)
+	decode(t, ts.do("PUT", path, admin, categoryRequest{Name: "Electronics", ParentID: &android.ID}), http.StatusOK, nil)
+
+	var tree []categoryNode
+	decode(t, ts.do("GET", "/categories", admin, nil), http.StatusOK, &tree)
+	if len(tree) != 1 || tree[0].ID != android.ID || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Fatalf("tree = %+v, want android > electronics > phones", tree)
+	}
+}
+
+func TestCategoryAndTagFilters(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	electronics := ts.category(admin, "Electronics", nil)
+	phones := ts.category(admin, "Phones", &electronics.ID)
+	android := ts.category(admin, "Android", &phones.ID)
+	books := ts.category(admin, "Books", nil)
+	for _, p := range []map[string]any{
+		{"name": "Radio", "category_ids": []int{electronics.ID}, "tags": []string{"Sale"}},
+		{"name": "Pixel", "category_ids": []int{android.ID}, "tags": []string{"sale", " New  Arrival "}},
+		{"name": "Novel", "category_ids": []int{books.ID, phones.ID}, "tags": []string{"new arrival"}},
+		{"name": "Lamp"},
+	} {
+		p["price_cents"], p["stock_quantity"] = 1000, 5
+		decode(t, ts.do("POST", "/admin/products", admin, p), http.StatusCreated, nil)
+	}
+
+	for path, want := range map[string][]string{
+		// A category lists the products of its whole subtree
+		"/categories/electronics/products": {"Novel", "Pixel", "Radio"},
+		"/categories/phones/products":      {"Novel", "Pixel"},
+		"/categories/android/products":     {"Pixel"},
+		"/products?category=books":         {"Novel"},
+		// Tags are matched normalized
+		"/products?tag=SALE":                               {"Pixel", "Radio"},
+		"/products?tag=new%20%20arrival":                   {"Novel", "Pixel"},
+		"/products?tag=clearance":                          {},
+		"/categories/electronics/products?tag=new+arrival": {"Novel", "Pixel"},
+		"/categories/books/products?tag=sale":              {},
+	} {
+		if got := ts.listedNames(admin, path); !slices.Equal(got, want) {
+			t.Errorf("GET %s = %v, want %v", path, got, want)
+		}
+	}
+	decode(t, ts.do("GET", "/categories/garden/products", admin, nil), http.StatusNotFound, nil)
+
+	var tags []store.Tag
+	decode(t, ts.do("GET", "/tags", admin, nil), http.StatusOK, &tags)
+	counts := map[string]int{}
+	for _, tag := range tags {
+		counts[tag.Name] = tag.ProductCount
+	}
+	if len(counts) != 2 || counts["sale"] != 2 || counts["new arrival"] != 2 {
+		t.Fatalf("tags = %+v, want sale and new arrival on 2 products each", tags)
+	}
+}
+
+func TestVariantPriceOverrideHistory(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	p := ts.product(admin, "Shirt", 2000, 5)
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/options", p.ID), admin,
+		optionsRequest{Options: []store.ProductOption{{Name: "size", Values: []string{"m", "xl"}}}}), http.StatusOK, nil)
+
+	var m, xl store.ProductVariant
+	decode(t, ts.do("POST", fmt.Sprintf("/admin/products/%d/variants", p.ID), admin,
+		variantRequest{SKU: "SHIRT-M", Options: map[string]string{"size": "m"}}), http.StatusCreated, &m)
+	override := 3000
+	xlReq := variantRequest{SKU: "SHIRT-XL", Options: map[string]string{"size": "xl"}, PriceOverrideCents: &override}
+	decode(t, ts.do("POST", fmt.Sprintf("/admin/products/%d/variants", p.ID), admin, xlReq), http.StatusCreated, &xl)
+	// Same override: nothing to record; then a new one, then none
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/variants/%d", p.ID, xl.ID), admin, xlReq), http.StatusOK, nil)
+	override = 3200
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/variants/%d", p.ID, xl.ID), admin, xlReq), http.StatusOK, nil)
+	xlReq.PriceOverrideCents = nil
+	decode(t, ts.do("PUT", fmt.Sprintf("/admin/products/%d/variants/%d", p.ID, xl.ID), admin, xlReq), http.StatusOK, nil)
+	decode(t, ts.do("DELETE", fmt.Sprintf("/admin/products/%d/variants/%d", p.ID, xl.ID), admin, nil), http.StatusNoContent, nil)
+
+	var history []store.PriceChange
+	decode(t, ts.do("GET", fmt.Sprintf("/admin/products/%d/price-history", p.ID), admin, nil), http.StatusOK, &history)
+	var overrides []int
+	for _, c := range history {
+		if c.VariantSKU == "" {
+			continue
+		}
+		if c.VariantSKU != "SHIRT-XL" || c.VariantID != nil || c.AdminUserID == nil {
+			t.Fatalf("entry = %+v, want one of the deleted SHIRT-XL by an admin", c)
+		}
+		price := 0
+		if c.PriceOverrideCents != nil {
+			price = *c.PriceOverrideCents
+		}
+		overrides = append(overrides, price)
+	}
+	if want := []int{0, 3200, 3000}; !slices.Equal(overrides, want) {
+		t.Fatalf("overrides, newest first = %v, want %v (0: cleared)", overrides, want)
+	}
+	if len(history) != len(overrides)+1 {
+		t.Fatalf("history has %d product entries, want the one from its creation", len(history)-len(overrides))
+	}
+}
+
+func TestMediaServedAtBaseURLPath(t *testing.T) {
+	for _, tc := range []struct {
+		baseURL, path string
+		want          int
+	}{
+		{"/files", "/files/products/1/a.png", http.StatusOK},
+		{"/files", "/media/products/1/a.png", http.StatusNotFound},
+		// Another server serves an absolute base URL
+		{"https://cdn.example.com/media", "/media/products/1/a.png", http.StatusNotFound},
+	} {
+		media, err := storage.NewLocal(t.TempDir(), tc.baseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := media.Put("products/1/a.png", []byte("png"), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		routes := New(memstore.New().Stores(), payment.NewFake(), media, Config{}).Routes()
+
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("GET %s with base URL %s = %d, want %d", tc.path, tc.baseURL, rec.Code, tc.want)
+		}
+	}
+}
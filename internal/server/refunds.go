@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// refundLineRequest asks to refund quantity units of one order line.
+type refundLineRequest struct {
+	OrderLineID int `json:"order_line_id"`
+	Quantity    int `json:"quantity"`
+}
+
+// createRefundRequest is the payload for POST /admin/orders/{id}/refunds. Send either
+// amount_cents (partial amount), lines (per-line refund) or neither (refund the rest).
+type createRefundRequest struct {
+	AmountCents int64               `json:"amount_cents"`
+	Lines       []refundLineRequest `json:"lines"`
+	Reason      string              `json:"reason"`
+	Restock     bool                `json:"restock"`
+}
+
+// createRefundHandler refunds all or part of a paid order through the payment
+// provider, records the refund and optionally puts the refunded items back in stock.
+func (s *Server) createRefundHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req createRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.AmountCents < 0 {
+		http.Error(w, "amount_cents must be > 0", http.StatusBadRequest)
+		return
+	}
+	if req.AmountCents > 0 && len(req.Lines) > 0 {
+		http.Error(w, "send either amount_cents or lines, not both", http.StatusBadRequest)
+		return
+	}
+	if req.AmountCents > 0 && req.Restock {
+		http.Error(w, "restock requires a full or per-line refund", http.StatusBadRequest)
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	var issued *payment.RefundInfo
+	refund, err := s.stores.Orders.Refund(orderID, adminID, func(o *store.RefundableOrder) (*store.Refund, error) {
+		refundable := o.Status == store.OrderStatusPaid || o.Status == store.OrderStatusPartiallyRefunded ||
+			o.Status == store.OrderStatusNeedsReview
+		if !refundable || o.StripePaymentIntentID == "" {
+			return nil, &httpError{http.StatusConflict, "Order is not refundable (status: " + o.Status + ")"}
+		}
+		if req.Restock && o.Status == store.OrderStatusNeedsReview {
+			return nil, &httpError{http.StatusConflict, "Order holds no stock to restock"}
+		}
+		remaining := o.TotalCents - o.RefundedCents
+
+		// Work out what is being refunded
+		var (
+			amount      int64
+			refundLines []store.RefundLine
+		)
+		switch {
+		case req.AmountCents > 0:
+			amount = req.AmountCents
+		case len(req.Lines) > 0:
+			requested := map[int]int{}
+			for _, rl := range req.Lines {
+				if rl.Quantity <= 0 {
+					return nil, &httpError{http.StatusBadRequest, "Quantity must be > 0"}
+				}
+				requested[rl.OrderLineID] += rl.Quantity
+			}
+			for _, id := range sortedKeys(requested) {
+				qty := requested[id]
+				line, ok := o.Lines[id]
+				if !ok {
+					return nil, &httpError{http.StatusBadRequest, "Order line not found: " + strconv.Itoa(id)}
+				}
+				if qty > line.Quantity-line.RefundedQty {
+					return nil, &httpError{http.StatusConflict, "Cannot refund more than the unrefunded quantity of line " + strconv.Itoa(id)}
+				}
+				amount += line.AmountFor(qty)
+				refundLines = append(refundLines, store.RefundLine{OrderLineID: id, Quantity: qty})
+			}
+		default:
+			// Full refund of whatever is left; every unrefunded unit is covered.
+			amount = remaining
+			for _, id := range sortedKeys(o.Lines) {
+				line := o.Lines[id]
+				if qty := line.Quantity - line.RefundedQty; qty > 0 {
+					refundLines = append(refundLines, store.RefundLine{OrderLineID: id, Quantity: qty})
+				}
+			}
+		}
+		if amount <= 0 || amount > remaining {
+			return nil, &httpError{http.StatusConflict, "Refund amount must be between 1 and " + strconv.FormatInt(remaining, 10) + " cents"}
+		}
+
+		var err error
+		issued, err = s.payments.CreateRefund(o.StripePaymentIntentID, amount)
+		if err != nil {
+			return nil, err
+		}
+
+		refund := &store.Refund{
+			StripeRefundID: issued.ID,
+			AmountCents:    amount,
+			Status:         issued.Status,
+			Reason:         req.Reason,
+			Restocked:      req.Restock,
+			Lines:          refundLines,
+			RefundedCents:  o.RefundedCents + amount,
+		}
+		if refund.Lines == nil {
+			refund.Lines = []store.RefundLine{}
+		}
+		refund.OrderStatus = store.OrderStatusPartiallyRefunded
+		if refund.RefundedCents == o.TotalCents {
+			refund.OrderStatus = store.OrderStatusRefunded
+		}
+		return refund, nil
+	})
+	if err != nil {
+		var he *httpError
+		switch {
+		case issued != nil:
+			// The money has already moved; make sure someone notices.
+			log.Printf("ERROR recording refund %s (%d cents) for order %d: %v\n", issued.ID, issued.AmountCents, orderID, err)
+			http.Error(w, "Refund was issued but could not be recorded", http.StatusInternalServerError)
+		case err == store.ErrNotFound:
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case errors.As(err, &he):
+			http.Error(w, he.msg, he.status)
+		case errors.Is(err, payment.ErrUnavailable) || isPaymentError(err):
+			writePaymentError(w, "Refund failed", err)
+		default:
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refund)
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// paidOrder is a paid order of a single line.
+type paidOrder struct {
+	ID, UserID, LineID int
+	Product            store.Product
+}
+
+// buyPaid buys quantity units of a new $10.00 product (stock 5) for a new
+// shopper, taxed 13% in Ontario.
+func (ts *testServer) buyPaid(admin string, quantity int) paidOrder {
+	ts.t.Helper()
+	p := ts.product(admin, "Mug", 1000, 5)
+	userID, token := ts.shopper("alice")
+	var resp buyResponse
+	decode(ts.t, ts.do("POST", "/users/buy", token, buyRequest{Items: []store.BuyItem{{ProductID: p.ID, Quantity: quantity}}}), http.StatusOK, &resp)
+	var history []store.HistoryItem
+	decode(ts.t, ts.do("GET", "/users/history", token, nil), http.StatusOK, &history)
+	if len(history) != 1 {
+		ts.t.Fatalf("history = %+v, want the order's line", history)
+	}
+	return paidOrder{ID: resp.OrderID, UserID: userID, LineID: history[0].OrderLineID, Product: p}
+}
+
+func TestRefundPartialThenFull(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	o := ts.buyPaid(admin, 2)
+	path := fmt.Sprintf("/admin/orders/%d/refunds", o.ID)
+
+	var refund store.Refund
+	decode(t, ts.do("POST", path, admin, createRefundRequest{AmountCents: 500, Reason: "late"}), http.StatusCreated, &refund)
+	if refund.AmountCents != 500 || refund.OrderStatus != store.OrderStatusPartiallyRefunded || refund.RefundedCents != 500 ||
+		len(refund.Lines) != 0 {
+		t.Fatalf("partial refund = %+v, want 500 cents of a partially refunded order, tied to no line", refund)
+	}
+
+	// The rest of the 2260 cent order, without restocking
+	decode(t, ts.do("POST", path, admin, createRefundRequest{}), http.StatusCreated, &refund)
+	if refund.AmountCents != 1760 || refund.OrderStatus != store.OrderStatusRefunded || refund.RefundedCents != 2260 ||
+		len(refund.Lines) != 1 || refund.Lines[0].Quantity != 2 {
+		t.Fatalf("full refund = %+v, want the remaining 1760 cents covering both units", refund)
+	}
+	if got := ts.orderStatus(o.ID, o.UserID); got != store.OrderStatusRefunded {
+		t.Fatalf("order status = %q, want refunded", got)
+	}
+	if got := ts.stock(o.Product.ID); got != 3 {
+		t.Fatalf("stock = %d, want 3 without restock", got)
+	}
+}
+
+func TestRefundRejectsOverRefund(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	o := ts.buyPaid(admin, 2)
+	path := fmt.Sprintf("/admin/orders/%d/refunds", o.ID)
+	line := o.LineID
+
+	decode(t, ts.do("POST", path, admin, createRefundRequest{AmountCents: 2261}), http.StatusConflict, nil)
+	decode(t, ts.do("POST", path, admin, createRefundRequest{Lines: []refundLineRequest{{OrderLineID: line, Quantity: 3}}}), http.StatusConflict, nil)
+	// Two requests for the same line add up
+	decode(t, ts.do("POST", path, admin, createRefundRequest{Lines: []refundLineRequest{
+		{OrderLineID: line, Quantity: 2}, {OrderLineID: line, Quantity: 1},
+	}}), http.StatusConflict, nil)
+
+	decode(t, ts.do("POST", path, admin, createRefundRequest{Lines: []refundLineRequest{{OrderLineID: line, Quantity: 2}}}), http.StatusCreated, nil)
+	decode(t, ts.do("POST", path, admin, createRefundRequest{Lines: []refundLineRequest{{OrderLineID: line, Quantity: 1}}}), http.StatusConflict, nil)
+	decode(t, ts.do("POST", path, admin, createRefundRequest{}), http.StatusConflict, nil)
+	if got := ts.orderStatus(o.ID, o.UserID); got != store.OrderStatusRefunded {
+		t.Fatalf("order status = %q, want refunded", got)
+	}
+
+	// Malformed requests and unknown orders
+	decode(t, ts.do("POST", path, admin, createRefundRequest{AmountCents: 100, Lines: []refundLineRequest{{OrderLineID: line, Quantity: 1}}}), http.StatusBadRequest, nil)
+	decode(t, ts.do("POST", path, admin, createRefundRequest{AmountCents: 100, Restock: true}), http.StatusBadRequest, nil)
+	decode(t, ts.do("POST", "/admin/orders/999/refunds", admin, createRefundRequest{}), http.StatusNotFound, nil)
+}
+
+func TestRefundLinesRestock(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.admin()
+	o := ts.buyPaid(admin, 2)
+	path := fmt.Sprintf("/admin/orders/%d/refunds", o.ID)
+	line := o.LineID
+
+	// One unit at what was paid for it: $10.00 plus 13% HST
+	var refund store.Refund
+	decode(t, ts.do("POST", path, admin, createRefundRequest{
+		Lines:   []refundLineRequest{{OrderLineID: line, Quantity: 1}},
+		Restock: true,
+	}), http.StatusCreated, &refund)
+	if refund.AmountCents != 1130 || !refund.Restocked || refund.OrderStatus != store.OrderStatusPartiallyRefunded {
+		t.Fatalf("refund = %+v, want 1130 cents restocked", refund)
+	}
+	if got := ts.stock(o.Product.ID); got != 4 {
+		t.Fatalf("stock = %d, want the refunded unit back (4)", got)
+	}
+
+	// The full refund restocks only the unit not refunded yet
+	decode(t, ts.do("POST", path, admin, createRefundRequest{Restock: true}), http.StatusCreated, &refund)
+	if refund.AmountCents != 1130 || refund.OrderStatus != store.OrderStatusRefunded {
+		t.Fatalf("refund = %+v, want the remaining 1130 cents", refund)
+	}
+	if got := ts.stock(o.Product.ID); got != 5 {
+		t.Fatalf("stock = %d, want both units back (5)", got)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// maxSearchLength caps the ?q= of GET /products/search.
+const maxSearchLength = 200
+
+// productSearchResponse lists the matches of GET /products/search, best first.
+type productSearchResponse struct {
+	Query   string                      `json:"query"`
+	Results []store.ProductSearchResult `json:"results"`
+}
+
+// searchProductsHandler searches product names and descriptions, priced in the
+// optional ?currency= like GET /products.
+func (s *Server) searchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" || len(text) > maxSearchLength {
+		http.Error(w, "q is required (max "+strconv.Itoa(maxSearchLength)+" characters)", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultProductLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxProductLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxProductLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	currency, rate, herr := s.resolveCurrency(params.Get("currency"))
+	if herr != nil {
+		http.Error(w, herr.msg, herr.status)
+		return
+	}
+
+	results, err := s.stores.Products.Search(text, limit)
+	if err != nil {
+		http.Error(w, "Failed to search products", http.StatusInternalServerError)
+		return
+	}
+	for i := range results {
+		priceProduct(&results[i].Product, currency, rate)
+		s.setProductImageURLs(&results[i].Product)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(productSearchResponse{Query: text, Results: results})
+}
@@ -0,0 +1,363 @@
+// Package server holds the HTTP handlers. Handlers are methods on Server, which
+// carries every dependency, so they can run against fake stores and providers.
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/storage"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// Config holds the secrets the handlers need.
+type Config struct {
+	// JWTSecret signs and verifies access tokens.
+	JWTSecret []byte
+	// WebhookSecret verifies Stripe-Signature headers; webhooks are rejected when empty.
+	WebhookSecret string
+}
+
+// mediaFiles is a media store whose files the API serves itself, under
+// MountPath (see storage.Local).
+type mediaFiles interface {
+	http.Handler
+	MountPath() string
+}
+
+// Server serves the API.
+type Server struct {
+	stores   store.Stores
+	payments payment.Provider
+	media    storage.Store
+	cfg      Config
+	// imageSlots bounds how many uploaded images are decoded at once.
+	imageSlots chan struct{}
+}
+
+// New returns a Server using stores for persistence, payments to move money
+// and media to keep uploaded files.
+func New(stores store.Stores, payments payment.Provider, media storage.Store, cfg Config) *Server {
+	return &Server{
+		stores:     stores,
+		payments:   payments,
+		media:      media,
+		cfg:        cfg,
+		imageSlots: make(chan struct{}, maxConcurrentImageDecodes),
+	}
+}
+
+// Routes returns the router with every endpoint registered.
+func (s *Server) Routes() http.Handler {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Hello world!"))
+	}).Methods("GET")
+
+	r.HandleFunc("/signup", s.signupHandler).Methods("POST")
+	r.HandleFunc("/login", s.loginHandler).Methods("POST")
+	r.HandleFunc("/auth/refresh", s.refreshHandler).Methods("POST")
+	r.Handle("/auth/logout", s.jwtMiddleware(http.HandlerFunc(s.logoutHandler))).Methods("POST")
+	// Stripe authenticates itself with the Stripe-Signature header, not a JWT.
+	r.HandleFunc("/webhooks/stripe", s.stripeWebhookHandler).Methods("POST")
+	r.Handle("/products", s.jwtMiddleware(http.HandlerFunc(s.listProductsHandler))).Methods("GET")
+	r.Handle("/products/search", s.jwtMiddleware(http.HandlerFunc(s.searchProductsHandler))).Methods("GET")
+	r.Handle("/categories", s.jwtMiddleware(http.HandlerFunc(s.listCategoriesHandler))).Methods("GET")
+	r.Handle(
+		"/categories/{slug}/products",
+		s.jwtMiddleware(http.HandlerFunc(s.listCategoryProductsHandler)),
+	).Methods("GET")
+	r.Handle("/tags", s.jwtMiddleware(http.HandlerFunc(s.listTagsHandler))).Methods("GET")
+	// Locally stored images are public, like the bucket of the S3 backend.
+	if files, ok := s.media.(mediaFiles); ok && files.MountPath() != "" {
+		mount := files.MountPath()
+		r.PathPrefix(mount).Handler(http.StripPrefix(mount, files)).Methods("GET", "HEAD")
+	}
+
+	// Admin-only routes (through JWT -> adminMiddleware):
+	r.Handle(
+		"/admin/products",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createProductHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.updateProductHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/products/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteProductHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/products/archived",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.listArchivedProductsHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/products/{id}/restore",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.restoreProductHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/price-history",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.productPriceHistoryHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/products/{id}/price-schedules",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.listPriceSchedulesHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/products/{id}/price-schedules",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createPriceScheduleHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/price-schedules/{schedule_id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.cancelPriceScheduleHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/products/{id}/stock",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.adjustStockHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/options",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.setProductOptionsHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/products/{id}/variants",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createVariantHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/variants/{variant_id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.updateVariantHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/products/{id}/variants/{variant_id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteVariantHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/products/{id}/variants/{variant_id}/stock",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.adjustVariantStockHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/images",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.uploadProductImageHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/products/{id}/images",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.reorderProductImagesHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/products/{id}/images/{image_id}/primary",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.setPrimaryProductImageHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/products/{id}/images/{image_id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteProductImageHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/orders/{id}/refunds",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createRefundHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/reports/tax",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.getTaxReportHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/categories",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createCategoryHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/categories/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.updateCategoryHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/categories/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteCategoryHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/tags",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createTagHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/tags/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.renameTagHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/tags/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteTagHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/fx-rates",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.listFXRatesHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/fx-rates/{currency}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.setFXRateHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/fx-rates/{currency}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteFXRateHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/admin/coupons",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.createCouponHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/coupons",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.listCouponsHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/coupons/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.getCouponHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/coupons/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.updateCouponHandler))),
+	).Methods("PUT")
+
+	r.Handle(
+		"/admin/coupons/{id}",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.deleteCouponHandler))),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/users/buy",
+		s.jwtMiddleware(s.idempotencyMiddleware(http.HandlerFunc(s.buyProductsHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/cart/items",
+		s.jwtMiddleware(http.HandlerFunc(s.getCartHandler)),
+	).Methods("GET")
+
+	r.Handle(
+		"/users/cart/items",
+		s.jwtMiddleware(http.HandlerFunc(s.addCartItemHandler)),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/cart/items",
+		s.jwtMiddleware(http.HandlerFunc(s.clearCartHandler)),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/users/cart/items/{item_id}",
+		s.jwtMiddleware(http.HandlerFunc(s.updateCartItemHandler)),
+	).Methods("PATCH")
+
+	r.Handle(
+		"/users/cart/items/{item_id}",
+		s.jwtMiddleware(http.HandlerFunc(s.deleteCartItemHandler)),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/users/cart/checkout",
+		s.jwtMiddleware(s.idempotencyMiddleware(http.HandlerFunc(s.cartCheckoutHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/orders/{id}/confirm",
+		s.jwtMiddleware(http.HandlerFunc(s.confirmOrderHandler)),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/history",
+		s.jwtMiddleware(http.HandlerFunc(s.getUserHistoryHandler)),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/users/{id}/revoke-sessions",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.revokeUserSessionsHandler))),
+	).Methods("POST")
+
+	r.Handle(
+		"/admin/sales",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.getSalesHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/admin/sales/totals",
+		s.jwtMiddleware(s.adminMiddleware(http.HandlerFunc(s.getSalesTotalsHandler))),
+	).Methods("GET")
+
+	r.Handle(
+		"/users/billing-province",
+		s.jwtMiddleware(http.HandlerFunc(s.getBillingProvinceHandler)),
+	).Methods("GET")
+
+	r.Handle(
+		"/users/billing-province",
+		s.jwtMiddleware(http.HandlerFunc(s.setBillingProvinceHandler)),
+	).Methods("PUT")
+
+	r.Handle(
+		"/users/creditcards",
+		s.jwtMiddleware(http.HandlerFunc(s.addCreditCardHandler)),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/creditcards",
+		s.jwtMiddleware(http.HandlerFunc(s.listCreditCardsHandler)),
+	).Methods("GET")
+
+	r.Handle(
+		"/users/creditcards/expiry-events",
+		s.jwtMiddleware(http.HandlerFunc(s.listCardExpiryEventsHandler)),
+	).Methods("GET")
+
+	r.Handle(
+		"/users/creditcards/setup-intent",
+		s.jwtMiddleware(http.HandlerFunc(s.createSetupIntentHandler)),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/creditcards/setup-intent/{id}/complete",
+		s.jwtMiddleware(http.HandlerFunc(s.completeSetupIntentHandler)),
+	).Methods("POST")
+
+	r.Handle(
+		"/users/creditcards/{card_id}",
+		s.jwtMiddleware(http.HandlerFunc(s.deleteCreditCardHandler)),
+	).Methods("DELETE")
+
+	r.Handle(
+		"/users/creditcards/{card_id}/default",
+		s.jwtMiddleware(http.HandlerFunc(s.setDefaultCreditCardHandler)),
+	).Methods("PUT")
+
+	return r
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/store/memstore"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// testServer is a Server backed by the in-memory stores and the fake payment
+// provider, with helpers to call its routes.
+type testServer struct {
+	t        *testing.T
+	db       *memstore.DB
+	stores   store.Stores
+	payments *payment.Fake
+	srv      *Server
+	routes   http.Handler
+}
+
+// newTestServer returns a testServer with empty stores. Each wrap may replace
+// stores, e.g. to inject failures, before the Server is built.
+func newTestServer(t *testing.T, wrap ...func(*store.Stores)) *testServer {
+	t.Helper()
+	db := memstore.New()
+	stores := db.Stores()
+	for _, w := range wrap {
+		w(&stores)
+	}
+	payments := payment.NewFake()
+	srv := New(stores, payments, nil, Config{
+		JWTSecret:     []byte("test-secret"),
+		WebhookSecret: testWebhookSecret,
+	})
+	return &testServer{t: t, db: db, stores: stores, payments: payments, srv: srv, routes: srv.Routes()}
+}
+
+// do sends a request with body encoded as JSON (when non-nil) and the bearer
+// token (when non-empty), and returns the recorded response.
+func (ts *testServer) do(method, path, token string, body any, header ...string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatalf("encoding request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	ts.routes.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode fails the test unless rec has the wanted status, then decodes its body into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+	}
+}
+
+// login signs name up and returns its user ID with an access and a refresh token.
+func (ts *testServer) login(name string) (int, loginResponse) {
+	ts.t.Helper()
+	email := name + "@example.com"
+	var user signupResponse
+	decode(ts.t, ts.do("POST", "/signup", "", signupRequest{Username: name, Email: email, Password: "secret-password"}), http.StatusCreated, &user)
+	var tokens loginResponse
+	decode(ts.t, ts.do("POST", "/login", "", loginRequest{Email: email, Password: "secret-password"}), http.StatusOK, &tokens)
+	return user.ID, tokens
+}
+
+// admin returns the access token of a new admin user.
+func (ts *testServer) admin() string {
+	ts.t.Helper()
+	id, tokens := ts.login("admin")
+	ts.db.GrantAdmin(id)
+	return tokens.Token
+}
+
+// shopper returns the user ID and access token of a new user who saved a
+// default card and a billing province, ready to buy.
+func (ts *testServer) shopper(name string) (int, string) {
+	ts.t.Helper()
+	id, tokens := ts.login(name)
+	decode(ts.t, ts.do("POST", "/users/creditcards", tokens.Token, addCCRequest{PaymentMethodID: "pm_card_visa"}), http.StatusCreated, nil)
+	decode(ts.t, ts.do("PUT", "/users/billing-province", tokens.Token, billingProvinceBody{Province: "ON"}), http.StatusOK, nil)
+	return id, tokens.Token
+}
+
+// product creates a taxable product as admin and returns it.
+func (ts *testServer) product(adminToken string, name string, priceCents, stock int) store.Product {
+	ts.t.Helper()
+	var p store.Product
+	body := map[string]any{"name": name, "price_cents": priceCents, "stock_quantity": stock}
+	decode(ts.t, ts.do("POST", "/admin/products", adminToken, body), http.StatusCreated, &p)
+	return p
+}
+
+// stock returns a product's current stock.
+func (ts *testServer) stock(productID int) int {
+	ts.t.Helper()
+	p, err := ts.stores.Products.Get(productID)
+	if err != nil {
+		ts.t.Fatalf("getting product %d: %v", productID, err)
+	}
+	return p.StockQuantity
+}
+
+// orderStatus returns the status of one of userID's orders.
+func (ts *testServer) orderStatus(orderID, userID int) string {
+	ts.t.Helper()
+	o, err := ts.stores.Orders.GetForUser(orderID, userID)
+	if err != nil {
+		ts.t.Fatalf("getting order %d: %v", orderID, err)
+	}
+	return o.Status
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// setupIntentResponse is returned while a card setup is in progress.
+type setupIntentResponse struct {
+	SetupIntentID string `json:"setup_intent_id"`
+	Status        string `json:"status"`
+	// ClientSecret is what Stripe.js needs to collect and authenticate the card.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// completeSetupIntentRequest optionally names the payment method to confirm the
+// SetupIntent with server-side; clients using Stripe.js confirm it themselves.
+type completeSetupIntentRequest struct {
+	PaymentMethodID string `json:"payment_method_id"`
+}
+
+// createSetupIntentHandler starts saving a card: the client collects and
+// authenticates it with the returned client_secret (stripe.confirmCardSetup), and the
+// card is saved once the SetupIntent succeeds, via the complete endpoint or webhook.
+func (s *Server) createSetupIntentHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	customerID, herr := s.ensureStripeCustomer(user)
+	if herr != nil {
+		http.Error(w, herr.msg, herr.status)
+		return
+	}
+
+	si, err := s.payments.CreateSetupIntent(customerID)
+	if err != nil {
+		writePaymentError(w, "Failed to create setup intent", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(setupIntentResponse{
+		SetupIntentID: si.ID,
+		Status:        si.Status,
+		ClientSecret:  si.ClientSecret,
+	})
+}
+
+// completeSetupIntentHandler saves the card of a succeeded SetupIntent. It is safe
+// to call after the webhook already saved the card.
+func (s *Server) completeSetupIntentHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract logged-in user_id from context
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req completeSetupIntentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	// The SetupIntent must belong to the caller's Stripe customer
+	si, err := s.payments.GetSetupIntent(mux.Vars(r)["id"])
+	if err != nil {
+		if isPaymentError(err) {
+			http.Error(w, "Setup intent not found", http.StatusNotFound)
+			return
+		}
+		writePaymentError(w, "Failed to fetch setup intent", err)
+		return
+	}
+	if user.StripeCustomerID == "" || si.CustomerID != user.StripeCustomerID {
+		http.Error(w, "Setup intent not found", http.StatusNotFound)
+		return
+	}
+
+	if req.PaymentMethodID != "" &&
+		(si.Status == payment.IntentStatusRequiresPaymentMethod || si.Status == payment.IntentStatusRequiresConfirmation) {
+		si, err = s.payments.ConfirmSetupIntent(si.ID, req.PaymentMethodID)
+		if err != nil {
+			writePaymentError(w, "Card setup failed", err)
+			return
+		}
+	}
+
+	switch si.Status {
+	case payment.IntentStatusSucceeded:
+	case payment.IntentStatusRequiresAction, payment.IntentStatusProcessing:
+		// Not done yet: the client finishes 3-D Secure and calls again, or the webhook saves the card
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(setupIntentResponse{
+			SetupIntentID: si.ID,
+			Status:        si.Status,
+			ClientSecret:  si.ClientSecret,
+		})
+		return
+	default:
+		http.Error(w, "Card setup is not complete (status: "+si.Status+")", http.StatusConflict)
+		return
+	}
+
+	card, existed, err := s.saveSetupIntentCard(user, si)
+	if err != nil {
+		if isPaymentError(err) {
+			writePaymentError(w, "Failed to fetch payment method", err)
+			return
+		}
+		writeSaveCardError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newCreditCardResponse(card))
+}
+
+// saveSetupIntentCard saves the payment method of a succeeded SetupIntent as one
+// of the user's cards (see saveCard).
+func (s *Server) saveSetupIntentCard(user *store.User, si *payment.SetupIntentInfo) (*store.Card, bool, error) {
+	pm, err := s.payments.GetPaymentMethod(si.PaymentMethodID)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.saveCard(user.ID, si.CustomerID, pm)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// maxTagLength caps the length of a tag name.
+const maxTagLength = 50
+
+// tagRequest is the payload for creating or renaming a tag.
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+// normalizeTag trims, lower-cases and collapses the spaces of a tag name.
+func normalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// productTags normalizes and de-duplicates the tags of a product payload,
+// keeping nil as nil; the returned message is empty when they are valid.
+func productTags(tags []string) ([]string, string) {
+	if tags == nil {
+		return nil, ""
+	}
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, t := range tags {
+		name := normalizeTag(t)
+		if name == "" || len(name) > maxTagLength {
+			return nil, "tags must be non-empty (max " + strconv.Itoa(maxTagLength) + " characters)"
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out, ""
+}
+
+// listTagsHandler returns every tag with how many products carry it.
+func (s *Server) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.stores.Tags.List()
+	if err != nil {
+		http.Error(w, "Failed to query tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (s *Server) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := decodeTagName(w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := s.stores.Tags.Create(name)
+	if err == store.ErrConflict {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// renameTagHandler renames a tag on every product that carries it.
+func (s *Server) renameTagHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	name, ok := decodeTagName(w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := s.stores.Tags.Rename(tagID, name)
+	if err == store.ErrNotFound {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrConflict {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to rename tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// deleteTagHandler deletes a tag and removes it from every product.
+func (s *Server) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.stores.Tags.Delete(tagID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeTagName reads and validates the name of a tagRequest, writing a 400 if
+// it is invalid.
+func decodeTagName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return "", false
+	}
+	defer r.Body.Close()
+
+	name := normalizeTag(req.Name)
+	if name == "" || len(name) > maxTagLength {
+		http.Error(w, "name is required (max "+strconv.Itoa(maxTagLength)+" characters)", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// taxReportResponse is the sales tax summary for a period.
+type taxReportResponse struct {
+	From      string                     `json:"from,omitempty"`
+	To        string                     `json:"to,omitempty"`
+	Provinces []store.ProvinceTaxSummary `json:"provinces"`
+}
+
+// getTaxReportHandler sums sales and the GST/HST/PST/QST collected per billing
+// province, optionally for a date range (from/to, both inclusive).
+func (s *Server) getTaxReportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	resp := taxReportResponse{From: q.Get("from"), To: q.Get("to")}
+
+	var filter store.TaxReportFilter
+	if resp.From != "" {
+		from, err := time.Parse("2006-01-02", resp.From)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date: use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.From = from
+	}
+	if resp.To != "" {
+		to, err := time.Parse("2006-01-02", resp.To)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date: use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.To = to.AddDate(0, 0, 1) // include entire “to” day
+	}
+
+	provinces, err := s.stores.Orders.TaxReport(filter)
+	if err != nil {
+		http.Error(w, "Failed to query tax report", http.StatusInternalServerError)
+		return
+	}
+	resp.Provinces = provinces
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+const (
+	// accessTokenTTL is kept short because access tokens are only revocable
+	// through the jti denylist.
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL bounds how long a session can be kept alive without logging in.
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// errInvalidRefreshToken covers unknown, expired, revoked and reused refresh tokens.
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// refreshRequest is the payload for /auth/refresh and /auth/logout.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// randomToken returns n random bytes, hex encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored; the raw value only ever lives on the client.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates an access token and a refresh token starting a new family.
+func (s *Server) issueTokens(userID int, username string) (loginResponse, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	access, err := newAccessToken()
+	if err != nil {
+		return loginResponse{}, err
+	}
+	if err := s.stores.Tokens.CreateRefreshToken(userID, hashToken(refresh), family, refreshTokenTTL, access); err != nil {
+		return loginResponse{}, err
+	}
+	return s.tokenResponse(userID, username, refresh, access)
+}
+
+// rotateRefreshToken exchanges a refresh token for a new one in the same family.
+// Presenting a token that was already rotated or revoked means it leaked (or the
+// client replayed it), so the store revokes the whole family.
+func (s *Server) rotateRefreshToken(token string) (loginResponse, error) {
+	refresh, err := randomToken(32)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	access, err := newAccessToken()
+	if err != nil {
+		return loginResponse{}, err
+	}
+	user, err := s.stores.Tokens.RotateRefreshToken(hashToken(token), hashToken(refresh), refreshTokenTTL, access)
+	switch err {
+	case nil:
+	case store.ErrNotFound, store.ErrTokenExpired, store.ErrTokenReused:
+		return loginResponse{}, errInvalidRefreshToken
+	default:
+		return loginResponse{}, err
+	}
+	return s.tokenResponse(user.ID, user.Username, refresh, access)
+}
+
+// tokenResponse signs the access token stored with a refresh token and pairs them.
+func (s *Server) tokenResponse(userID int, username, refresh string, access store.AccessToken) (loginResponse, error) {
+	token, err := s.createJWT(userID, username, access)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	return loginResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *Server) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.rotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if err == errInvalidRefreshToken {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// logoutHandler denylists the caller's access token and, when a refresh token is
+// supplied, revokes its whole family.
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("jwt_claims").(*jwtClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	var refreshHash string
+	if req.RefreshToken != "" {
+		refreshHash = hashToken(req.RefreshToken)
+	}
+	if err := s.stores.Tokens.Logout(claims.UserID, claims.ID, claims.ExpiresAt.Time, refreshHash); err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withClaims stores the parsed token claims alongside user_id in the request context.
+func withClaims(ctx context.Context, claims *jwtClaims) context.Context {
+	ctx = context.WithValue(ctx, "user_id", claims.UserID)
+	return context.WithValue(ctx, "jwt_claims", claims)
+}
+
+// revokeUserSessionsHandler lets an admin sign a user out everywhere: every
+// refresh token family is revoked and the live access tokens are denylisted.
+func (s *Server) revokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.stores.Tokens.RevokeUser(userID); err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR revoking sessions of user %d: %v\n", userID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
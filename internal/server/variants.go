@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+const (
+	// maxOptionNameLength bounds option names, e.g. "size".
+	maxOptionNameLength = 50
+	// maxSKULength bounds variant SKUs.
+	maxSKULength = 64
+)
+
+// optionsRequest is the payload of PUT /admin/products/{id}/options: the
+// product's complete list of options, replacing the current one.
+type optionsRequest struct {
+	Options []store.ProductOption `json:"options"`
+}
+
+// options validates and normalizes the request; the returned message is empty
+// when it is valid.
+func (req optionsRequest) options() ([]store.ProductOption, string) {
+	out := make([]store.ProductOption, 0, len(req.Options))
+	names := map[string]bool{}
+	for _, o := range req.Options {
+		name := normalizeOptionName(o.Name)
+		if name == "" || len(name) > maxOptionNameLength {
+			return nil, "option names must be non-empty (max " + strconv.Itoa(maxOptionNameLength) + " characters)"
+		}
+		if names[name] {
+			return nil, "option " + strconv.Quote(name) + " is listed twice"
+		}
+		names[name] = true
+
+		if len(o.Values) == 0 {
+			return nil, "option " + strconv.Quote(name) + " needs at least one value"
+		}
+		values := make([]string, 0, len(o.Values))
+		seen := map[string]bool{}
+		for _, v := range o.Values {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[v] {
+				return nil, "values of option " + strconv.Quote(name) + " must be non-empty and distinct"
+			}
+			seen[v] = true
+			values = append(values, v)
+		}
+		out = append(out, store.ProductOption{Name: name, Values: values})
+	}
+	return out, ""
+}
+
+// normalizeOptionName trims and lower-cases an option name.
+func normalizeOptionName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// variantRequest is the payload for creating or replacing a variant. Stock is
+// only read on creation; later changes go through the variant's stock endpoint.
+type variantRequest struct {
+	SKU                string            `json:"sku"`
+	Options            map[string]string `json:"options"`
+	PriceOverrideCents *int              `json:"price_override_cents"`
+	StockQuantity      int               `json:"stock_quantity"`
+	UnlimitedStock     bool              `json:"unlimited_stock"`
+}
+
+// input validates the request; the returned message is empty when it is valid.
+func (req variantRequest) input() (store.VariantInput, string) {
+	in := store.VariantInput{
+		SKU:                strings.TrimSpace(req.SKU),
+		Options:            make(map[string]string, len(req.Options)),
+		PriceOverrideCents: req.PriceOverrideCents,
+		StockQuantity:      req.StockQuantity,
+		UnlimitedStock:     req.UnlimitedStock,
+	}
+	for name, value := range req.Options {
+		in.Options[normalizeOptionName(name)] = strings.TrimSpace(value)
+	}
+
+	switch {
+	case in.SKU == "" || len(in.SKU) > maxSKULength:
+		return in, "sku is required (max " + strconv.Itoa(maxSKULength) + " characters)"
+	case len(in.Options) != len(req.Options):
+		return in, "options must not repeat an option name"
+	case in.PriceOverrideCents != nil && *in.PriceOverrideCents <= 0:
+		return in, "price_override_cents must be greater than 0"
+	case in.StockQuantity < 0:
+		return in, "stock_quantity cannot be negative"
+	}
+	return in, ""
+}
+
+// setProductOptionsHandler replaces the options a product's variants differ by.
+// It is refused while a variant would no longer match them.
+func (s *Server) setProductOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req optionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	options, msg := req.options()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	options, err = s.stores.Variants.SetOptions(prodID, options)
+	if err != nil {
+		writeVariantStoreError(w, err, "Product not found", "Failed to update options")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+func (s *Server) createVariantHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract {id} from URL
+	prodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	in, ok := decodeVariantRequest(w, r)
+	if !ok {
+		return
+	}
+
+	variant, err := s.stores.Variants.Create(prodID, in)
+	if err != nil {
+		writeVariantStoreError(w, err, "Product not found", "Failed to create variant")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+// updateVariantHandler replaces a variant's SKU, options and price override.
+func (s *Server) updateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	prodID, variantID, ok := productVariantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	in, ok := decodeVariantRequest(w, r)
+	if !ok {
+		return
+	}
+
+	variant, err := s.stores.Variants.Update(prodID, variantID, in)
+	if err != nil {
+		writeVariantStoreError(w, err, "Variant not found", "Failed to update variant")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variant)
+}
+
+// deleteVariantHandler deletes a variant. Past orders keep its SKU and options.
+func (s *Server) deleteVariantHandler(w http.ResponseWriter, r *http.Request) {
+	prodID, variantID, ok := productVariantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.stores.Variants.Delete(prodID, variantID); err != nil {
+		writeVariantStoreError(w, err, "Variant not found", "Failed to delete variant")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adjustVariantStockHandler is adjustStockHandler for a variant's stock.
+func (s *Server) adjustVariantStockHandler(w http.ResponseWriter, r *http.Request) {
+	prodID, variantID, ok := productVariantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	adj, ok := decodeStockAdjustment(w, r)
+	if !ok {
+		return
+	}
+	level, err := s.stores.Variants.AdjustStock(prodID, variantID, adj)
+	writeStockLevel(w, level, err, "Variant not found")
+}
+
+// decodeVariantRequest reads and validates a variantRequest, answering 400 if
+// it is invalid.
+func decodeVariantRequest(w http.ResponseWriter, r *http.Request) (store.VariantInput, bool) {
+	var req variantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return store.VariantInput{}, false
+	}
+	defer r.Body.Close()
+
+	in, msg := req.input()
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return store.VariantInput{}, false
+	}
+	in.AdminID, _ = r.Context().Value("user_id").(int)
+	return in, true
+}
+
+// productVariantIDs parses {id} and {variant_id}, answering 400 if either is invalid.
+func productVariantIDs(w http.ResponseWriter, r *http.Request) (prodID, variantID int, ok bool) {
+	vars := mux.Vars(r)
+	prodID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	variantID, err = strconv.Atoi(vars["variant_id"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return prodID, variantID, true
+}
+
+// writeVariantStoreError maps ProductVariantStore errors to HTTP responses;
+// notFound is the message for store.ErrNotFound.
+func writeVariantStoreError(w http.ResponseWriter, err error, notFound, fallback string) {
+	var optionsErr store.VariantOptionsError
+	switch {
+	case err == store.ErrNotFound:
+		http.Error(w, notFound, http.StatusNotFound)
+	case err == store.ErrConflict:
+		http.Error(w, "SKU or option combination already exists", http.StatusConflict)
+	case err == store.ErrOptionsInUse:
+		http.Error(w, "Existing variants do not match these options; update or delete them first", http.StatusConflict)
+	case errors.As(err, &optionsErr):
+		http.Error(w, optionsErr.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
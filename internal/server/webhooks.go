@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
+
+	"github.com/Brossef/rescounts-task/internal/payment"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// Stripe may send events up to this size; anything larger is rejected.
+const maxWebhookBodyBytes = 65536
+
+// stripeWebhookHandler verifies the Stripe-Signature header, records the event ID so
+// redeliveries are ignored, and applies the event to the matching order.
+func (s *Server) stripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	secret := s.cfg.WebhookSecret
+	if secret == "" {
+		http.Error(w, "Webhook secret not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Dashboard endpoints are pinned to the account's API version, which may
+	// differ from the SDK's, so only the signature and timestamp are enforced.
+	event, err := webhook.ConstructEventWithOptions(
+		payload,
+		r.Header.Get("Stripe-Signature"),
+		secret,
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true},
+	)
+	if err != nil {
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := paymentEvent(event)
+	if err != nil {
+		http.Error(w, "Invalid event payload", http.StatusBadRequest)
+		return
+	}
+
+	// The event ID is only recorded below, once the card is saved, so a failed
+	// save is retried on redelivery; an event already recorded saves nothing.
+	if event.Type == stripe.EventTypeSetupIntentSucceeded {
+		seen, err := s.stores.Orders.SeenPaymentEvent(event.ID)
+		if err == nil && !seen {
+			err = s.saveWebhookSetupIntentCard(event)
+		}
+		if err != nil {
+			log.Printf("ERROR processing stripe event %s (%s): %v\n", event.ID, event.Type, err)
+			http.Error(w, "Failed to process event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Already processed events are acknowledged too, so Stripe stops retrying.
+	if _, err := s.stores.Orders.ApplyPaymentEvent(ev); err != nil {
+		log.Printf("ERROR processing stripe event %s (%s): %v\n", event.ID, event.Type, err)
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// paymentEvent extracts what the order store needs from the event types we care
+// about. Other types are still recorded (for deduplication) but otherwise ignored.
+func paymentEvent(event stripe.Event) (store.PaymentEvent, error) {
+	ev := store.PaymentEvent{ID: event.ID, Type: string(event.Type)}
+	switch event.Type {
+	case stripe.EventTypePaymentIntentSucceeded, stripe.EventTypePaymentIntentPaymentFailed:
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return ev, err
+		}
+		ev.PaymentIntentID = pi.ID
+		if orderID, err := strconv.Atoi(pi.Metadata["order_id"]); err == nil {
+			ev.OrderID = orderID
+		}
+
+	case stripe.EventTypeChargeRefunded:
+		var ch stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+			return ev, err
+		}
+		if ch.PaymentIntent != nil {
+			ev.PaymentIntentID = ch.PaymentIntent.ID
+		}
+		ev.FullyRefunded = ch.Refunded
+		ev.AmountRefunded = ch.AmountRefunded
+
+	case stripe.EventTypeChargeDisputeCreated:
+		var d stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &d); err != nil {
+			return ev, err
+		}
+		if d.PaymentIntent != nil {
+			ev.PaymentIntentID = d.PaymentIntent.ID
+		}
+	}
+	return ev, nil
+}
+
+// saveWebhookSetupIntentCard saves the card of a succeeded SetupIntent for clients
+// that never call the complete endpoint. Saving is idempotent, so a card already
+// saved by the endpoint, or by a concurrent delivery of the event, is kept.
+func (s *Server) saveWebhookSetupIntentCard(event stripe.Event) error {
+	var si stripe.SetupIntent
+	if err := json.Unmarshal(event.Data.Raw, &si); err != nil {
+		return err
+	}
+	if si.Customer == nil || si.PaymentMethod == nil {
+		return nil
+	}
+
+	user, err := s.stores.Users.GetByStripeCustomerID(si.Customer.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		// Not one of ours (or the user was deleted)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.saveSetupIntentCard(user, &payment.SetupIntentInfo{
+		ID:              si.ID,
+		Status:          string(si.Status),
+		CustomerID:      si.Customer.ID,
+		PaymentMethodID: si.PaymentMethod.ID,
+	})
+	var dup *duplicateCardError
+	if errors.As(err, &dup) {
+		log.Printf("NOTICE: setup intent %s duplicates card %d of user %d\n", si.ID, dup.Card.ID, user.ID)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82/webhook"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// The fixtures in testdata/webhooks are Stripe events for the PaymentIntent
+// "pi_fixture" and the customer "cus_fixture".
+const fixturePaymentIntent = "pi_fixture"
+
+// webhook posts the fixture event name, signed with secret at timestamp.
+func (ts *testServer) webhook(name, secret string, timestamp time.Time) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	payload, err := os.ReadFile(filepath.Join("testdata", "webhooks", name+".json"))
+	if err != nil {
+		ts.t.Fatalf("reading fixture: %v", err)
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    secret,
+		Timestamp: timestamp,
+	})
+	req := httptest.NewRequest("POST", "/webhooks/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signed.Header)
+	rec := httptest.NewRecorder()
+	ts.routes.ServeHTTP(rec, req)
+	return rec
+}
+
+// sendEvent posts a correctly signed fixture event and expects it to be acknowledged.
+func (ts *testServer) sendEvent(name string) {
+	ts.t.Helper()
+	decode(ts.t, ts.webhook(name, testWebhookSecret, time.Now()), http.StatusOK, nil)
+}
+
+// fixtureOrder places a pending 1130 cent order (a $10.00 product taxed in
+// Ontario) paid with the fixtures' PaymentIntent, out of a stock of 5.
+func (ts *testServer) fixtureOrder() (userID int, order *store.Order) {
+	ts.t.Helper()
+	userID, err := ts.stores.Users.Create("alice", "alice@example.com", "hash")
+	if err != nil {
+		ts.t.Fatalf("creating user: %v", err)
+	}
+	p, err := ts.stores.Products.Create(store.ProductInput{Name: "Mug", PriceCents: 1000, StockQuantity: 5, TaxCategory: "taxable"})
+	if err != nil {
+		ts.t.Fatalf("creating product: %v", err)
+	}
+	order, err = ts.stores.Orders.CreatePending(store.NewOrder{
+		UserID: userID, Items: []store.BuyItem{{ProductID: p.ID, Quantity: 1}}, Currency: money.Base, Province: "ON",
+	})
+	if err != nil {
+		ts.t.Fatalf("creating order: %v", err)
+	}
+	if err := ts.stores.Orders.SetPaymentIntent(order.ID, fixturePaymentIntent, store.OrderStatusPending); err != nil {
+		ts.t.Fatalf("setting payment intent: %v", err)
+	}
+	return userID, order
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	decode(t, ts.webhook("payment_intent.succeeded", "whsec_other", time.Now()), http.StatusBadRequest, nil)
+	decode(t, ts.webhook("payment_intent.succeeded", testWebhookSecret, time.Now().Add(-time.Hour)), http.StatusBadRequest, nil)
+
+	req := httptest.NewRequest("POST", "/webhooks/stripe", bytes.NewReader([]byte(`{"id":"evt_unsigned"}`)))
+	rec := httptest.NewRecorder()
+	ts.routes.ServeHTTP(rec, req)
+	decode(t, rec, http.StatusBadRequest, nil)
+
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPending {
+		t.Fatalf("status = %q after rejected events, want pending", got)
+	}
+}
+
+func TestWebhookPaymentSucceeded(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	ts.sendEvent("payment_intent.succeeded")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("status = %q, want paid", got)
+	}
+	if got := ts.stock(order.Lines[0].ProductID); got != 4 {
+		t.Fatalf("stock = %d, want 4", got)
+	}
+}
+
+func TestWebhookPaymentFailed(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	ts.sendEvent("payment_intent.payment_failed")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusFailed {
+		t.Fatalf("status = %q, want failed", got)
+	}
+	if got := ts.stock(order.Lines[0].ProductID); got != 5 {
+		t.Fatalf("stock = %d, want the reservation released (5)", got)
+	}
+
+	// A payment that succeeds after all takes the stock back
+	ts.sendEvent("payment_intent.succeeded")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("status = %q after a late success, want paid", got)
+	}
+	if got := ts.stock(order.Lines[0].ProductID); got != 4 {
+		t.Fatalf("stock = %d after a late success, want 4", got)
+	}
+}
+
+func TestWebhookFailureDoesNotUndoPayment(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	ts.sendEvent("payment_intent.succeeded")
+	ts.sendEvent("payment_intent.payment_failed")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("status = %q, want paid", got)
+	}
+	if got := ts.stock(order.Lines[0].ProductID); got != 4 {
+		t.Fatalf("stock = %d, want 4", got)
+	}
+}
+
+func TestWebhookIgnoresReplayedEvents(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	ts.sendEvent("payment_intent.payment_failed")
+	ts.sendEvent("payment_intent.succeeded")
+	// Redelivered events are acknowledged so Stripe stops retrying, but not reapplied
+	ts.sendEvent("payment_intent.payment_failed")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPaid {
+		t.Fatalf("status = %q, want paid", got)
+	}
+
+	applied, err := ts.stores.Orders.ApplyPaymentEvent(store.PaymentEvent{ID: "evt_pi_failed"})
+	if err != nil || applied {
+		t.Fatalf("ApplyPaymentEvent(evt_pi_failed) = %v, %v; want it recorded once", applied, err)
+	}
+}
+
+func TestWebhookRefunds(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+	ts.sendEvent("payment_intent.succeeded")
+
+	ts.sendEvent("charge.refunded.partial")
+	got, err := ts.stores.Orders.GetForUser(order.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != store.OrderStatusPartiallyRefunded || got.RefundedCents != 500 {
+		t.Fatalf("order = %s with %d refunded, want partially_refunded with 500", got.Status, got.RefundedCents)
+	}
+
+	ts.sendEvent("charge.refunded")
+	if got, err = ts.stores.Orders.GetForUser(order.ID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != store.OrderStatusRefunded || got.RefundedCents != 1130 {
+		t.Fatalf("order = %s with %d refunded, want refunded with 1130", got.Status, got.RefundedCents)
+	}
+}
+
+func TestWebhookLateRefundEventDoesNotLowerRefund(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+	ts.sendEvent("payment_intent.succeeded")
+
+	ts.sendEvent("charge.refunded")
+	ts.sendEvent("charge.refunded.partial")
+	got, err := ts.stores.Orders.GetForUser(order.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != store.OrderStatusRefunded || got.RefundedCents != 1130 {
+		t.Fatalf("order = %s with %d refunded, want refunded with 1130", got.Status, got.RefundedCents)
+	}
+}
+
+func TestWebhookRefundIgnoresUnpaidOrder(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+
+	ts.sendEvent("charge.refunded")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusPending {
+		t.Fatalf("status = %q, want pending", got)
+	}
+}
+
+func TestWebhookDispute(t *testing.T) {
+	ts := newTestServer(t)
+	userID, order := ts.fixtureOrder()
+	ts.sendEvent("payment_intent.succeeded")
+
+	ts.sendEvent("charge.dispute.created")
+	if got := ts.orderStatus(order.ID, userID); got != store.OrderStatusDisputed {
+		t.Fatalf("status = %q, want disputed", got)
+	}
+}
+
+func TestWebhookSetupIntentSavesCard(t *testing.T) {
+	ts := newTestServer(t)
+	userID, err := ts.stores.Users.Create("alice", "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.stores.Users.SetStripeCustomerID(userID, "cus_fixture"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.sendEvent("setup_intent.succeeded")
+	ts.sendEvent("setup_intent.succeeded")
+
+	cards, err := ts.stores.Cards.ListForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 || cards[0].StripePaymentMethodID != "pm_card_mastercard" || !cards[0].IsDefault {
+		t.Fatalf("cards = %+v, want the mastercard saved once as the default", cards)
+	}
+}
+
+func TestWebhookRedeliveredSetupIntentDoesNotRestoreDeletedCard(t *testing.T) {
+	ts := newTestServer(t)
+	userID, err := ts.stores.Users.Create("alice", "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.stores.Users.SetStripeCustomerID(userID, "cus_fixture"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.sendEvent("setup_intent.succeeded")
+	card, err := ts.stores.Cards.GetByPaymentMethod("pm_card_mastercard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.stores.Cards.Delete(card.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.sendEvent("setup_intent.succeeded")
+	if cards, err := ts.stores.Cards.ListForUser(userID); err != nil || len(cards) != 0 {
+		t.Fatalf("cards = %+v, %v; want the deleted card to stay deleted", cards, err)
+	}
+}
+
+func TestWebhookIgnoresUnknownCustomer(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.sendEvent("setup_intent.succeeded")
+	if _, err := ts.stores.Cards.GetByPaymentMethod("pm_card_mastercard"); err != store.ErrNotFound {
+		t.Fatalf("GetByPaymentMethod err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import "testing"
+
+func TestLocalMountPath(t *testing.T) {
+	for _, tc := range []struct {
+		baseURL, want string
+	}{
+		{"", "/media/"},
+		{"/files/", "/files/"},
+		{"/static/images", "/static/images/"},
+		{"https://cdn.example.com/media", ""},
+		{"//cdn.example.com/media", ""},
+		{"/", ""},
+	} {
+		l, err := NewLocal(t.TempDir(), tc.baseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.MountPath(); got != tc.want {
+			t.Errorf("MountPath with base URL %q = %q, want %q", tc.baseURL, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package storage keeps uploaded files (product images) behind Store, with a
+// local-filesystem implementation and one for S3-compatible object stores.
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Store is everything the handlers need from a file store. Keys are
+// slash-separated relative paths, e.g. "products/12/3f9c.jpg".
+type Store interface {
+	// Put creates or replaces the file at key.
+	Put(key string, data []byte, contentType string) error
+	// Delete removes the file at key; deleting a missing file is not an error.
+	Delete(key string) error
+	// URL returns the address clients download the file at key from.
+	URL(key string) string
+}
+
+// Config selects and configures a Store (see New).
+type Config struct {
+	// Backend is "local" (the default) or "s3".
+	Backend string
+
+	// LocalDir is the directory local files are written to (default "media")
+	// and BaseURL the address they are served at (default "/media", served by
+	// the API itself).
+	LocalDir string
+	BaseURL  string
+
+	// S3 settings; PublicURL defaults to the bucket's path-style address.
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PublicURL       string
+}
+
+// New builds the store cfg.Backend names.
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		if cfg.LocalDir == "" {
+			cfg.LocalDir = "media"
+		}
+		return NewLocal(cfg.LocalDir, cfg.BaseURL)
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required")
+		}
+		if cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return nil, errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return NewS3(S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PublicURL:       cfg.S3PublicURL,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.Backend)
+	}
+}
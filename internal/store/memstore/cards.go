@@ -0,0 +1,210 @@
+package memstore
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CardStore implements store.CardStore.
+type CardStore struct {
+	db *DB
+}
+
+func (s *CardStore) Create(c *store.Card) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	hasDefault := false
+	for _, other := range s.db.cards {
+		if other.StripePaymentMethodID == c.StripePaymentMethodID ||
+			(c.Fingerprint != "" && other.UserID == c.UserID && other.Fingerprint == c.Fingerprint) {
+			return store.ErrConflict
+		}
+		hasDefault = hasDefault || (other.UserID == c.UserID && other.IsDefault)
+	}
+	c.ID = s.db.nextID("credit_cards")
+	c.IsDefault = !hasDefault
+	stored := *c
+	s.db.cards[c.ID] = &stored
+	return nil
+}
+
+func (s *CardStore) Get(cardID int) (*store.Card, error) {
+	return s.getBy(func(c *store.Card) bool { return c.ID == cardID })
+}
+
+func (s *CardStore) GetForUser(cardID, userID int) (*store.Card, error) {
+	return s.getBy(func(c *store.Card) bool { return c.ID == cardID && c.UserID == userID })
+}
+
+func (s *CardStore) GetByPaymentMethod(paymentMethodID string) (*store.Card, error) {
+	return s.getBy(func(c *store.Card) bool { return c.StripePaymentMethodID == paymentMethodID })
+}
+
+func (s *CardStore) GetByFingerprint(userID int, fingerprint string) (*store.Card, error) {
+	return s.getBy(func(c *store.Card) bool {
+		return c.UserID == userID && fingerprint != "" && c.Fingerprint == fingerprint
+	})
+}
+
+func (s *CardStore) GetDefault(userID int) (*store.Card, error) {
+	return s.getBy(func(c *store.Card) bool { return c.UserID == userID && c.IsDefault })
+}
+
+func (s *CardStore) getBy(match func(c *store.Card) bool) (*store.Card, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, c := range s.db.cards {
+		if match(c) {
+			card := *c
+			return &card, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *CardStore) ListForUser(userID int) ([]store.Card, error) {
+	cards := s.list(func(c *store.Card) bool { return c.UserID == userID })
+	slices.SortFunc(cards, func(a, b store.Card) int {
+		if a.IsDefault != b.IsDefault {
+			if a.IsDefault {
+				return -1
+			}
+			return 1
+		}
+		return b.ID - a.ID
+	})
+	return cards, nil
+}
+
+func (s *CardStore) ListUnexpired() ([]store.Card, error) {
+	return s.list(func(c *store.Card) bool { return c.ExpiryStatus != store.CardStatusExpired }), nil
+}
+
+// list returns the cards matching match, by ID.
+func (s *CardStore) list(match func(c *store.Card) bool) []store.Card {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	cards := make([]store.Card, 0)
+	for _, c := range s.db.cards {
+		if match(c) {
+			cards = append(cards, *c)
+		}
+	}
+	slices.SortFunc(cards, func(a, b store.Card) int { return a.ID - b.ID })
+	return cards
+}
+
+func (s *CardStore) SetDefault(userID, cardID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	card, ok := s.db.cards[cardID]
+	if !ok || card.UserID != userID {
+		return store.ErrNotFound
+	}
+	for _, c := range s.db.cards {
+		if c.UserID == userID {
+			c.IsDefault = false
+		}
+	}
+	card.IsDefault = true
+	return nil
+}
+
+func (s *CardStore) Delete(cardID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	card, ok := s.db.cards[cardID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	delete(s.db.cards, cardID)
+	s.db.cardEvents = slices.DeleteFunc(s.db.cardEvents, func(e cardExpiryEvent) bool { return e.CardID == cardID })
+	if !card.IsDefault {
+		return nil
+	}
+	if next := s.db.newestUnexpiredCard(card.UserID); next != nil {
+		next.IsDefault = true
+	}
+	return nil
+}
+
+// newestUnexpiredCard returns the user's most recently added card that has not
+// expired, or nil. Expired cards cannot be the default, whatever the expiry job
+// last flagged.
+func (db *DB) newestUnexpiredCard(userID int) *store.Card {
+	var newest *store.Card
+	for _, c := range db.cards {
+		if c.UserID == userID && c.ExpiryStatus != store.CardStatusExpired && !c.Expired(time.Now()) &&
+			(newest == nil || c.ID > newest.ID) {
+			newest = c
+		}
+	}
+	return newest
+}
+
+// cardExpiryEvent is a row of card_expiry_events.
+type cardExpiryEvent struct {
+	ID        int
+	CardID    int
+	UserID    int
+	Status    string
+	CreatedAt time.Time
+}
+
+func (s *CardStore) SetExpiryStatus(cardID int, status string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	c, ok := s.db.cards[cardID]
+	if !ok || c.ExpiryStatus == status {
+		return nil
+	}
+	c.ExpiryStatus = status
+	if status == store.CardStatusExpired && c.IsDefault {
+		if next := s.db.newestUnexpiredCard(c.UserID); next != nil {
+			c.IsDefault = false
+			next.IsDefault = true
+		}
+	}
+	if status != store.CardStatusValid {
+		s.db.cardEvents = append(s.db.cardEvents, cardExpiryEvent{
+			ID:        s.db.nextID("card_expiry_events"),
+			CardID:    cardID,
+			UserID:    c.UserID,
+			Status:    status,
+			CreatedAt: now(),
+		})
+	}
+	return nil
+}
+
+func (s *CardStore) ListExpiryEvents(userID int) ([]store.CardExpiryEvent, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	events := make([]store.CardExpiryEvent, 0)
+	for _, e := range slices.Backward(s.db.cardEvents) {
+		if e.UserID != userID {
+			continue
+		}
+		c := s.db.cards[e.CardID]
+		events = append(events, store.CardExpiryEvent{
+			ID:        e.ID,
+			CardID:    e.CardID,
+			Brand:     c.Brand,
+			Last4:     c.Last4,
+			ExpMonth:  c.ExpMonth,
+			ExpYear:   c.ExpYear,
+			Status:    e.Status,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,173 @@
+package memstore
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// cartItem is a row of cart_items.
+type cartItem struct {
+	ID         int
+	UserID     int
+	ProductID  int
+	VariantID  int
+	Quantity   int
+	PriceCents int
+	AddedAt    time.Time
+	// OrderID is the pending order the item was checked out in, if any.
+	OrderID int
+}
+
+// CartStore implements store.CartStore.
+type CartStore struct {
+	db *DB
+}
+
+// cartItemView returns an item with the price and stock of its variant, if
+// any, else of its product, and the pending order it is checked out in.
+// Archived products are never in stock.
+func (db *DB) cartItemView(it *cartItem) store.CartItem {
+	p := db.products[it.ProductID]
+	out := store.CartItem{
+		ID:          it.ID,
+		ProductID:   it.ProductID,
+		ProductName: p.Name,
+		VariantID:   it.VariantID,
+		Quantity:    it.Quantity,
+		PriceCents:  it.PriceCents,
+		AddedAt:     it.AddedAt,
+	}
+	unlimited, stock := p.UnlimitedStock, p.StockQuantity
+	if v, ok := db.variants[it.VariantID]; ok {
+		out.VariantSKU, out.VariantOptions = v.SKU, maps.Clone(v.Options)
+		unlimited, stock = v.UnlimitedStock, v.StockQuantity
+	}
+	out.CurrentPriceCents = db.itemPrice(p, it.VariantID)
+	out.InStock = p.ArchivedAt == nil && (unlimited || stock >= it.Quantity)
+	out.PriceChanged = out.PriceCents != out.CurrentPriceCents
+	if db.checkedOut(it) {
+		out.OrderID = it.OrderID
+	}
+	return out
+}
+
+// checkedOut reports whether an item is checked out in a pending order.
+func (db *DB) checkedOut(it *cartItem) bool {
+	o, ok := db.orders[it.OrderID]
+	return ok && o.Status == store.OrderStatusPending
+}
+
+// itemPrice is the current base price of a product, or of one of its variants.
+func (db *DB) itemPrice(p *product, variantID int) int {
+	if v, ok := db.variants[variantID]; ok {
+		return db.variantPrice(p, v, now())
+	}
+	view := store.Product{PriceCents: p.PriceCents, SalePriceCents: db.salePrice(p.ID, now())}
+	return view.PriceIn(money.Base, nil)
+}
+
+func (s *CartStore) List(userID int) ([]store.CartItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	items := make([]store.CartItem, 0)
+	for _, it := range s.db.cartItems {
+		if it.UserID == userID {
+			items = append(items, s.db.cartItemView(it))
+		}
+	}
+	slices.SortFunc(items, func(a, b store.CartItem) int { return a.ID - b.ID })
+	return items, nil
+}
+
+func (s *CartStore) Add(userID, productID, variantID, quantity int) (*store.CartItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// The variant must be one of the product's; products sold in variants
+	// are only added through one
+	p, ok := s.db.products[productID]
+	if !ok {
+		return nil, store.ProductNotFoundError(productID)
+	}
+	v, hasVariant := s.db.variants[variantID]
+	switch {
+	case p.ArchivedAt != nil:
+		return nil, store.ProductArchivedError(productID)
+	case variantID != 0 && (!hasVariant || v.ProductID != productID):
+		return nil, &store.VariantNotFoundError{ProductID: productID, VariantID: variantID}
+	case variantID == 0 && len(s.db.productVariants(productID)) > 0:
+		return nil, store.VariantRequiredError(productID)
+	}
+
+	for _, it := range s.db.cartItems {
+		if it.UserID == userID && it.ProductID == productID && it.VariantID == variantID {
+			it.Quantity += quantity
+			it.OrderID = 0
+			view := s.db.cartItemView(it)
+			return &view, nil
+		}
+	}
+	it := &cartItem{
+		ID:         s.db.nextID("cart_items"),
+		UserID:     userID,
+		ProductID:  productID,
+		VariantID:  variantID,
+		Quantity:   quantity,
+		PriceCents: s.db.itemPrice(p, variantID),
+		AddedAt:    now(),
+	}
+	s.db.cartItems[it.ID] = it
+	view := s.db.cartItemView(it)
+	return &view, nil
+}
+
+func (s *CartStore) SetQuantity(userID, itemID, quantity int) (*store.CartItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	it, ok := s.db.cartItems[itemID]
+	if !ok || it.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	it.Quantity, it.OrderID = quantity, 0
+	view := s.db.cartItemView(it)
+	return &view, nil
+}
+
+func (s *CartStore) Remove(userID, itemID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	it, ok := s.db.cartItems[itemID]
+	if !ok || it.UserID != userID {
+		return store.ErrNotFound
+	}
+	delete(s.db.cartItems, itemID)
+	return nil
+}
+
+func (s *CartStore) Clear(userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, it := range s.db.cartItems {
+		if it.UserID == userID {
+			delete(s.db.cartItems, id)
+		}
+	}
+	return nil
+}
+
+// removeCheckedOutItems deletes the cart items a paid order checked out.
+func (db *DB) removeCheckedOutItems(orderID int) {
+	for id, it := range db.cartItems {
+		if it.OrderID == orderID {
+			delete(db.cartItems, id)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package memstore
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CategoryStore implements store.CategoryStore.
+type CategoryStore struct {
+	db *DB
+}
+
+// categoryView returns a copy of a category with its product count.
+func (db *DB) categoryView(c *store.Category) store.Category {
+	out := *c
+	if c.ParentID != nil {
+		parentID := *c.ParentID
+		out.ParentID = &parentID
+	}
+	out.ProductCount = 0
+	for _, p := range db.products {
+		if p.ArchivedAt == nil && slices.Contains(p.CategoryIDs, c.ID) {
+			out.ProductCount++
+		}
+	}
+	return out
+}
+
+// categorySubtree returns the IDs of the category with slug and of all its
+// subcategories; empty for an unknown slug.
+func (db *DB) categorySubtree(slug string) map[int]bool {
+	ids := map[int]bool{}
+	for _, c := range db.categories {
+		if c.Slug == slug {
+			ids[c.ID] = true
+		}
+	}
+	for grew := true; grew; {
+		grew = false
+		for _, c := range db.categories {
+			if c.ParentID != nil && ids[*c.ParentID] && !ids[c.ID] {
+				ids[c.ID] = true
+				grew = true
+			}
+		}
+	}
+	return ids
+}
+
+func (s *CategoryStore) List() ([]store.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	categories := make([]store.Category, 0, len(s.db.categories))
+	for _, c := range s.db.categories {
+		categories = append(categories, s.db.categoryView(c))
+	}
+	slices.SortFunc(categories, func(a, b store.Category) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return categories, nil
+}
+
+func (s *CategoryStore) GetBySlug(slug string) (*store.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, c := range s.db.categories {
+		if c.Slug == slug {
+			view := s.db.categoryView(c)
+			return &view, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *CategoryStore) Create(in store.CategoryInput) (*store.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkCategoryParent(0, in.ParentID); err != nil {
+		return nil, err
+	}
+	if s.db.slugTaken(0, in.Slug) {
+		return nil, store.ErrConflict
+	}
+	c := &store.Category{ID: s.db.nextID("categories"), CreatedAt: now()}
+	setCategoryInput(c, in)
+	s.db.categories[c.ID] = c
+	view := s.db.categoryView(c)
+	return &view, nil
+}
+
+func (s *CategoryStore) Update(id int, in store.CategoryInput) (*store.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkCategoryParent(id, in.ParentID); err != nil {
+		return nil, err
+	}
+	if s.db.slugTaken(id, in.Slug) {
+		return nil, store.ErrConflict
+	}
+	c, ok := s.db.categories[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	setCategoryInput(c, in)
+	view := s.db.categoryView(c)
+	return &view, nil
+}
+
+// setCategoryInput sets the admin-editable fields of a category.
+func setCategoryInput(c *store.Category, in store.CategoryInput) {
+	c.Name, c.Slug, c.ParentID = in.Name, in.Slug, nil
+	if in.ParentID != nil {
+		parentID := *in.ParentID
+		c.ParentID = &parentID
+	}
+}
+
+// slugTaken reports whether a category other than exceptID has slug.
+func (db *DB) slugTaken(exceptID int, slug string) bool {
+	for _, c := range db.categories {
+		if c.ID != exceptID && c.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CategoryStore) Delete(id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.categories[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, c := range s.db.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return store.ErrCategoryNotEmpty
+		}
+	}
+	delete(s.db.categories, id)
+	for _, p := range s.db.products {
+		p.CategoryIDs = slices.DeleteFunc(p.CategoryIDs, func(c int) bool { return c == id })
+	}
+	return nil
+}
+
+// checkCategoryParent checks that parentID (if any) exists and, for an existing
+// category id, is not id itself or one of its subcategories.
+func (db *DB) checkCategoryParent(id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, ok := db.categories[*parentID]; !ok {
+		return store.CategoryNotFoundError(*parentID)
+	}
+	for ancestor := parentID; ancestor != nil; ancestor = db.categories[*ancestor].ParentID {
+		if *ancestor == id {
+			return store.ErrCategoryCycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package memstore
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CouponStore implements store.CouponStore.
+type CouponStore struct {
+	db *DB
+}
+
+// couponView returns a copy of a coupon with its redemption totals, in the
+// base currency; orders that failed do not count.
+func (db *DB) couponView(c *store.Coupon) store.Coupon {
+	out := *c
+	out.ProductIDs = slices.Clone(c.ProductIDs)
+	out.TimesRedeemed, out.DiscountedCents = 0, 0
+	for _, o := range db.orders {
+		if o.CouponID != c.ID || o.Status == store.OrderStatusFailed {
+			continue
+		}
+		out.TimesRedeemed++
+		if base, ok := db.toBase(o, o.DiscountCents); ok {
+			out.DiscountedCents += base
+		}
+	}
+	return out
+}
+
+func (s *CouponStore) Create(in store.CouponInput) (*store.Coupon, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkCoupon(0, in); err != nil {
+		return nil, err
+	}
+	c := &store.Coupon{ID: s.db.nextID("coupons"), CreatedAt: now()}
+	setCouponInput(c, in)
+	s.db.coupons[c.ID] = c
+	view := s.db.couponView(c)
+	return &view, nil
+}
+
+func (s *CouponStore) List() ([]store.Coupon, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	coupons := make([]store.Coupon, 0, len(s.db.coupons))
+	for _, c := range s.db.coupons {
+		coupons = append(coupons, s.db.couponView(c))
+	}
+	slices.SortFunc(coupons, func(a, b store.Coupon) int { return b.ID - a.ID })
+	return coupons, nil
+}
+
+func (s *CouponStore) Get(id int) (*store.Coupon, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	c, ok := s.db.coupons[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	view := s.db.couponView(c)
+	return &view, nil
+}
+
+func (s *CouponStore) Update(id int, in store.CouponInput) (*store.Coupon, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkCoupon(id, in); err != nil {
+		return nil, err
+	}
+	c, ok := s.db.coupons[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	setCouponInput(c, in)
+	view := s.db.couponView(c)
+	return &view, nil
+}
+
+func (s *CouponStore) Delete(id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.coupons[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.db.coupons, id)
+	return nil
+}
+
+// checkCoupon returns ErrConflict if a coupon other than exceptID has in's
+// code (case-insensitive), and ProductNotFoundError for an unknown restricted product.
+func (db *DB) checkCoupon(exceptID int, in store.CouponInput) error {
+	for _, c := range db.coupons {
+		if c.ID != exceptID && strings.EqualFold(c.Code, in.Code) {
+			return store.ErrConflict
+		}
+	}
+	for _, id := range in.ProductIDs {
+		if _, ok := db.products[id]; !ok {
+			return store.ProductNotFoundError(id)
+		}
+	}
+	return nil
+}
+
+// setCouponInput sets the admin-editable fields of a coupon.
+func setCouponInput(c *store.Coupon, in store.CouponInput) {
+	c.Code, c.DiscountType, c.Value, c.MinOrderCents = in.Code, in.DiscountType, in.Value, in.MinOrderCents
+	c.MaxRedemptions, c.MaxRedemptionsPerUser = in.MaxRedemptions, in.MaxRedemptionsPerUser
+	c.StartsAt, c.EndsAt, c.Active = in.StartsAt, in.EndsAt, in.Active
+	c.ProductIDs = uniqueIDs(in.ProductIDs)
+	slices.Sort(c.ProductIDs)
+	if c.ProductIDs == nil {
+		c.ProductIDs = []int{}
+	}
+}
+
+// couponByCode returns the coupon with code (case-insensitive) for a checkout
+// with how often it was redeemed, in total and by userID.
+func (db *DB) couponByCode(code string, userID int) (c *store.Coupon, redeemed, redeemedByUser int, err error) {
+	for _, candidate := range db.coupons {
+		if strings.EqualFold(candidate.Code, code) {
+			c = candidate
+		}
+	}
+	if c == nil {
+		return nil, 0, 0, store.CouponError("Coupon not found")
+	}
+	for _, o := range db.orders {
+		if o.CouponID == c.ID && o.Status != store.OrderStatusFailed {
+			redeemed++
+			if o.UserID == userID {
+				redeemedByUser++
+			}
+		}
+	}
+	return c, redeemed, redeemedByUser, nil
+}
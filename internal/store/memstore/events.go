@@ -0,0 +1,89 @@
+package memstore
+
+import (
+	"slices"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+func (s *OrderStore) SeenPaymentEvent(eventID string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.paymentEvents[eventID], nil
+}
+
+func (s *OrderStore) ApplyPaymentEvent(ev store.PaymentEvent) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Deduplicate by event ID: providers deliver at least once.
+	if s.db.paymentEvents[ev.ID] {
+		return false, nil
+	}
+	s.db.paymentEvents[ev.ID] = true
+
+	if ev.PaymentIntentID == "" {
+		return true, nil
+	}
+	o := s.db.orderByPaymentIntent(ev.PaymentIntentID)
+	// An order whose intent was created without us learning its ID gets it now
+	if byID, ok := s.db.orders[ev.OrderID]; o == nil && ok && byID.StripePaymentIntentID == "" {
+		byID.StripePaymentIntentID = ev.PaymentIntentID
+		o = byID
+	}
+	if o == nil {
+		return true, nil
+	}
+	switch ev.Type {
+	case store.PaymentEventSucceeded:
+		s.db.markOrderPaid(o)
+
+	case store.PaymentEventFailed:
+		s.db.failOrder(o)
+
+	case store.PaymentEventRefunded:
+		// Only orders that were paid can be refunded, and refunded_cents never
+		// goes down (e.g. when an older refund event arrives late).
+		if !slices.Contains(refundableOrderStatuses, o.Status) || o.RefundedCents > ev.AmountRefunded {
+			break
+		}
+		o.Status = store.OrderStatusPartiallyRefunded
+		if ev.FullyRefunded {
+			o.Status = store.OrderStatusRefunded
+		}
+		o.RefundedCents = ev.AmountRefunded
+
+	case store.PaymentEventDisputeCreated:
+		o.Status = store.OrderStatusDisputed
+	}
+	return true, nil
+}
+
+// refundableOrderStatuses are the statuses a refund event may move an order from.
+var refundableOrderStatuses = []string{
+	store.OrderStatusPaid,
+	store.OrderStatusPartiallyRefunded,
+	store.OrderStatusRefunded,
+	store.OrderStatusNeedsReview,
+}
+
+// markOrderPaid records a successful payment for an order. Pending orders
+// become paid. A failed order has already released its stock, so it takes the
+// stock back if it is still there and is otherwise left in needs_review for an
+// admin to refund. Other orders are never moved backwards. Either way the cart
+// items the order checked out are removed.
+func (db *DB) markOrderPaid(o *order) {
+	switch o.Status {
+	case store.OrderStatusPending:
+		o.Status = store.OrderStatusPaid
+	case store.OrderStatusFailed:
+		o.Status = store.OrderStatusNeedsReview
+		if db.reclaimOrderStock(o) {
+			o.Status = store.OrderStatusPaid
+		}
+	default:
+		return
+	}
+	db.removeCheckedOutItems(o.ID)
+}
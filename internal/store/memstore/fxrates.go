@@ -0,0 +1,105 @@
+package memstore
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// FXRateStore implements store.FXRateStore.
+type FXRateStore struct {
+	db *DB
+}
+
+func (s *FXRateStore) List() ([]store.FXRate, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	rates := make([]store.FXRate, 0, len(s.db.fxRates))
+	for _, r := range s.db.fxRates {
+		rates = append(rates, *r)
+	}
+	slices.SortFunc(rates, func(a, b store.FXRate) int { return strings.Compare(a.Currency, b.Currency) })
+	return rates, nil
+}
+
+func (s *FXRateStore) Get(currency string) (*store.FXRate, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	r, ok := s.db.fxRates[currency]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	rate := *r
+	return &rate, nil
+}
+
+func (s *FXRateStore) Set(currency, rate string) (*store.FXRate, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Rates are stored trimmed of trailing zeros, as read back from NUMERIC
+	if parsed, ok := money.ParseRate(rate); ok {
+		rate = money.FormatRate(parsed)
+	}
+	r := &store.FXRate{Currency: currency, Rate: rate, UpdatedAt: now()}
+	s.db.fxRates[currency] = r
+	out := *r
+	return &out, nil
+}
+
+func (s *FXRateStore) Delete(currency string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.fxRates[currency]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.db.fxRates, currency)
+	return nil
+}
+
+// fxRate returns the rate of currency for pricing an order in it; nil for the
+// base currency or a currency without a rate, which can still be sold at
+// explicit prices.
+func (db *DB) fxRate(currency string) (*big.Rat, error) {
+	if currency == money.Base {
+		return nil, nil
+	}
+	r, ok := db.fxRates[currency]
+	if !ok {
+		return nil, nil
+	}
+	rate, ok := money.ParseRate(r.Rate)
+	if !ok {
+		return nil, store.UnsupportedCurrencyError(currency)
+	}
+	return rate, nil
+}
+
+// orderRate returns the rate converting an order's amounts to the base
+// currency: the one it was priced at or, for an order priced without one, the
+// currency's current rate. ok is false when the currency has no rate.
+func (db *DB) orderRate(o *order) (rate *big.Rat, ok bool) {
+	if rate, ok := money.ParseRate(o.FXRate); ok {
+		return rate, true
+	}
+	if r, found := db.fxRates[o.Currency]; found {
+		return money.ParseRate(r.Rate)
+	}
+	return nil, false
+}
+
+// toBase converts an amount of an order's currency to the base currency at
+// its orderRate; ok is false when there is none.
+func (db *DB) toBase(o *order, cents int64) (base int64, ok bool) {
+	rate, ok := db.orderRate(o)
+	if !ok {
+		return 0, false
+	}
+	return money.ToBase(cents, rate), true
+}
@@ -0,0 +1,79 @@
+package memstore
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// idempotencyKey is the key of idempotency_keys.
+type idempotencyKey struct {
+	UserID int
+	Key    string
+}
+
+// idempotencyRecord is a row of idempotency_keys.
+type idempotencyRecord struct {
+	store.IdempotencyRecord
+	CreatedAt time.Time
+}
+
+// IdempotencyStore implements store.IdempotencyStore.
+type IdempotencyStore struct {
+	db *DB
+}
+
+func (s *IdempotencyStore) Claim(userID int, key, requestHash string, staleAfter time.Duration) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k := idempotencyKey{UserID: userID, Key: key}
+	if rec, ok := s.db.idempotencyKey[k]; ok {
+		stale := rec.Response == nil && rec.RequestHash == requestHash && rec.CreatedAt.Before(now().Add(-staleAfter))
+		if !stale {
+			return false, nil
+		}
+	}
+	s.db.idempotencyKey[k] = &idempotencyRecord{
+		IdempotencyRecord: store.IdempotencyRecord{RequestHash: requestHash},
+		CreatedAt:         now(),
+	}
+	return true, nil
+}
+
+func (s *IdempotencyStore) Get(userID int, key string) (*store.IdempotencyRecord, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	rec, ok := s.db.idempotencyKey[idempotencyKey{UserID: userID, Key: key}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	out := store.IdempotencyRecord{RequestHash: rec.RequestHash}
+	if rec.Response != nil {
+		resp := *rec.Response
+		resp.Body = bytes.Clone(resp.Body)
+		out.Response = &resp
+	}
+	return &out, nil
+}
+
+func (s *IdempotencyStore) Save(userID int, key string, resp store.StoredResponse) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if rec, ok := s.db.idempotencyKey[idempotencyKey{UserID: userID, Key: key}]; ok {
+		resp.Body = bytes.Clone(resp.Body)
+		rec.Response = &resp
+	}
+	return nil
+}
+
+func (s *IdempotencyStore) Release(userID int, key string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	delete(s.db.idempotencyKey, idempotencyKey{UserID: userID, Key: key})
+	return nil
+}
@@ -0,0 +1,124 @@
+package memstore
+
+import (
+	"slices"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// ProductImageStore implements store.ProductImageStore.
+type ProductImageStore struct {
+	db *DB
+}
+
+// productImages returns copies of a product's images in display order.
+func (db *DB) productImages(productID int) []store.ProductImage {
+	images := make([]store.ProductImage, 0)
+	for _, img := range db.images {
+		if img.ProductID == productID {
+			images = append(images, *img)
+		}
+	}
+	slices.SortFunc(images, func(a, b store.ProductImage) int {
+		if a.Position != b.Position {
+			return a.Position - b.Position
+		}
+		return a.ID - b.ID
+	})
+	return images
+}
+
+func (s *ProductImageStore) List(productID int) ([]store.ProductImage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.productImages(productID), nil
+}
+
+func (s *ProductImageStore) Create(img *store.ProductImage, primary bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[img.ProductID]; !ok {
+		return store.ErrNotFound
+	}
+	images := s.db.productImages(img.ProductID)
+	hasPrimary := slices.ContainsFunc(images, func(i store.ProductImage) bool { return i.IsPrimary })
+
+	img.IsPrimary = primary || !hasPrimary
+	if img.IsPrimary {
+		s.db.clearPrimaryImage(img.ProductID)
+	}
+	img.ID = s.db.nextID("product_images")
+	img.Position = 1
+	for _, other := range images {
+		img.Position = max(img.Position, other.Position+1)
+	}
+	stored := *img
+	s.db.images[img.ID] = &stored
+	return nil
+}
+
+func (s *ProductImageStore) SetPrimary(productID, imageID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	img, ok := s.db.images[imageID]
+	if !ok || img.ProductID != productID {
+		return store.ErrNotFound
+	}
+	s.db.clearPrimaryImage(productID)
+	img.IsPrimary = true
+	return nil
+}
+
+// clearPrimaryImage unsets the primary image of a product.
+func (db *DB) clearPrimaryImage(productID int) {
+	for _, img := range db.images {
+		if img.ProductID == productID {
+			img.IsPrimary = false
+		}
+	}
+}
+
+func (s *ProductImageStore) Reorder(productID int, imageIDs []int) ([]store.ProductImage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[productID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	// The new order must be a permutation of the product's images
+	var have []int
+	for _, img := range s.db.productImages(productID) {
+		have = append(have, img.ID)
+	}
+	want := slices.Clone(imageIDs)
+	slices.Sort(have)
+	slices.Sort(want)
+	if !slices.Equal(have, want) {
+		return nil, store.ErrImageOrder
+	}
+
+	for i, id := range imageIDs {
+		s.db.images[id].Position = i + 1
+	}
+	return s.db.productImages(productID), nil
+}
+
+func (s *ProductImageStore) Delete(productID, imageID int) (*store.ProductImage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	img, ok := s.db.images[imageID]
+	if !ok || img.ProductID != productID {
+		return nil, store.ErrNotFound
+	}
+	delete(s.db.images, imageID)
+	if img.IsPrimary {
+		if rest := s.db.productImages(productID); len(rest) > 0 {
+			s.db.images[rest[0].ID].IsPrimary = true
+		}
+	}
+	deleted := *img
+	return &deleted, nil
+}
@@ -0,0 +1,115 @@
+// Package memstore implements the store interfaces in memory, for handler
+// tests. It follows the Postgres stores' semantics where tests can observe
+// them (errors, stock reservation, order and refund bookkeeping) and keeps the
+// rest simple: search is a case-insensitive word-prefix match without ranking
+// by relevance, highlighting or typo tolerance.
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// DB is one in-memory database shared by every store it returns. A single
+// mutex serializes all operations, standing in for Postgres' row locks.
+type DB struct {
+	mu  sync.Mutex
+	ids map[string]int
+
+	users          map[int]*store.User
+	admins         map[int]bool
+	products       map[int]*product
+	images         map[int]*store.ProductImage
+	variants       map[int]*store.ProductVariant
+	schedules      map[int]*store.PriceSchedule
+	priceHistory   []store.PriceChange
+	categories     map[int]*store.Category
+	tags           map[int]*store.Tag
+	cards          map[int]*store.Card
+	cardEvents     []cardExpiryEvent
+	cartItems      map[int]*cartItem
+	coupons        map[int]*store.Coupon
+	fxRates        map[string]*store.FXRate
+	orders         map[int]*order
+	refunds        []store.Refund
+	stockLog       []stockAdjustment
+	paymentEvents  map[string]bool
+	refreshTokens  map[string]*refreshToken
+	revokedTokens  map[string]time.Time
+	idempotencyKey map[idempotencyKey]*idempotencyRecord
+}
+
+// New returns an empty database.
+func New() *DB {
+	return &DB{
+		ids:            map[string]int{},
+		users:          map[int]*store.User{},
+		admins:         map[int]bool{},
+		products:       map[int]*product{},
+		images:         map[int]*store.ProductImage{},
+		variants:       map[int]*store.ProductVariant{},
+		schedules:      map[int]*store.PriceSchedule{},
+		categories:     map[int]*store.Category{},
+		tags:           map[int]*store.Tag{},
+		cards:          map[int]*store.Card{},
+		cartItems:      map[int]*cartItem{},
+		coupons:        map[int]*store.Coupon{},
+		fxRates:        map[string]*store.FXRate{},
+		orders:         map[int]*order{},
+		paymentEvents:  map[string]bool{},
+		refreshTokens:  map[string]*refreshToken{},
+		revokedTokens:  map[string]time.Time{},
+		idempotencyKey: map[idempotencyKey]*idempotencyRecord{},
+	}
+}
+
+// Stores returns every store backed by db.
+func (db *DB) Stores() store.Stores {
+	return store.Stores{
+		Users:           &UserStore{db: db},
+		Admins:          &AdminStore{db: db},
+		Products:        &ProductStore{db: db},
+		Images:          &ProductImageStore{db: db},
+		Variants:        &ProductVariantStore{db: db},
+		PriceSchedules:  &PriceScheduleStore{db: db},
+		Cards:           &CardStore{db: db},
+		Carts:           &CartStore{db: db},
+		Categories:      &CategoryStore{db: db},
+		Tags:            &TagStore{db: db},
+		Coupons:         &CouponStore{db: db},
+		FXRates:         &FXRateStore{db: db},
+		Orders:          &OrderStore{db: db},
+		Tokens:          &TokenStore{db: db},
+		IdempotencyKeys: &IdempotencyStore{db: db},
+	}
+}
+
+// GrantAdmin makes a user an admin; admins are not managed through the API.
+func (db *DB) GrantAdmin(userID int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.admins[userID] = true
+}
+
+// nextID returns the next ID of a table, starting at 1 like a SERIAL column.
+func (db *DB) nextID(table string) int {
+	db.ids[table]++
+	return db.ids[table]
+}
+
+// now is the current time in UTC, as TIMESTAMP columns hold it.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// stockAdjustment is a row of the stock audit trail.
+type stockAdjustment struct {
+	ProductID int
+	VariantID int
+	Delta     int
+	Reason    string
+	AdminID   int
+	OrderID   int
+}
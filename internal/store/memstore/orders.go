@@ -0,0 +1,557 @@
+package memstore
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// Reasons recorded in the stock audit trail for stock moved by orders.
+const (
+	stockReasonOrderReserved = "order_reserved"
+	stockReasonOrderReleased = "order_released"
+	stockReasonOrderRefunded = "order_refunded"
+)
+
+// order is a row of orders with its lines and redeemed coupon.
+type order struct {
+	store.Order
+	Lines     []orderLine
+	CouponID  int
+	CreatedAt time.Time
+}
+
+// orderLine is a row of order_lines. A line of a variant deleted since keeps
+// its VariantSKU with a zero VariantID.
+type orderLine struct {
+	store.OrderLine
+	RefundedQty int
+}
+
+// view returns a copy of the order with its lines.
+func (o *order) view() store.Order {
+	out := o.Order
+	out.Lines = make([]store.OrderLine, len(o.Lines))
+	for i, l := range o.Lines {
+		out.Lines[i] = l.OrderLine
+		out.Lines[i].VariantOptions = maps.Clone(l.VariantOptions)
+		out.Lines[i].Taxes = slices.Clone(l.Taxes)
+	}
+	return out
+}
+
+// OrderStore implements store.OrderStore.
+type OrderStore struct {
+	db *DB
+}
+
+func (s *OrderStore) CreatePending(in store.NewOrder) (*store.Order, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	o := &order{
+		Order: store.Order{
+			UserID:   in.UserID,
+			Status:   store.OrderStatusPending,
+			Currency: in.Currency,
+		},
+		CreatedAt: now(),
+	}
+	rate, err := s.db.fxRate(in.Currency)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case in.Currency == money.Base:
+		o.FXRate = "1"
+	case rate != nil:
+		o.FXRate = money.FormatRate(rate)
+	}
+
+	for _, id := range in.CartItemIDs {
+		if it, ok := s.db.cartItems[id]; ok && it.UserID == in.UserID && s.db.checkedOut(it) {
+			return nil, store.ErrCartCheckedOut
+		}
+	}
+
+	lines, total, err := s.db.priceLines(in.Items, in.Currency, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.CouponCode != "" {
+		stored, redeemed, redeemedByUser, err := s.db.couponByCode(in.CouponCode, in.UserID)
+		if err != nil {
+			return nil, err
+		}
+		// Coupon amounts are in the base currency
+		c := *stored
+		if rate == nil && in.Currency != money.Base && c.HasBaseAmounts() {
+			return nil, store.UnsupportedCurrencyError(in.Currency)
+		}
+		if rate != nil {
+			c.MinOrderCents = int(money.Convert(int64(c.MinOrderCents), rate))
+			if c.DiscountType == store.CouponFixed {
+				c.Value = int(money.Convert(int64(c.Value), rate))
+			}
+		}
+		if o.DiscountCents, err = c.Apply(time.Now(), lines, redeemed, redeemedByUser); err != nil {
+			return nil, err
+		}
+		o.CouponID, o.CouponCode = c.ID, c.Code
+	}
+
+	// Tax is charged on what is paid, i.e. after the discount
+	o.TaxProvince = in.Province
+	for i := range lines {
+		li := &lines[i]
+		li.Taxes = tax.Line(in.Province, li.TaxCategory, li.Subtotal-li.DiscountCents)
+		for _, t := range li.Taxes {
+			li.TaxCents += t.AmountCents
+		}
+		o.TaxCents += li.TaxCents
+	}
+	o.TotalCents = total - o.DiscountCents + o.TaxCents
+
+	// Nothing can fail from here on, so the stock is only taken now
+	s.db.reserveStock(in.Items)
+	o.ID = s.db.nextID("orders")
+	for _, li := range lines {
+		li.ID = s.db.nextID("order_lines")
+		o.Lines = append(o.Lines, orderLine{OrderLine: li})
+	}
+	s.db.orders[o.ID] = o
+	s.db.logOrderStock(o, -1, stockReasonOrderReserved)
+	for _, id := range in.CartItemIDs {
+		if it, ok := s.db.cartItems[id]; ok && it.UserID == in.UserID {
+			it.OrderID = o.ID
+		}
+	}
+
+	view := o.view()
+	return &view, nil
+}
+
+// stockKey identifies what an order line takes stock from: a product, or one
+// of its variants.
+type stockKey struct {
+	ProductID int
+	VariantID int
+}
+
+// priceLines checks that items can be ordered and returns their order lines
+// priced in currency (see store.Product.PriceIn and VariantPriceIn) and their
+// total, like the Postgres store's reserveStock, including its handling of
+// ExpectedPriceCents and of a nil rate. It takes no stock.
+func (db *DB) priceLines(items []store.BuyItem, currency string, rate *big.Rat) ([]store.OrderLine, int64, error) {
+	requested := map[stockKey]int{}
+	expected := map[stockKey]int{}
+	var keys []stockKey
+	for _, it := range items {
+		key := stockKey{it.ProductID, it.VariantID}
+		if _, seen := requested[key]; !seen {
+			keys = append(keys, key)
+		}
+		requested[key] += it.Quantity
+		if it.ExpectedPriceCents != nil {
+			expected[key] = *it.ExpectedPriceCents
+		}
+	}
+
+	var (
+		shortfalls []store.StockShortfall
+		mismatches []store.PriceMismatch
+	)
+	for _, key := range keys {
+		p, ok := db.products[key.ProductID]
+		if !ok {
+			return nil, 0, store.ProductNotFoundError(key.ProductID)
+		}
+		if p.ArchivedAt != nil {
+			return nil, 0, store.ProductArchivedError(key.ProductID)
+		}
+		stock, unlimited := p.StockQuantity, p.UnlimitedStock
+		var v *store.ProductVariant
+		if key.VariantID != 0 {
+			var ok bool
+			v, ok = db.variants[key.VariantID]
+			if !ok || v.ProductID != key.ProductID {
+				return nil, 0, &store.VariantNotFoundError{ProductID: key.ProductID, VariantID: key.VariantID}
+			}
+			stock, unlimited = v.StockQuantity, v.UnlimitedStock
+		} else if len(db.productVariants(key.ProductID)) > 0 {
+			return nil, 0, store.VariantRequiredError(key.ProductID)
+		}
+		if view := db.productView(p); rate == nil && view.NeedsRate(currency) {
+			return nil, 0, store.UnsupportedCurrencyError(currency)
+		}
+		if want, ok := expected[key]; ok {
+			if price := db.itemPrice(p, key.VariantID); price != want {
+				mismatches = append(mismatches, store.PriceMismatch{
+					ProductID:     key.ProductID,
+					VariantID:     key.VariantID,
+					ExpectedCents: want,
+					CurrentCents:  price,
+				})
+			}
+		}
+		if !unlimited && stock < requested[key] {
+			shortfalls = append(shortfalls, store.StockShortfall{
+				ProductID: key.ProductID,
+				VariantID: key.VariantID,
+				Requested: requested[key],
+				Available: stock,
+			})
+		}
+	}
+	if len(mismatches) > 0 {
+		return nil, 0, &store.PriceChangedError{Items: mismatches}
+	}
+	if len(shortfalls) > 0 {
+		return nil, 0, &store.InsufficientStockError{Items: shortfalls}
+	}
+
+	var total int64
+	lines := make([]store.OrderLine, 0, len(items))
+	for _, it := range items {
+		p := db.products[it.ProductID]
+		view := db.productView(p)
+		line := store.OrderLine{
+			ProductID:   it.ProductID,
+			ProductName: p.Name,
+			Quantity:    it.Quantity,
+			TaxCategory: p.TaxCategory,
+		}
+		if v, ok := db.variants[it.VariantID]; ok {
+			line.VariantID, line.VariantSKU, line.VariantOptions = v.ID, v.SKU, maps.Clone(v.Options)
+			line.UnitPriceCents = int64(view.VariantPriceIn(v, currency, rate))
+		} else {
+			line.UnitPriceCents = int64(view.PriceIn(currency, rate))
+		}
+		line.Subtotal = line.UnitPriceCents * int64(it.Quantity)
+		total += line.Subtotal
+		lines = append(lines, line)
+	}
+	return lines, total, nil
+}
+
+// reserveStock takes the stock of items checked by priceLines: a variant's own
+// stock, or the product's for products sold without variants.
+func (db *DB) reserveStock(items []store.BuyItem) {
+	for _, it := range items {
+		if v, ok := db.variants[it.VariantID]; ok {
+			if !v.UnlimitedStock {
+				v.StockQuantity -= it.Quantity
+			}
+		} else if p := db.products[it.ProductID]; !p.UnlimitedStock {
+			p.StockQuantity -= it.Quantity
+		}
+	}
+}
+
+// orderStock is the stock each limited-stock line of an order took, per
+// product and variant. Lines of variants deleted since are left out: their
+// stock is gone with them.
+func (db *DB) orderStock(o *order) (keys []stockKey, quantities map[stockKey]int) {
+	quantities = map[stockKey]int{}
+	for _, l := range o.Lines {
+		p, ok := db.products[l.ProductID]
+		if !ok || (l.VariantID == 0 && l.VariantSKU != "") {
+			continue
+		}
+		unlimited := p.UnlimitedStock
+		if v, ok := db.variants[l.VariantID]; ok {
+			unlimited = v.UnlimitedStock
+		}
+		if unlimited {
+			continue
+		}
+		key := stockKey{l.ProductID, l.VariantID}
+		if _, seen := quantities[key]; !seen {
+			keys = append(keys, key)
+		}
+		quantities[key] += l.Quantity
+	}
+	return keys, quantities
+}
+
+// stockOf returns the stock counter a stock key refers to.
+func (db *DB) stockOf(key stockKey) *int {
+	if key.VariantID != 0 {
+		return &db.variants[key.VariantID].StockQuantity
+	}
+	return &db.products[key.ProductID].StockQuantity
+}
+
+// logOrderStock records the stock movement of every limited-stock line of an
+// order. sign is -1 for a reservation and +1 for a release.
+func (db *DB) logOrderStock(o *order, sign int, reason string) {
+	keys, quantities := db.orderStock(o)
+	for _, key := range keys {
+		db.stockLog = append(db.stockLog, stockAdjustment{
+			ProductID: key.ProductID, VariantID: key.VariantID, Delta: sign * quantities[key], Reason: reason, OrderID: o.ID,
+		})
+	}
+}
+
+// releaseOrderStock puts the stock reserved by an order back on the shelf.
+func (db *DB) releaseOrderStock(o *order) {
+	keys, quantities := db.orderStock(o)
+	for _, key := range keys {
+		*db.stockOf(key) += quantities[key]
+	}
+	db.logOrderStock(o, 1, stockReasonOrderReleased)
+}
+
+// reclaimOrderStock takes the stock of a failed order again, as checkout did.
+// It reports false, taking nothing, when a line is no longer in stock.
+func (db *DB) reclaimOrderStock(o *order) bool {
+	keys, quantities := db.orderStock(o)
+	for _, key := range keys {
+		if *db.stockOf(key) < quantities[key] {
+			return false
+		}
+	}
+	for _, key := range keys {
+		*db.stockOf(key) -= quantities[key]
+	}
+	db.logOrderStock(o, -1, stockReasonOrderReserved)
+	return true
+}
+
+func (s *OrderStore) SetPaymentIntent(orderID int, paymentIntentID, status string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Orders that already left pending (e.g. through a webhook) keep their status.
+	if o, ok := s.db.orders[orderID]; ok && o.Status == store.OrderStatusPending {
+		o.StripePaymentIntentID, o.Status = paymentIntentID, status
+		if status == store.OrderStatusPaid {
+			s.db.removeCheckedOutItems(o.ID)
+		}
+	}
+	return nil
+}
+
+func (s *OrderStore) Fail(orderID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if o, ok := s.db.orders[orderID]; ok {
+		s.db.failOrder(o)
+	}
+	return nil
+}
+
+func (s *OrderStore) FailAbandoned(olderThan time.Duration, cancel func(paymentIntentID string) bool) ([]int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var ids []int
+	cutoff := now().Add(-olderThan)
+	for _, o := range s.db.orders {
+		if o.Status != store.OrderStatusPending || !o.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if o.StripePaymentIntentID != "" && !cancel(o.StripePaymentIntentID) {
+			continue
+		}
+		s.db.failOrder(o)
+		ids = append(ids, o.ID)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// failOrder marks a pending order as failed and releases its stock reservation.
+// Orders that are no longer pending are left untouched.
+func (db *DB) failOrder(o *order) {
+	if o.Status != store.OrderStatusPending {
+		return
+	}
+	o.Status = store.OrderStatusFailed
+	db.releaseOrderStock(o)
+}
+
+// orderByPaymentIntent returns the order paid with paymentIntentID, if any.
+func (db *DB) orderByPaymentIntent(paymentIntentID string) *order {
+	for _, o := range db.orders {
+		if o.StripePaymentIntentID == paymentIntentID {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *OrderStore) GetForUser(orderID, userID int) (*store.Order, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	o, ok := s.db.orders[orderID]
+	if !ok || o.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	// Like the Postgres store, the order is returned without its lines
+	out := o.Order
+	out.Lines = nil
+	return &out, nil
+}
+
+// sortedOrders returns the orders matching match, newest first.
+func (db *DB) sortedOrders(match func(o *order) bool) []*order {
+	var orders []*order
+	for _, o := range db.orders {
+		if match(o) {
+			orders = append(orders, o)
+		}
+	}
+	slices.SortFunc(orders, func(a, b *order) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	})
+	return orders
+}
+
+// lineVariant returns the variant fields of a history or sales row.
+func lineVariant(l orderLine) (*int, string, map[string]string) {
+	var id *int
+	if l.VariantID != 0 {
+		v := l.VariantID
+		id = &v
+	}
+	return id, l.VariantSKU, maps.Clone(l.VariantOptions)
+}
+
+func (s *OrderStore) ListHistory(userID int) ([]store.HistoryItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	history := make([]store.HistoryItem, 0)
+	for _, o := range s.db.sortedOrders(func(o *order) bool { return o.UserID == userID }) {
+		for _, l := range o.Lines {
+			item := store.HistoryItem{
+				OrderID:         o.ID,
+				OrderLineID:     l.ID,
+				OrderStatus:     o.Status,
+				ProductID:       l.ProductID,
+				ProductName:     l.ProductName,
+				Quantity:        l.Quantity,
+				UnitPriceCents:  l.UnitPriceCents,
+				TotalPriceCents: l.Subtotal,
+				DiscountCents:   l.DiscountCents,
+				TaxCents:        l.TaxCents,
+				CouponCode:      o.CouponCode,
+				RefundedQty:     l.RefundedQty,
+				OrderRefunded:   o.RefundedCents,
+				Currency:        o.Currency,
+				PurchasedAt:     o.CreatedAt,
+			}
+			item.VariantID, item.VariantSKU, item.VariantOptions = lineVariant(l)
+			history = append(history, item)
+		}
+	}
+	return history, nil
+}
+
+// salesMatch reports whether an order passes a SalesFilter.
+func (db *DB) salesMatch(o *order, filter store.SalesFilter) bool {
+	switch {
+	case !filter.From.IsZero() && o.CreatedAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !o.CreatedAt.Before(filter.To):
+		return false
+	case filter.Username != "" && db.users[o.UserID].Username != filter.Username:
+		return false
+	case filter.CouponCode != "" && !strings.EqualFold(o.CouponCode, filter.CouponCode):
+		return false
+	case filter.Currency != "" && o.Currency != filter.Currency:
+		return false
+	}
+	return true
+}
+
+func (s *OrderStore) ListSales(filter store.SalesFilter) ([]store.SaleRecord, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	sales := make([]store.SaleRecord, 0)
+	for _, o := range s.db.sortedOrders(func(o *order) bool { return s.db.salesMatch(o, filter) }) {
+		for _, l := range o.Lines {
+			r := store.SaleRecord{
+				OrderID:         o.ID,
+				OrderLineID:     l.ID,
+				OrderStatus:     o.Status,
+				ProductID:       l.ProductID,
+				ProductName:     l.ProductName,
+				UserID:          o.UserID,
+				Username:        s.db.users[o.UserID].Username,
+				Quantity:        l.Quantity,
+				UnitPriceCents:  l.UnitPriceCents,
+				TotalPriceCents: l.Subtotal,
+				DiscountCents:   l.DiscountCents,
+				TaxCents:        l.TaxCents,
+				CouponCode:      o.CouponCode,
+				RefundedQty:     l.RefundedQty,
+				OrderRefunded:   o.RefundedCents,
+				Currency:        o.Currency,
+				PurchasedAt:     o.CreatedAt,
+			}
+			if base, ok := s.db.toBase(o, l.Subtotal); ok {
+				r.BaseTotalPriceCents = &base
+			}
+			r.VariantID, r.VariantSKU, r.VariantOptions = lineVariant(l)
+			sales = append(sales, r)
+		}
+	}
+	return sales, nil
+}
+
+// paidOrderStatuses are the statuses of orders whose payment (and tax) was collected.
+var paidOrderStatuses = []string{
+	store.OrderStatusPaid,
+	store.OrderStatusPartiallyRefunded,
+	store.OrderStatusRefunded,
+	store.OrderStatusDisputed,
+	store.OrderStatusNeedsReview,
+}
+
+func (s *OrderStore) SalesTotals(filter store.SalesFilter) ([]store.CurrencySalesTotal, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	byCurrency := map[string]*store.CurrencySalesTotal{}
+	for _, o := range s.db.orders {
+		if !slices.Contains(paidOrderStatuses, o.Status) || !s.db.salesMatch(o, filter) {
+			continue
+		}
+		t, ok := byCurrency[o.Currency]
+		if !ok {
+			t = &store.CurrencySalesTotal{Currency: o.Currency}
+			byCurrency[o.Currency] = t
+		}
+		t.Orders++
+		t.GrossCents += o.TotalCents - o.TaxCents + o.DiscountCents
+		t.DiscountCents += o.DiscountCents
+		t.TaxCents += o.TaxCents
+		t.RefundedCents += o.RefundedCents
+		t.NetCents += o.TotalCents - o.RefundedCents
+		if base, ok := s.db.toBase(o, o.TotalCents-o.RefundedCents); ok {
+			t.BaseNetCents += base
+		}
+	}
+
+	totals := make([]store.CurrencySalesTotal, 0, len(byCurrency))
+	for _, t := range byCurrency {
+		totals = append(totals, *t)
+	}
+	slices.SortFunc(totals, func(a, b store.CurrencySalesTotal) int { return strings.Compare(a.Currency, b.Currency) })
+	return totals, nil
+}
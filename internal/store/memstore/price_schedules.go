@@ -0,0 +1,96 @@
+package memstore
+
+import (
+	"slices"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// PriceScheduleStore implements store.PriceScheduleStore.
+type PriceScheduleStore struct {
+	db *DB
+}
+
+// scheduleView returns a copy of a schedule with its current status.
+func scheduleView(ps *store.PriceSchedule) store.PriceSchedule {
+	out := *ps
+	out.Status = ps.StatusAt(now())
+	return out
+}
+
+func (s *PriceScheduleStore) List(productID int) ([]store.PriceSchedule, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[productID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	schedules := make([]store.PriceSchedule, 0)
+	for _, ps := range s.db.schedules {
+		if ps.ProductID == productID {
+			schedules = append(schedules, scheduleView(ps))
+		}
+	}
+	slices.SortFunc(schedules, func(a, b store.PriceSchedule) int {
+		if c := a.StartsAt.Compare(b.StartsAt); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return schedules, nil
+}
+
+func (s *PriceScheduleStore) Create(productID int, in store.PriceScheduleInput) (*store.PriceSchedule, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[productID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	// A nil end is open-ended; cancelled schedules no longer count
+	for _, other := range s.db.schedules {
+		if other.ProductID != productID || other.CancelledAt != nil {
+			continue
+		}
+		if (other.EndsAt == nil || other.EndsAt.After(in.StartsAt)) &&
+			(in.EndsAt == nil || other.StartsAt.Before(*in.EndsAt)) {
+			return nil, store.ErrScheduleOverlap
+		}
+	}
+
+	ps := &store.PriceSchedule{
+		ID:             s.db.nextID("price_schedules"),
+		ProductID:      productID,
+		SalePriceCents: in.SalePriceCents,
+		StartsAt:       in.StartsAt.UTC(),
+		CreatedAt:      now(),
+	}
+	if in.EndsAt != nil {
+		end := in.EndsAt.UTC()
+		ps.EndsAt = &end
+	}
+	if in.AdminID != 0 {
+		adminID := in.AdminID
+		ps.AdminUserID = &adminID
+	}
+	s.db.schedules[ps.ID] = ps
+	view := scheduleView(ps)
+	return &view, nil
+}
+
+func (s *PriceScheduleStore) Cancel(productID, scheduleID int) (*store.PriceSchedule, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	ps, ok := s.db.schedules[scheduleID]
+	if !ok || ps.ProductID != productID {
+		return nil, store.ErrNotFound
+	}
+	if status := ps.StatusAt(now()); status == store.PriceScheduleEnded || status == store.PriceScheduleCancelled {
+		return nil, store.ErrScheduleEnded
+	}
+	t := now()
+	ps.CancelledAt = &t
+	view := scheduleView(ps)
+	return &view, nil
+}
@@ -0,0 +1,469 @@
+package memstore
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// cursorTimeLayout is how created_at cursor values are written, as Postgres
+// casts a timestamp to text.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// product is a row of products with its explicit prices, options and
+// assignments. Its categories and tags are kept by ID, so renames show.
+type product struct {
+	ID             int
+	Name           string
+	Description    string
+	PriceCents     int
+	StockQuantity  int
+	UnlimitedStock bool
+	TaxCategory    string
+	Prices         map[string]int
+	Options        []store.ProductOption
+	CategoryIDs    []int
+	TagIDs         []int
+	CreatedAt      time.Time
+	ArchivedAt     *time.Time
+}
+
+// ProductStore implements store.ProductStore.
+type ProductStore struct {
+	db *DB
+}
+
+// runningSchedule returns the price schedule of a product running at t, if any.
+func (db *DB) runningSchedule(productID int, t time.Time) *store.PriceSchedule {
+	for _, s := range db.schedules {
+		if s.ProductID == productID && s.StatusAt(t) == store.PriceScheduleActive {
+			return s
+		}
+	}
+	return nil
+}
+
+// salePrice returns the base-currency sale price of a product at t, if any.
+func (db *DB) salePrice(productID int, t time.Time) *int {
+	if s := db.runningSchedule(productID, t); s != nil {
+		price := s.SalePriceCents
+		return &price
+	}
+	return nil
+}
+
+// variantPrice is the base price a variant sells at, at t (see
+// store.Product.VariantPriceIn).
+func (db *DB) variantPrice(p *product, v *store.ProductVariant, t time.Time) int {
+	view := store.Product{PriceCents: p.PriceCents, SalePriceCents: db.salePrice(p.ID, t)}
+	return view.VariantPriceIn(v, money.Base, nil)
+}
+
+// productView assembles a product as the Postgres store reads it.
+func (db *DB) productView(p *product) store.Product {
+	t := now()
+	out := store.Product{
+		ID:                 p.ID,
+		Name:               p.Name,
+		Description:        p.Description,
+		PriceCents:         p.PriceCents,
+		OriginalPriceCents: p.PriceCents,
+		Currency:           money.Base,
+		SalePriceCents:     db.salePrice(p.ID, t),
+		StockQuantity:      p.StockQuantity,
+		UnlimitedStock:     p.UnlimitedStock,
+		TaxCategory:        p.TaxCategory,
+		Categories:         []store.ProductCategory{},
+		Tags:               []string{},
+		Images:             []store.ProductImage{},
+		Options:            []store.ProductOption{},
+		Variants:           []store.ProductVariant{},
+		CreatedAt:          p.CreatedAt,
+		ArchivedAt:         p.ArchivedAt,
+	}
+	if s := db.runningSchedule(p.ID, t); s != nil {
+		out.SaleEndsAt = s.EndsAt
+	}
+	if len(p.Prices) > 0 {
+		out.Prices = maps.Clone(p.Prices)
+	}
+
+	for _, id := range p.CategoryIDs {
+		if c, ok := db.categories[id]; ok {
+			out.Categories = append(out.Categories, store.ProductCategory{ID: c.ID, Slug: c.Slug, Name: c.Name})
+		}
+	}
+	slices.SortFunc(out.Categories, func(a, b store.ProductCategory) int { return strings.Compare(a.Name, b.Name) })
+	for _, id := range p.TagIDs {
+		if tag, ok := db.tags[id]; ok {
+			out.Tags = append(out.Tags, tag.Name)
+		}
+	}
+	slices.Sort(out.Tags)
+
+	out.Images = db.productImages(p.ID)
+	for _, o := range p.Options {
+		out.Options = append(out.Options, store.ProductOption{Name: o.Name, Values: slices.Clone(o.Values)})
+	}
+	for _, v := range db.productVariants(p.ID) {
+		out.Variants = append(out.Variants, db.variantView(p, v))
+	}
+	return out
+}
+
+func (s *ProductStore) List(q store.ProductQuery) (*store.ProductPage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	currency := q.Currency
+	if currency == "" {
+		currency = money.Base
+	}
+	var inCategory map[int]bool
+	if q.CategorySlug != "" {
+		inCategory = s.db.categorySubtree(q.CategorySlug)
+	}
+
+	var matches []store.Product
+	for _, p := range s.db.products {
+		if (p.ArchivedAt != nil) != q.Archived {
+			continue
+		}
+		if inCategory != nil && !slices.ContainsFunc(p.CategoryIDs, func(id int) bool { return inCategory[id] }) {
+			continue
+		}
+		if q.Tag != "" && !slices.ContainsFunc(p.TagIDs, func(id int) bool {
+			return s.db.tags[id] != nil && s.db.tags[id].Name == q.Tag
+		}) {
+			continue
+		}
+		view := s.db.productView(p)
+		price := view.PriceIn(currency, q.Rate)
+		if q.MinPriceCents != nil && price < *q.MinPriceCents {
+			continue
+		}
+		if q.MaxPriceCents != nil && price > *q.MaxPriceCents {
+			continue
+		}
+		matches = append(matches, view)
+	}
+
+	// Keyset pagination: continue after the cursor's (key, id) in sort order
+	compare := func(a, b store.Product) int {
+		c := compareSortKey(q.Sort, sortValue(q.Sort, &a, currency, q.Rate), sortValue(q.Sort, &b, currency, q.Rate))
+		if c == 0 {
+			c = a.ID - b.ID
+		}
+		if q.Desc {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matches, compare)
+
+	page := &store.ProductPage{Total: len(matches), Products: make([]store.Product, 0, q.Limit)}
+	for _, p := range matches {
+		if q.After != nil {
+			c := compareSortKey(q.Sort, sortValue(q.Sort, &p, currency, q.Rate), q.After.Value)
+			if c == 0 {
+				c = p.ID - q.After.ID
+			}
+			if q.Desc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		if len(page.Products) == q.Limit {
+			last := page.Products[len(page.Products)-1]
+			page.Next = &store.ProductCursor{Value: sortValue(q.Sort, &last, currency, q.Rate), ID: last.ID}
+			break
+		}
+		page.Products = append(page.Products, p)
+	}
+	return page, nil
+}
+
+// sortValue returns a product's sort key as cursor text.
+func sortValue(sort string, p *store.Product, currency string, rate *big.Rat) string {
+	switch sort {
+	case store.ProductSortPrice:
+		return strconv.Itoa(p.PriceIn(currency, rate))
+	case store.ProductSortName:
+		return p.Name
+	case store.ProductSortCreatedAt:
+		return p.CreatedAt.UTC().Format(cursorTimeLayout)
+	}
+	return strconv.Itoa(p.ID)
+}
+
+// compareSortKey compares two cursor texts of a sort key by its type.
+func compareSortKey(sort, a, b string) int {
+	switch sort {
+	case store.ProductSortName:
+		return strings.Compare(a, b)
+	case store.ProductSortCreatedAt:
+		ta, _ := time.Parse(cursorTimeLayout, a)
+		tb, _ := time.Parse(cursorTimeLayout, b)
+		return ta.Compare(tb)
+	}
+	na, _ := strconv.Atoi(a)
+	nb, _ := strconv.Atoi(b)
+	return na - nb
+}
+
+func (s *ProductStore) Get(id int) (*store.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	view := s.db.productView(p)
+	return &view, nil
+}
+
+func (s *ProductStore) Create(in store.ProductInput) (*store.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkCategories(in.CategoryIDs); err != nil {
+		return nil, err
+	}
+	p := &product{
+		ID:             s.db.nextID("products"),
+		Name:           in.Name,
+		Description:    in.Description,
+		PriceCents:     in.PriceCents,
+		StockQuantity:  in.StockQuantity,
+		UnlimitedStock: in.UnlimitedStock,
+		TaxCategory:    in.TaxCategory,
+		Prices:         maps.Clone(in.Prices),
+		CategoryIDs:    uniqueIDs(in.CategoryIDs),
+		TagIDs:         s.db.tagIDs(in.Tags),
+		CreatedAt:      now(),
+	}
+	s.db.products[p.ID] = p
+	s.db.recordPriceChange(p, in.AdminID)
+
+	view := s.db.productView(p)
+	return &view, nil
+}
+
+func (s *ProductStore) Update(id int, in store.ProductInput) (*store.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if in.CategoryIDs != nil {
+		if err := s.db.checkCategories(in.CategoryIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	p.Name, p.Description, p.PriceCents = in.Name, in.Description, in.PriceCents
+	// An empty tax category, and nil prices, categories and tags, keep the current ones
+	if in.TaxCategory != "" {
+		p.TaxCategory = in.TaxCategory
+	}
+	if in.Prices != nil {
+		p.Prices = maps.Clone(in.Prices)
+	}
+	if in.CategoryIDs != nil {
+		p.CategoryIDs = uniqueIDs(in.CategoryIDs)
+	}
+	if in.Tags != nil {
+		p.TagIDs = s.db.tagIDs(in.Tags)
+	}
+	s.db.recordPriceChange(p, in.AdminID)
+
+	view := s.db.productView(p)
+	return &view, nil
+}
+
+func (s *ProductStore) Archive(id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	// An archived product keeps the time it was first archived
+	if p.ArchivedAt == nil {
+		t := now()
+		p.ArchivedAt = &t
+	}
+	return nil
+}
+
+func (s *ProductStore) Restore(id int) (*store.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	p.ArchivedAt = nil
+	view := s.db.productView(p)
+	return &view, nil
+}
+
+func (s *ProductStore) PriceHistory(productID int) ([]store.PriceChange, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[productID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	history := make([]store.PriceChange, 0)
+	for i := len(s.db.priceHistory) - 1; i >= 0; i-- {
+		if c := s.db.priceHistory[i]; c.ProductID == productID {
+			c.Prices = maps.Clone(c.Prices)
+			history = append(history, c)
+		}
+	}
+	return history, nil
+}
+
+// recordPriceChange adds an entry to a product's price history with its
+// current name and prices, unless they are those of its latest entry.
+func (db *DB) recordPriceChange(p *product, adminID int) {
+	var prices map[string]int
+	if len(p.Prices) > 0 {
+		prices = maps.Clone(p.Prices)
+	}
+	for i := len(db.priceHistory) - 1; i >= 0; i-- {
+		last := db.priceHistory[i]
+		if last.ProductID != p.ID || last.VariantSKU != "" {
+			continue
+		}
+		if last.Name == p.Name && last.PriceCents == p.PriceCents && maps.Equal(last.Prices, prices) {
+			return
+		}
+		break
+	}
+
+	c := store.PriceChange{
+		ID:         db.nextID("product_price_history"),
+		ProductID:  p.ID,
+		Name:       p.Name,
+		PriceCents: p.PriceCents,
+		Prices:     prices,
+		ChangedAt:  now(),
+	}
+	if adminID != 0 {
+		c.AdminUserID = &adminID
+	}
+	db.priceHistory = append(db.priceHistory, c)
+}
+
+// recordVariantPriceChange adds an entry to a product's price history with its
+// variant's current price override, unless it is that of the variant's latest
+// entry. A variant without entries counts as having no override.
+func (db *DB) recordVariantPriceChange(p *product, v *store.ProductVariant, adminID int) {
+	var last *int
+	for i := len(db.priceHistory) - 1; i >= 0; i-- {
+		if c := db.priceHistory[i]; c.VariantID != nil && *c.VariantID == v.ID {
+			last = c.PriceOverrideCents
+			break
+		}
+	}
+	if equalOverride(last, v.PriceOverrideCents) {
+		return
+	}
+
+	variantID := v.ID
+	c := store.PriceChange{
+		ID:         db.nextID("product_price_history"),
+		ProductID:  p.ID,
+		VariantID:  &variantID,
+		VariantSKU: v.SKU,
+		Name:       p.Name,
+		PriceCents: p.PriceCents,
+		ChangedAt:  now(),
+	}
+	if v.PriceOverrideCents != nil {
+		price := *v.PriceOverrideCents
+		c.PriceOverrideCents = &price
+	}
+	if adminID != 0 {
+		c.AdminUserID = &adminID
+	}
+	db.priceHistory = append(db.priceHistory, c)
+}
+
+// equalOverride reports whether two price overrides are the same, nil included.
+func equalOverride(a, b *int) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
+
+func (s *ProductStore) AdjustStock(productID int, adj store.StockAdjustment) (*store.StockLevel, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[productID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if p.StockQuantity+adj.Delta < 0 {
+		return nil, &store.NegativeStockError{Current: p.StockQuantity}
+	}
+	p.StockQuantity += adj.Delta
+	if adj.Unlimited != nil {
+		p.UnlimitedStock = *adj.Unlimited
+	}
+	s.db.stockLog = append(s.db.stockLog, stockAdjustment{
+		ProductID: productID, Delta: adj.Delta, Reason: adj.Reason, AdminID: adj.AdminID,
+	})
+	return &store.StockLevel{ProductID: productID, StockQuantity: p.StockQuantity, UnlimitedStock: p.UnlimitedStock}, nil
+}
+
+// checkCategories returns a CategoryNotFoundError unless every ID exists.
+func (db *DB) checkCategories(ids []int) error {
+	for _, id := range ids {
+		if _, ok := db.categories[id]; !ok {
+			return store.CategoryNotFoundError(id)
+		}
+	}
+	return nil
+}
+
+// tagIDs returns the IDs of tags (normalized names), creating the missing ones.
+func (db *DB) tagIDs(names []string) []int {
+	var ids []int
+	for _, name := range names {
+		t := db.tagByName(name)
+		if t == nil {
+			t = &store.Tag{ID: db.nextID("tags"), Name: name, CreatedAt: now()}
+			db.tags[t.ID] = t
+		}
+		if !slices.Contains(ids, t.ID) {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// uniqueIDs returns ids without repeats.
+func uniqueIDs(ids []int) []int {
+	var out []int
+	for _, id := range ids {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
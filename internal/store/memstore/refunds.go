@@ -0,0 +1,95 @@
+package memstore
+
+import (
+	"slices"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+func (s *OrderStore) Refund(orderID, adminID int, issue func(o *store.RefundableOrder) (*store.Refund, error)) (*store.Refund, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	ro := store.RefundableOrder{
+		ID:                    o.ID,
+		Status:                o.Status,
+		StripePaymentIntentID: o.StripePaymentIntentID,
+		TotalCents:            o.TotalCents,
+		RefundedCents:         o.RefundedCents,
+		Lines:                 map[int]store.RefundableLine{},
+	}
+	for _, l := range o.Lines {
+		rl := store.RefundableLine{
+			ID:             l.ID,
+			VariantSKU:     l.VariantSKU,
+			Quantity:       l.Quantity,
+			RefundedQty:    l.RefundedQty,
+			UnitPriceCents: l.UnitPriceCents,
+			DiscountCents:  l.DiscountCents,
+			TaxCents:       l.TaxCents,
+		}
+		if _, ok := s.db.products[l.ProductID]; ok {
+			productID := l.ProductID
+			rl.ProductID = &productID
+		}
+		if l.VariantID != 0 {
+			variantID := l.VariantID
+			rl.VariantID = &variantID
+		}
+		ro.Lines[l.ID] = rl
+	}
+
+	refund, err := issue(&ro)
+	if err != nil {
+		return nil, err
+	}
+	refund.OrderID = orderID
+	s.db.recordRefund(o, adminID, ro.Lines, refund)
+	out := *refund
+	out.Lines = slices.Clone(refund.Lines)
+	return &out, nil
+}
+
+// recordRefund stores the refund, updates the order totals and, when
+// requested, restocks the refunded quantities. It fills refund.ID and CreatedAt.
+func (db *DB) recordRefund(o *order, adminID int, lines map[int]store.RefundableLine, refund *store.Refund) {
+	refund.ID = db.nextID("refunds")
+	refund.CreatedAt = now()
+
+	for _, rl := range refund.Lines {
+		line := lines[rl.OrderLineID]
+		for i := range o.Lines {
+			if o.Lines[i].ID == rl.OrderLineID {
+				o.Lines[i].RefundedQty += rl.Quantity
+			}
+		}
+
+		// Variants deleted since the sale have no stock to return to
+		if !refund.Restocked || line.ProductID == nil || (line.VariantSKU != "" && line.VariantID == nil) {
+			continue
+		}
+		key := stockKey{ProductID: *line.ProductID}
+		unlimited := db.products[key.ProductID].UnlimitedStock
+		if line.VariantID != nil {
+			key.VariantID = *line.VariantID
+			unlimited = db.variants[key.VariantID].UnlimitedStock
+		}
+		if unlimited {
+			continue
+		}
+		*db.stockOf(key) += rl.Quantity
+		db.stockLog = append(db.stockLog, stockAdjustment{
+			ProductID: key.ProductID, VariantID: key.VariantID, Delta: rl.Quantity,
+			Reason: stockReasonOrderRefunded, AdminID: adminID, OrderID: o.ID,
+		})
+	}
+
+	o.RefundedCents, o.Status = refund.RefundedCents, refund.OrderStatus
+	stored := *refund
+	stored.Lines = slices.Clone(refund.Lines)
+	db.refunds = append(db.refunds, stored)
+}
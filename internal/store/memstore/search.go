@@ -0,0 +1,62 @@
+package memstore
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// Search keeps the unarchived products where every word of text is a prefix of
+// a word of the name or description, case-insensitively, by ID. It does not
+// rank, highlight or tolerate typos: NameHighlight and Snippet are the name and
+// description, HTML-escaped as the Postgres store's are.
+func (s *ProductStore) Search(text string, limit int) ([]store.ProductSearchResult, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	query := words(text)
+	results := make([]store.ProductSearchResult, 0)
+	if len(query) == 0 {
+		return results, nil
+	}
+	for _, p := range s.db.products {
+		if p.ArchivedAt != nil {
+			continue
+		}
+		have := words(p.Name + " " + p.Description)
+		if !allPrefixes(query, have) {
+			continue
+		}
+		results = append(results, store.ProductSearchResult{
+			Product:       s.db.productView(p),
+			Rank:          1,
+			NameHighlight: html.EscapeString(p.Name),
+			Snippet:       html.EscapeString(p.Description),
+		})
+	}
+	slices.SortFunc(results, func(a, b store.ProductSearchResult) int { return a.ID - b.ID })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// words splits text into lower-case words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// allPrefixes reports whether each of query is a prefix of one of have.
+func allPrefixes(query, have []string) bool {
+	for _, q := range query {
+		if !slices.ContainsFunc(have, func(w string) bool { return strings.HasPrefix(w, q) }) {
+			return false
+		}
+	}
+	return true
+}
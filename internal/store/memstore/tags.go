@@ -0,0 +1,90 @@
+package memstore
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// TagStore implements store.TagStore.
+type TagStore struct {
+	db *DB
+}
+
+// tagView returns a copy of a tag with its product count.
+func (db *DB) tagView(t *store.Tag) store.Tag {
+	out := *t
+	out.ProductCount = 0
+	for _, p := range db.products {
+		if p.ArchivedAt == nil && slices.Contains(p.TagIDs, t.ID) {
+			out.ProductCount++
+		}
+	}
+	return out
+}
+
+// tagByName returns the tag named name, if any.
+func (db *DB) tagByName(name string) *store.Tag {
+	for _, t := range db.tags {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *TagStore) List() ([]store.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tags := make([]store.Tag, 0, len(s.db.tags))
+	for _, t := range s.db.tags {
+		tags = append(tags, s.db.tagView(t))
+	}
+	slices.SortFunc(tags, func(a, b store.Tag) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+func (s *TagStore) Create(name string) (*store.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.tagByName(name) != nil {
+		return nil, store.ErrConflict
+	}
+	t := &store.Tag{ID: s.db.nextID("tags"), Name: name, CreatedAt: now()}
+	s.db.tags[t.ID] = t
+	view := *t
+	return &view, nil
+}
+
+func (s *TagStore) Rename(id int, name string) (*store.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if other := s.db.tagByName(name); other != nil && other.ID != id {
+		return nil, store.ErrConflict
+	}
+	t, ok := s.db.tags[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	t.Name = name
+	view := s.db.tagView(t)
+	return &view, nil
+}
+
+func (s *TagStore) Delete(id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.tags[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.db.tags, id)
+	for _, p := range s.db.products {
+		p.TagIDs = slices.DeleteFunc(p.TagIDs, func(t int) bool { return t == id })
+	}
+	return nil
+}
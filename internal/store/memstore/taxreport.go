@@ -0,0 +1,86 @@
+package memstore
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// netOf scales an order line amount down by its refunded quantity and converts
+// it to the base currency at rate, the order's orderRate.
+func netOf(rate *big.Rat, l orderLine, cents int64) int64 {
+	net := big.NewRat(cents*int64(l.Quantity-l.RefundedQty), int64(l.Quantity))
+	net.Quo(net, rate)
+	// Round half up, as ROUND does for the non-negative amounts here
+	num := new(big.Int).Mul(net.Num(), big.NewInt(2))
+	num.Add(num, net.Denom())
+	return num.Quo(num, new(big.Int).Mul(net.Denom(), big.NewInt(2))).Int64()
+}
+
+func (s *OrderStore) TaxReport(filter store.TaxReportFilter) ([]store.ProvinceTaxSummary, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	byProvince := map[string]*store.ProvinceTaxSummary{}
+	for _, o := range s.db.orders {
+		switch {
+		case o.TaxProvince == "" || !slices.Contains(paidOrderStatuses, o.Status):
+			continue
+		case !filter.From.IsZero() && o.CreatedAt.Before(filter.From):
+			continue
+		case !filter.To.IsZero() && !o.CreatedAt.Before(filter.To):
+			continue
+		}
+		p, ok := byProvince[o.TaxProvince]
+		if !ok {
+			p = &store.ProvinceTaxSummary{Province: o.TaxProvince, Taxes: []store.TaxTypeSummary{}}
+			byProvince[o.TaxProvince] = p
+		}
+		p.Orders++
+
+		// Amounts without a rate to the base currency are left out
+		rate, ok := s.db.orderRate(o)
+		if !ok {
+			continue
+		}
+		for _, l := range o.Lines {
+			net := netOf(rate, l, l.Subtotal-l.DiscountCents)
+			switch l.TaxCategory {
+			case tax.CategoryTaxable:
+				p.TaxableSalesCents += net
+			case tax.CategoryZeroRated:
+				p.ZeroRatedSalesCents += net
+			case tax.CategoryExempt:
+				p.ExemptSalesCents += net
+			}
+			for _, t := range l.Taxes {
+				amount := netOf(rate, l, t.AmountCents)
+				i := slices.IndexFunc(p.Taxes, func(x store.TaxTypeSummary) bool {
+					return x.Type == t.Type && x.RatePercent == t.RatePercent
+				})
+				if i < 0 {
+					p.Taxes = append(p.Taxes, store.TaxTypeSummary{Type: t.Type, RatePercent: t.RatePercent})
+					i = len(p.Taxes) - 1
+				}
+				p.Taxes[i].AmountCents += amount
+				p.TaxCents += amount
+			}
+		}
+	}
+
+	summaries := make([]store.ProvinceTaxSummary, 0, len(byProvince))
+	for _, p := range byProvince {
+		slices.SortFunc(p.Taxes, func(a, b store.TaxTypeSummary) int {
+			if c := strings.Compare(a.Type, b.Type); c != 0 {
+				return c
+			}
+			return strings.Compare(a.RatePercent, b.RatePercent)
+		})
+		summaries = append(summaries, *p)
+	}
+	slices.SortFunc(summaries, func(a, b store.ProvinceTaxSummary) int { return strings.Compare(a.Province, b.Province) })
+	return summaries, nil
+}
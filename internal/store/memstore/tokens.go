@@ -0,0 +1,109 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// refreshToken is a row of refresh_tokens, by token hash.
+type refreshToken struct {
+	UserID    int
+	Family    string
+	ExpiresAt time.Time
+	Revoked   bool
+	// Access is the access token issued alongside the refresh token.
+	Access store.AccessToken
+}
+
+// TokenStore implements store.TokenStore.
+type TokenStore struct {
+	db *DB
+}
+
+func (s *TokenStore) CreateRefreshToken(userID int, tokenHash, family string, ttl time.Duration, access store.AccessToken) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.refreshTokens[tokenHash]; ok {
+		return store.ErrConflict
+	}
+	s.db.refreshTokens[tokenHash] = &refreshToken{UserID: userID, Family: family, ExpiresAt: now().Add(ttl), Access: access}
+	return nil
+}
+
+func (s *TokenStore) RotateRefreshToken(oldHash, newHash string, ttl time.Duration, access store.AccessToken) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	old, ok := s.db.refreshTokens[oldHash]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	u, ok := s.db.users[old.UserID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	switch {
+	case old.Revoked:
+		s.db.revokeFamily(old.Family)
+		return nil, store.ErrTokenReused
+	case old.ExpiresAt.Before(now()):
+		return nil, store.ErrTokenExpired
+	}
+
+	old.Revoked = true
+	s.db.refreshTokens[newHash] = &refreshToken{UserID: old.UserID, Family: old.Family, ExpiresAt: now().Add(ttl), Access: access}
+	return &store.User{ID: u.ID, Username: u.Username}, nil
+}
+
+// revokeFamily revokes every refresh token of a family.
+func (db *DB) revokeFamily(family string) {
+	for _, t := range db.refreshTokens {
+		if t.Family == family {
+			t.Revoked = true
+		}
+	}
+}
+
+func (s *TokenStore) Logout(userID int, jti string, expiresAt time.Time, refreshHash string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.revokedTokens[jti]; !ok {
+		s.db.revokedTokens[jti] = expiresAt
+	}
+	if t, ok := s.db.refreshTokens[refreshHash]; ok && refreshHash != "" && t.UserID == userID {
+		s.db.revokeFamily(t.Family)
+	}
+	return nil
+}
+
+func (s *TokenStore) RevokeUser(userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, t := range s.db.refreshTokens {
+		if t.UserID != userID {
+			continue
+		}
+		t.Revoked = true
+		if t.Access.JTI != "" && t.Access.ExpiresAt.After(now()) {
+			if _, ok := s.db.revokedTokens[t.Access.JTI]; !ok {
+				s.db.revokedTokens[t.Access.JTI] = t.Access.ExpiresAt
+			}
+		}
+	}
+	return nil
+}
+
+func (s *TokenStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	_, revoked := s.db.revokedTokens[jti]
+	return revoked, nil
+}
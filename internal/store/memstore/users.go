@@ -0,0 +1,80 @@
+package memstore
+
+import (
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// UserStore implements store.UserStore.
+type UserStore struct {
+	db *DB
+}
+
+func (s *UserStore) Create(username, email, passwordHash string) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if u.Username == username || u.Email == email {
+			return 0, store.ErrConflict
+		}
+	}
+	u := &store.User{ID: s.db.nextID("users"), Username: username, Email: email, PasswordHash: passwordHash}
+	s.db.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (s *UserStore) Get(id int) (*store.User, error) {
+	return s.getBy(func(u *store.User) bool { return u.ID == id })
+}
+
+func (s *UserStore) GetByEmail(email string) (*store.User, error) {
+	return s.getBy(func(u *store.User) bool { return u.Email == email })
+}
+
+func (s *UserStore) GetByStripeCustomerID(customerID string) (*store.User, error) {
+	return s.getBy(func(u *store.User) bool { return customerID != "" && u.StripeCustomerID == customerID })
+}
+
+func (s *UserStore) getBy(match func(u *store.User) bool) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if match(u) {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *UserStore) SetStripeCustomerID(userID int, customerID string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if u, ok := s.db.users[userID]; ok {
+		u.StripeCustomerID = customerID
+	}
+	return nil
+}
+
+func (s *UserStore) SetBillingProvince(userID int, province string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if u, ok := s.db.users[userID]; ok {
+		u.BillingProvince = province
+	}
+	return nil
+}
+
+// AdminStore implements store.AdminStore; see DB.GrantAdmin.
+type AdminStore struct {
+	db *DB
+}
+
+func (s *AdminStore) IsAdmin(userID int) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.admins[userID], nil
+}
@@ -0,0 +1,193 @@
+package memstore
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// ProductVariantStore implements store.ProductVariantStore.
+type ProductVariantStore struct {
+	db *DB
+}
+
+// productVariants returns a product's variants by ID.
+func (db *DB) productVariants(productID int) []*store.ProductVariant {
+	var variants []*store.ProductVariant
+	for _, v := range db.variants {
+		if v.ProductID == productID {
+			variants = append(variants, v)
+		}
+	}
+	slices.SortFunc(variants, func(a, b *store.ProductVariant) int { return a.ID - b.ID })
+	return variants
+}
+
+// variantView returns a copy of a variant of p with its current price.
+func (db *DB) variantView(p *product, v *store.ProductVariant) store.ProductVariant {
+	out := *v
+	out.Options = maps.Clone(v.Options)
+	if v.PriceOverrideCents != nil {
+		price := *v.PriceOverrideCents
+		out.PriceOverrideCents = &price
+	}
+	out.PriceCents = db.variantPrice(p, v, now())
+	return out
+}
+
+func (s *ProductVariantStore) SetOptions(productID int, options []store.ProductOption) ([]store.ProductOption, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[productID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	// Every existing variant must still have one valid value per option
+	for _, v := range s.db.productVariants(productID) {
+		if store.CheckVariantOptions(options, v.Options) != nil {
+			return nil, store.ErrOptionsInUse
+		}
+	}
+	p.Options = make([]store.ProductOption, len(options))
+	for i, o := range options {
+		p.Options[i] = store.ProductOption{Name: o.Name, Values: slices.Clone(o.Values)}
+	}
+	return options, nil
+}
+
+func (s *ProductVariantStore) Create(productID int, in store.VariantInput) (*store.ProductVariant, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[productID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if err := store.CheckVariantOptions(p.Options, in.Options); err != nil {
+		return nil, err
+	}
+	if s.db.variantTaken(productID, 0, in) {
+		return nil, store.ErrConflict
+	}
+
+	v := &store.ProductVariant{
+		ID:             s.db.nextID("product_variants"),
+		ProductID:      productID,
+		SKU:            in.SKU,
+		StockQuantity:  in.StockQuantity,
+		UnlimitedStock: in.UnlimitedStock,
+	}
+	setVariantInput(v, in)
+	s.db.variants[v.ID] = v
+	s.db.recordVariantPriceChange(p, v, in.AdminID)
+	view := s.db.variantView(p, v)
+	return &view, nil
+}
+
+func (s *ProductVariantStore) Update(productID, variantID int, in store.VariantInput) (*store.ProductVariant, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[productID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if err := store.CheckVariantOptions(p.Options, in.Options); err != nil {
+		return nil, err
+	}
+	v, ok := s.db.variants[variantID]
+	if !ok || v.ProductID != productID {
+		return nil, store.ErrNotFound
+	}
+	if s.db.variantTaken(productID, variantID, in) {
+		return nil, store.ErrConflict
+	}
+
+	setVariantInput(v, in)
+	s.db.recordVariantPriceChange(p, v, in.AdminID)
+	view := s.db.variantView(p, v)
+	return &view, nil
+}
+
+// setVariantInput sets the admin-editable fields of a variant but its stock.
+func setVariantInput(v *store.ProductVariant, in store.VariantInput) {
+	v.SKU = in.SKU
+	v.Options = maps.Clone(in.Options)
+	if v.Options == nil {
+		v.Options = map[string]string{}
+	}
+	v.PriceOverrideCents = nil
+	if in.PriceOverrideCents != nil {
+		price := *in.PriceOverrideCents
+		v.PriceOverrideCents = &price
+	}
+}
+
+// variantTaken reports whether another variant than exceptID has in's SKU, or
+// in's options within the same product.
+func (db *DB) variantTaken(productID, exceptID int, in store.VariantInput) bool {
+	for _, v := range db.variants {
+		if v.ID == exceptID {
+			continue
+		}
+		if v.SKU == in.SKU || (v.ProductID == productID && maps.Equal(v.Options, in.Options)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ProductVariantStore) Delete(productID, variantID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	v, ok := s.db.variants[variantID]
+	if !ok || v.ProductID != productID {
+		return store.ErrNotFound
+	}
+	delete(s.db.variants, variantID)
+	// Cart items of the variant go with it; order lines and price history keep its SKU
+	for id, it := range s.db.cartItems {
+		if it.VariantID == variantID {
+			delete(s.db.cartItems, id)
+		}
+	}
+	for _, o := range s.db.orders {
+		for i := range o.Lines {
+			if o.Lines[i].VariantID == variantID {
+				o.Lines[i].VariantID = 0
+			}
+		}
+	}
+	for i := range s.db.priceHistory {
+		if c := &s.db.priceHistory[i]; c.VariantID != nil && *c.VariantID == variantID {
+			c.VariantID = nil
+		}
+	}
+	return nil
+}
+
+func (s *ProductVariantStore) AdjustStock(productID, variantID int, adj store.StockAdjustment) (*store.StockLevel, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	v, ok := s.db.variants[variantID]
+	if !ok || v.ProductID != productID {
+		return nil, store.ErrNotFound
+	}
+	if v.StockQuantity+adj.Delta < 0 {
+		return nil, &store.NegativeStockError{Current: v.StockQuantity}
+	}
+	v.StockQuantity += adj.Delta
+	if adj.Unlimited != nil {
+		v.UnlimitedStock = *adj.Unlimited
+	}
+	s.db.stockLog = append(s.db.stockLog, stockAdjustment{
+		ProductID: productID, VariantID: variantID, Delta: adj.Delta, Reason: adj.Reason, AdminID: adj.AdminID,
+	})
+	return &store.StockLevel{
+		ProductID: productID, VariantID: variantID, StockQuantity: v.StockQuantity, UnlimitedStock: v.UnlimitedStock,
+	}, nil
+}
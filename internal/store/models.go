@@ -0,0 +1,959 @@
+package store
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// Order statuses stored in orders.status.
+const (
+	OrderStatusPending           = "pending"
+	OrderStatusPaid              = "paid"
+	OrderStatusFailed            = "failed"
+	OrderStatusRefunded          = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusDisputed          = "disputed"
+	// OrderStatusNeedsReview is a failed order whose payment succeeded after
+	// its stock was released and sold; an admin has to refund it.
+	OrderStatusNeedsReview = "needs_review"
+)
+
+// User is a registered account.
+type User struct {
+	ID               int
+	Username         string
+	Email            string
+	PasswordHash     string
+	StripeCustomerID string
+	// BillingProvince is the province code sales tax is charged for, if known.
+	BillingProvince string
+}
+
+// AccessToken identifies an issued access token, so it can be denylisted
+// before it expires.
+type AccessToken struct {
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// Product is a catalog entry. PriceCents is in Currency, the base currency
+// unless the product was priced in another one with PriceIn. As stored it is
+// the regular base price; once priced, the price the product sells at, with
+// OriginalPriceCents its regular price.
+//
+// Prices follow one precedence. The product's price in a currency is its
+// explicit price there (Prices) if it has one, else its base price converted
+// at the currency's rate. A variant's price override and the sale price of a
+// running price schedule, both in the base currency, scale that price by their
+// ratio to the base price. So a sale discounts every variant in the same
+// proportion, explicit prices are honoured during sales and for variants, and
+// only a currency without an explicit price needs a rate.
+type Product struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	PriceCents         int    `json:"price_cents"`
+	OriginalPriceCents int    `json:"original_price_cents"`
+	Currency           string `json:"currency"`
+	// SalePriceCents is the base-currency price of the price schedule running
+	// now, if any, and SaleEndsAt its end (nil for an open-ended one).
+	SalePriceCents *int       `json:"-"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty"`
+	StockQuantity  int        `json:"stock_quantity"`
+	UnlimitedStock bool       `json:"unlimited_stock"`
+	TaxCategory    string     `json:"tax_category"`
+	// Prices are the explicit prices in other currencies, by lower-case ISO code.
+	Prices     map[string]int    `json:"prices,omitempty"`
+	Categories []ProductCategory `json:"categories"`
+	Tags       []string          `json:"tags"`
+	// Images are in display order.
+	Images []ProductImage `json:"images"`
+	// Options and Variants are empty for products sold without variants.
+	Options   []ProductOption  `json:"options"`
+	Variants  []ProductVariant `json:"variants"`
+	CreatedAt time.Time        `json:"created_at"`
+	// ArchivedAt is set for archived products, which are hidden from the
+	// catalog and cannot be bought.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// ProductImage is an uploaded product image. Key and ThumbnailKey locate the
+// files in the storage backend; the handlers fill in their URLs.
+type ProductImage struct {
+	ID           int    `json:"id"`
+	ProductID    int    `json:"-"`
+	Key          string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Position     int    `json:"position"`
+	IsPrimary    bool   `json:"is_primary"`
+}
+
+// Price schedule statuses, as of when the schedule is read.
+const (
+	PriceScheduleScheduled = "scheduled"
+	PriceScheduleActive    = "active"
+	PriceScheduleEnded     = "ended"
+	PriceScheduleCancelled = "cancelled"
+)
+
+// PriceSchedule sets a product's price to SalePriceCents, in the base
+// currency, from StartsAt until EndsAt (nil: until cancelled).
+type PriceSchedule struct {
+	ID             int        `json:"id"`
+	ProductID      int        `json:"product_id"`
+	SalePriceCents int        `json:"sale_price_cents"`
+	StartsAt       time.Time  `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Status         string     `json:"status"`
+	AdminUserID    *int       `json:"admin_user_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// StatusAt returns one of the PriceSchedule* statuses of the schedule at now.
+func (s *PriceSchedule) StatusAt(now time.Time) string {
+	switch {
+	case s.CancelledAt != nil:
+		return PriceScheduleCancelled
+	case now.Before(s.StartsAt):
+		return PriceScheduleScheduled
+	case s.EndsAt != nil && !now.Before(*s.EndsAt):
+		return PriceScheduleEnded
+	}
+	return PriceScheduleActive
+}
+
+// PriceScheduleInput holds the fields of a new price schedule.
+type PriceScheduleInput struct {
+	SalePriceCents int
+	StartsAt       time.Time
+	EndsAt         *time.Time
+	AdminID        int
+}
+
+// ProductCategory is a category a product is assigned to.
+type ProductCategory struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// PriceIn returns the price the product sells at in currency, at its running
+// sale price if any.
+func (p *Product) PriceIn(currency string, rate *big.Rat) int {
+	return p.priceIn(p.PriceCents, true, currency, rate)
+}
+
+// RegularPriceIn returns the product's price in currency outside of price
+// schedules.
+func (p *Product) RegularPriceIn(currency string, rate *big.Rat) int {
+	return p.priceIn(p.PriceCents, false, currency, rate)
+}
+
+// priceIn prices base, the product's base price or a variant's override, in
+// currency (see PriceIn), at the running sale price if sale is set. Rounding
+// happens once, at the end.
+func (p *Product) priceIn(base int, sale bool, currency string, rate *big.Rat) int {
+	price := big.NewRat(int64(base), 1)
+	if sale && p.SalePriceCents != nil {
+		price.Mul(price, big.NewRat(int64(*p.SalePriceCents), int64(p.PriceCents)))
+	}
+	if currency != money.Base {
+		if explicit, ok := p.Prices[currency]; ok {
+			price.Mul(price, big.NewRat(int64(explicit), int64(p.PriceCents)))
+		} else {
+			price.Mul(price, rate)
+		}
+	}
+	return int(money.Round(price))
+}
+
+// ProductOption is an option a product's variants differ by, e.g. "size", with
+// its values in display order. Names are trimmed and lower-case.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ProductVariant is a SKU of a product: one value for each of the product's
+// options, with its own stock. PriceCents is its price in the product's
+// Currency (see Product.VariantPriceIn); PriceOverrideCents is the variant's
+// own regular base price, if set, instead of the product's.
+type ProductVariant struct {
+	ID                 int               `json:"id"`
+	ProductID          int               `json:"product_id"`
+	SKU                string            `json:"sku"`
+	Options            map[string]string `json:"options"`
+	PriceCents         int               `json:"price_cents"`
+	PriceOverrideCents *int              `json:"price_override_cents"`
+	StockQuantity      int               `json:"stock_quantity"`
+	UnlimitedStock     bool              `json:"unlimited_stock"`
+}
+
+// VariantPriceIn returns the price one of the product's variants sells at in
+// currency: its price override, if set, priced like the product's base price
+// (see PriceIn), else the product's PriceIn.
+func (p *Product) VariantPriceIn(v *ProductVariant, currency string, rate *big.Rat) int {
+	base := p.PriceCents
+	if v.PriceOverrideCents != nil {
+		base = *v.PriceOverrideCents
+	}
+	return p.priceIn(base, true, currency, rate)
+}
+
+// NeedsRate reports whether pricing the product or its variants in currency
+// converts a base-currency price, and so needs the currency's exchange rate:
+// only when the product has no explicit price in currency (see PriceIn).
+func (p *Product) NeedsRate(currency string) bool {
+	if currency == money.Base {
+		return false
+	}
+	_, explicit := p.Prices[currency]
+	return !explicit
+}
+
+// VariantInput holds the admin-editable fields of a variant; stock is only set
+// on creation and then changed through AdjustStock.
+type VariantInput struct {
+	SKU                string
+	Options            map[string]string
+	PriceOverrideCents *int
+	StockQuantity      int
+	UnlimitedStock     bool
+	// AdminID is the admin making the change, recorded in the price history.
+	AdminID int
+}
+
+// VariantOptionsError is returned when a variant's options do not match its
+// product's: a missing or unknown option, or a value the option does not offer.
+type VariantOptionsError string
+
+func (e VariantOptionsError) Error() string {
+	return string(e)
+}
+
+// CheckVariantOptions returns a VariantOptionsError unless values has exactly
+// one of its allowed values for each option.
+func CheckVariantOptions(options []ProductOption, values map[string]string) error {
+	for _, o := range options {
+		v, ok := values[o.Name]
+		if !ok {
+			return VariantOptionsError("Missing value for option " + strconv.Quote(o.Name))
+		}
+		if !slices.Contains(o.Values, v) {
+			return VariantOptionsError("Option " + strconv.Quote(o.Name) + " has no value " + strconv.Quote(v))
+		}
+	}
+	if len(values) != len(options) {
+		for name := range values {
+			if !slices.ContainsFunc(options, func(o ProductOption) bool { return o.Name == name }) {
+				return VariantOptionsError("Unknown option " + strconv.Quote(name))
+			}
+		}
+	}
+	return nil
+}
+
+// VariantNotFoundError is returned by CreatePending and CartStore.Add for a
+// variant ID that is not one of the product's variants.
+type VariantNotFoundError struct {
+	ProductID int
+	VariantID int
+}
+
+func (e *VariantNotFoundError) Error() string {
+	return "Variant " + strconv.Itoa(e.VariantID) + " not found for product " + strconv.Itoa(e.ProductID)
+}
+
+// VariantRequiredError is returned by CreatePending and CartStore.Add for a
+// product sold in variants when no variant was given.
+type VariantRequiredError int
+
+func (e VariantRequiredError) Error() string {
+	return "Product " + strconv.Itoa(int(e)) + " is sold in variants; variant_id is required"
+}
+
+// ProductInput holds the admin-editable fields of a product.
+type ProductInput struct {
+	Name           string
+	Description    string
+	PriceCents     int
+	StockQuantity  int
+	UnlimitedStock bool
+	// TaxCategory is one of the tax.Category* values.
+	TaxCategory string
+	// Prices are explicit prices in other currencies. On Update, nil keeps the
+	// current ones and an empty map removes them.
+	Prices map[string]int
+	// CategoryIDs and Tags (normalized names, created as needed) are assigned
+	// like Prices: on Update, nil keeps the current ones.
+	CategoryIDs []int
+	Tags        []string
+	// AdminID is the admin making the change, recorded in the price history.
+	AdminID int
+}
+
+// PriceChange is an entry of a product's price history: its name, base price
+// and explicit currency prices from ChangedAt until the next entry.
+// AdminUserID is nil for entries recorded before the history was kept.
+//
+// Entries with a VariantSKU record one of its variants' PriceOverrideCents
+// instead (nil: the variant sells at the product's price), next to the
+// product's name and base price at the time. VariantID is nil once the variant
+// is deleted.
+type PriceChange struct {
+	ID                 int            `json:"id"`
+	ProductID          int            `json:"product_id"`
+	VariantID          *int           `json:"variant_id,omitempty"`
+	VariantSKU         string         `json:"variant_sku,omitempty"`
+	Name               string         `json:"name"`
+	PriceCents         int            `json:"price_cents"`
+	Prices             map[string]int `json:"prices,omitempty"`
+	PriceOverrideCents *int           `json:"price_override_cents,omitempty"`
+	AdminUserID        *int           `json:"admin_user_id"`
+	ChangedAt          time.Time      `json:"changed_at"`
+}
+
+// Category is a node of the category tree; ParentID is nil at the top level.
+// ProductCount counts the unarchived products assigned to it directly.
+type Category struct {
+	ID           int       `json:"id"`
+	ParentID     *int      `json:"parent_id"`
+	Name         string    `json:"name"`
+	Slug         string    `json:"slug"`
+	ProductCount int       `json:"product_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CategoryInput holds the admin-editable fields of a category.
+type CategoryInput struct {
+	ParentID *int
+	Name     string
+	Slug     string
+}
+
+// CategoryNotFoundError is returned for an unknown parent or assigned category ID.
+type CategoryNotFoundError int
+
+func (e CategoryNotFoundError) Error() string {
+	return "Category not found: " + strconv.Itoa(int(e))
+}
+
+// Tag is a free-form product label. Names are trimmed and lower-case.
+type Tag struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	ProductCount int       `json:"product_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Product sort keys accepted by ProductQuery.
+const (
+	ProductSortID        = "id"
+	ProductSortPrice     = "price"
+	ProductSortName      = "name"
+	ProductSortCreatedAt = "created_at"
+)
+
+// ProductCursor is the position of the last product of a page: its sort key
+// value (as text) and its ID, which breaks ties.
+type ProductCursor struct {
+	Value string
+	ID    int
+}
+
+// ProductQuery selects a page of the catalog. Prices, both for the bounds and
+// for sorting, are in Currency (see Product.PriceIn); Rate is nil for the base
+// currency. Nil bounds and empty filters mean "no filter".
+type ProductQuery struct {
+	Limit         int
+	After         *ProductCursor
+	Sort          string
+	Desc          bool
+	MinPriceCents *int
+	MaxPriceCents *int
+	// CategorySlug keeps the products of a category and of its subcategories.
+	CategorySlug string
+	Tag          string
+	Currency     string
+	Rate         *big.Rat
+	// Archived lists archived products instead of the catalog.
+	Archived bool
+}
+
+// ProductPage is one page of a ProductQuery. Total counts every matching
+// product; Next is nil on the last page.
+type ProductPage struct {
+	Products []Product
+	Total    int
+	Next     *ProductCursor
+}
+
+// ProductSearchResult is a product matching a search, with its relevance and
+// the matched words of its name and description wrapped in <mark> tags.
+// Snippet is the best-matching excerpt of the description. Both are HTML: the
+// text around the tags is escaped.
+type ProductSearchResult struct {
+	Product
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// FXRate is how much of a currency one unit of the base currency buys. Rate is
+// an exact decimal, e.g. "0.7315".
+type FXRate struct {
+	Currency  string    `json:"currency"`
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UnsupportedCurrencyError is returned by CreatePending for a currency without
+// an exchange rate, when the order has a price or coupon amount to convert.
+type UnsupportedCurrencyError string
+
+func (e UnsupportedCurrencyError) Error() string {
+	return "Unsupported currency: " + string(e)
+}
+
+// StockAdjustment is an admin change to a product's stock.
+type StockAdjustment struct {
+	Delta     int
+	Reason    string
+	AdminID   int
+	Unlimited *bool
+}
+
+// NegativeStockError is returned by AdjustStock when stock would go below zero.
+type NegativeStockError struct {
+	Current int
+}
+
+func (e *NegativeStockError) Error() string {
+	return "stock would become negative (current: " + strconv.Itoa(e.Current) + ")"
+}
+
+// StockLevel is a product's (or one of its variants') stock after an adjustment.
+type StockLevel struct {
+	ProductID      int  `json:"product_id"`
+	VariantID      int  `json:"variant_id,omitempty"`
+	StockQuantity  int  `json:"stock_quantity"`
+	UnlimitedStock bool `json:"unlimited_stock"`
+}
+
+// Card is the metadata of a saved Stripe payment method.
+type Card struct {
+	ID                    int
+	UserID                int
+	StripePaymentMethodID string
+	Brand                 string
+	Last4                 string
+	ExpMonth              int
+	ExpYear               int
+	Fingerprint           string
+	IsDefault             bool
+	ExpiryStatus          string
+}
+
+// Card expiry statuses stored in credit_cards.expiry_status.
+const (
+	CardStatusValid    = "valid"
+	CardStatusExpiring = "expiring"
+	CardStatusExpired  = "expired"
+)
+
+// CardExpiryEvent records one of a user's saved cards becoming expiring or
+// expired, so the user can be told to replace it.
+type CardExpiryEvent struct {
+	ID        int       `json:"id"`
+	CardID    int       `json:"card_id"`
+	Brand     string    `json:"brand"`
+	Last4     string    `json:"last4"`
+	ExpMonth  int       `json:"exp_month"`
+	ExpYear   int       `json:"exp_year"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// cardExpiringWindow is how long before its expiry a card counts as expiring.
+const cardExpiringWindow = 30 * 24 * time.Hour
+
+// expiresAt returns the first instant the card is no longer valid: cards are
+// valid through the last day of their expiry month.
+func (c *Card) expiresAt() time.Time {
+	return time.Date(c.ExpYear, time.Month(c.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Expired reports whether the card's expiry month is over at now.
+func (c *Card) Expired(now time.Time) bool {
+	return c.ExpYear != 0 && !now.Before(c.expiresAt())
+}
+
+// ExpiryStatusAt returns the card's expiry status at now. Cards without an
+// expiry date are always valid.
+func (c *Card) ExpiryStatusAt(now time.Time) string {
+	switch {
+	case c.ExpYear == 0:
+		return CardStatusValid
+	case c.Expired(now):
+		return CardStatusExpired
+	case c.expiresAt().Sub(now) <= cardExpiringWindow:
+		return CardStatusExpiring
+	}
+	return CardStatusValid
+}
+
+// BuyItem is one product/quantity pair requested at checkout. VariantID is
+// required for products sold in variants, and 0 for the others.
+type BuyItem struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id,omitempty"`
+	Quantity  int `json:"quantity"`
+	// ExpectedPriceCents, when set, is the base-currency unit price the buyer
+	// agreed to, e.g. a cart item's; CreatePending returns *PriceChangedError
+	// if the price differs once the product is locked.
+	ExpectedPriceCents *int `json:"-"`
+}
+
+// CartItem is a product in a user's cart. PriceCents is the price when the item
+// was added; CurrentPriceCents is the product's price now. OrderID is the
+// pending order the item is checked out in, if any; it cannot be checked out
+// again until that order is paid (which removes it) or fails.
+type CartItem struct {
+	ID                int               `json:"id"`
+	ProductID         int               `json:"product_id"`
+	ProductName       string            `json:"product_name"`
+	VariantID         int               `json:"variant_id,omitempty"`
+	VariantSKU        string            `json:"variant_sku,omitempty"`
+	VariantOptions    map[string]string `json:"variant_options,omitempty"`
+	Quantity          int               `json:"quantity"`
+	PriceCents        int               `json:"price_cents"`
+	CurrentPriceCents int               `json:"current_price_cents"`
+	PriceChanged      bool              `json:"price_changed"`
+	InStock           bool              `json:"in_stock"`
+	OrderID           int               `json:"order_id,omitempty"`
+	AddedAt           time.Time         `json:"added_at"`
+}
+
+// NewOrder is what CreatePending needs to price and record an order.
+type NewOrder struct {
+	UserID   int
+	Items    []BuyItem
+	Currency string
+	// CouponCode is optional; it is matched case-insensitively.
+	CouponCode string
+	// Province is the billing province sales tax is charged for.
+	Province string
+	// CartItemIDs are the cart items the order checks out; none may be checked
+	// out in another pending order. They are removed from the cart once the
+	// order is paid, unless changed since.
+	CartItemIDs []int
+}
+
+// Order is a checkout, paid with a single PaymentIntent. TotalCents is what is
+// charged: the lines, less DiscountCents, plus TaxCents.
+type Order struct {
+	ID                    int
+	UserID                int
+	StripePaymentIntentID string
+	Status                string
+	TotalCents            int64
+	DiscountCents         int64
+	TaxCents              int64
+	TaxProvince           string
+	RefundedCents         int64
+	Currency              string
+	// FXRate is the rate the order was priced at ("1" in the base currency), or
+	// "" when the currency had none and every price was explicit.
+	FXRate     string
+	CouponCode string
+	Lines      []OrderLine
+}
+
+// OrderLine is one product/quantity pair belonging to an order, with the
+// variant sold, if any, as it was at checkout.
+type OrderLine struct {
+	ID             int
+	ProductID      int
+	ProductName    string
+	VariantID      int
+	VariantSKU     string
+	VariantOptions map[string]string
+	Quantity       int
+	UnitPriceCents int64
+	Subtotal       int64
+	// DiscountCents is the line's share of the order discount.
+	DiscountCents int64
+	TaxCategory   string
+	// TaxCents is the sum of Taxes, charged on Subtotal less DiscountCents.
+	TaxCents int64
+	Taxes    []tax.Amount
+}
+
+// StockShortfall reports one item that cannot be fulfilled.
+type StockShortfall struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id,omitempty"`
+	Requested int `json:"requested"`
+	Available int `json:"available"`
+}
+
+// InsufficientStockError is returned by CreatePending when items are short.
+type InsufficientStockError struct {
+	Items []StockShortfall
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for %d item(s)", len(e.Items))
+}
+
+// PriceMismatch reports an item whose base-currency price is not the one the
+// buyer expected.
+type PriceMismatch struct {
+	ProductID     int
+	VariantID     int
+	ExpectedCents int
+	CurrentCents  int
+}
+
+// PriceChangedError is returned by CreatePending when items are not at their
+// ExpectedPriceCents.
+type PriceChangedError struct {
+	Items []PriceMismatch
+}
+
+func (e *PriceChangedError) Error() string {
+	return fmt.Sprintf("price changed for %d item(s)", len(e.Items))
+}
+
+// Coupon discount types stored in coupons.discount_type.
+const (
+	CouponPercent = "percent"
+	CouponFixed   = "fixed"
+)
+
+// Coupon is an admin-managed discount code. Value is a percentage for
+// CouponPercent and an amount in base currency cents for CouponFixed. Nil limits
+// and validity bounds mean "no limit"; an empty ProductIDs applies to every product.
+type Coupon struct {
+	ID                    int        `json:"id"`
+	Code                  string     `json:"code"`
+	DiscountType          string     `json:"discount_type"`
+	Value                 int        `json:"value"`
+	MinOrderCents         int        `json:"min_order_cents"`
+	MaxRedemptions        *int       `json:"max_redemptions"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user"`
+	StartsAt              *time.Time `json:"starts_at"`
+	EndsAt                *time.Time `json:"ends_at"`
+	Active                bool       `json:"active"`
+	ProductIDs            []int      `json:"product_ids"`
+	TimesRedeemed         int        `json:"times_redeemed"`
+	DiscountedCents       int64      `json:"discounted_cents"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// HasBaseAmounts reports whether the coupon has amounts in the base currency, a
+// fixed Value or a MinOrderCents, that an order in another currency converts.
+func (c *Coupon) HasBaseAmounts() bool {
+	return c.DiscountType == CouponFixed || c.MinOrderCents > 0
+}
+
+// CouponInput holds the admin-editable fields of a coupon.
+type CouponInput struct {
+	Code                  string
+	DiscountType          string
+	Value                 int
+	MinOrderCents         int
+	MaxRedemptions        *int
+	MaxRedemptionsPerUser *int
+	StartsAt              *time.Time
+	EndsAt                *time.Time
+	Active                bool
+	ProductIDs            []int
+}
+
+// CouponError is returned by CreatePending when a coupon cannot be applied.
+type CouponError string
+
+func (e CouponError) Error() string {
+	return string(e)
+}
+
+// Apply checks that the coupon can be redeemed at now by a user who already
+// redeemed it redeemedByUser times (redeemed times in total), and spreads its
+// discount over the eligible lines, setting their DiscountCents. It returns the
+// total discount or a CouponError.
+func (c *Coupon) Apply(now time.Time, lines []OrderLine, redeemed, redeemedByUser int) (int64, error) {
+	switch {
+	case !c.Active:
+		return 0, CouponError("Coupon is not active")
+	case c.StartsAt != nil && now.Before(*c.StartsAt):
+		return 0, CouponError("Coupon is not valid yet")
+	case c.EndsAt != nil && !now.Before(*c.EndsAt):
+		return 0, CouponError("Coupon has expired")
+	case c.MaxRedemptions != nil && redeemed >= *c.MaxRedemptions:
+		return 0, CouponError("Coupon usage limit reached")
+	case c.MaxRedemptionsPerUser != nil && redeemedByUser >= *c.MaxRedemptionsPerUser:
+		return 0, CouponError("Coupon already used the maximum number of times")
+	}
+
+	eligible := map[int]bool{}
+	for _, id := range c.ProductIDs {
+		eligible[id] = true
+	}
+	var orderCents, eligibleCents int64
+	var eligibleLines []int
+	for i, l := range lines {
+		orderCents += l.Subtotal
+		if len(eligible) == 0 || eligible[l.ProductID] {
+			eligibleCents += l.Subtotal
+			eligibleLines = append(eligibleLines, i)
+		}
+	}
+	if orderCents < int64(c.MinOrderCents) {
+		return 0, CouponError(fmt.Sprintf("Coupon requires an order of at least %d cents", c.MinOrderCents))
+	}
+	if eligibleCents == 0 {
+		return 0, CouponError("Coupon does not apply to any item in this order")
+	}
+
+	var discount int64
+	switch c.DiscountType {
+	case CouponPercent:
+		discount = eligibleCents * int64(c.Value) / 100
+	case CouponFixed:
+		discount = min(int64(c.Value), eligibleCents)
+	}
+
+	// Split pro rata; the last eligible line takes the rounding remainder.
+	left := discount
+	for n, i := range eligibleLines {
+		share := discount * lines[i].Subtotal / eligibleCents
+		if n == len(eligibleLines)-1 {
+			share = left
+		}
+		lines[i].DiscountCents = share
+		left -= share
+	}
+	return discount, nil
+}
+
+// ProductNotFoundError is returned by CreatePending for an unknown product ID.
+type ProductNotFoundError int
+
+func (e ProductNotFoundError) Error() string {
+	return "Product not found: " + strconv.Itoa(int(e))
+}
+
+// ProductArchivedError is returned by CreatePending and CartStore.Add for an
+// archived product.
+type ProductArchivedError int
+
+func (e ProductArchivedError) Error() string {
+	return "Product " + strconv.Itoa(int(e)) + " is no longer available"
+}
+
+// HistoryItem is one order line in a user's purchase history. ProductName
+// is the product's name when it was bought; ProductID is 0 for products
+// deleted before products were archived instead.
+type HistoryItem struct {
+	OrderID         int               `json:"order_id"`
+	OrderLineID     int               `json:"order_line_id"`
+	OrderStatus     string            `json:"order_status"`
+	ProductID       int               `json:"product_id"`
+	ProductName     string            `json:"product_name"`
+	VariantID       *int              `json:"variant_id,omitempty"`
+	VariantSKU      string            `json:"variant_sku,omitempty"`
+	VariantOptions  map[string]string `json:"variant_options,omitempty"`
+	Quantity        int               `json:"quantity"`
+	UnitPriceCents  int64             `json:"unit_price_cents"`
+	TotalPriceCents int64             `json:"total_price_cents"`
+	DiscountCents   int64             `json:"discount_cents"`
+	TaxCents        int64             `json:"tax_cents"`
+	CouponCode      string            `json:"coupon_code,omitempty"`
+	RefundedQty     int               `json:"refunded_quantity"`
+	OrderRefunded   int64             `json:"order_refunded_cents"`
+	Currency        string            `json:"currency"`
+	PurchasedAt     time.Time         `json:"purchased_at"`
+}
+
+// SaleRecord is one sold order line (joined with order & user). The product
+// fields are as in HistoryItem.
+type SaleRecord struct {
+	OrderID         int               `json:"order_id"`
+	OrderLineID     int               `json:"order_line_id"`
+	OrderStatus     string            `json:"order_status"`
+	ProductID       int               `json:"product_id"`
+	ProductName     string            `json:"product_name"`
+	VariantID       *int              `json:"variant_id,omitempty"`
+	VariantSKU      string            `json:"variant_sku,omitempty"`
+	VariantOptions  map[string]string `json:"variant_options,omitempty"`
+	UserID          int               `json:"user_id"`
+	Username        string            `json:"username"`
+	Quantity        int               `json:"quantity"`
+	UnitPriceCents  int64             `json:"unit_price_cents"`
+	TotalPriceCents int64             `json:"total_price_cents"`
+	DiscountCents   int64             `json:"discount_cents"`
+	TaxCents        int64             `json:"tax_cents"`
+	CouponCode      string            `json:"coupon_code,omitempty"`
+	RefundedQty     int               `json:"refunded_quantity"`
+	OrderRefunded   int64             `json:"order_refunded_cents"`
+	Currency        string            `json:"currency"`
+	// BaseTotalPriceCents is TotalPriceCents in the base currency, at the
+	// order's exchange rate (see OrderStore.ListSales); nil when there is none.
+	BaseTotalPriceCents *int64    `json:"base_total_price_cents"`
+	PurchasedAt         time.Time `json:"purchased_at"`
+}
+
+// CurrencySalesTotal sums the paid orders of one currency. NetCents is what was
+// charged less refunds; BaseNetCents is the same in the base currency, at each
+// order's exchange rate (see OrderStore.ListSales).
+type CurrencySalesTotal struct {
+	Currency      string `json:"currency"`
+	Orders        int    `json:"orders"`
+	GrossCents    int64  `json:"gross_cents"`
+	DiscountCents int64  `json:"discount_cents"`
+	TaxCents      int64  `json:"tax_cents"`
+	RefundedCents int64  `json:"refunded_cents"`
+	NetCents      int64  `json:"net_cents"`
+	BaseNetCents  int64  `json:"base_net_cents"`
+}
+
+// SalesFilter narrows ListSales. Zero values mean "no filter"; To is exclusive.
+type SalesFilter struct {
+	From     time.Time
+	To       time.Time
+	Username string
+	// CouponCode keeps only orders that redeemed this coupon (case-insensitive).
+	CouponCode string
+	Currency   string
+}
+
+// TaxReportFilter narrows TaxReport. Zero values mean "no filter"; To is exclusive.
+type TaxReportFilter struct {
+	From time.Time
+	To   time.Time
+}
+
+// ProvinceTaxSummary is the sales and tax of one billing province over a period.
+// Amounts are in the base currency and net of per-line refunds.
+type ProvinceTaxSummary struct {
+	Province            string           `json:"province"`
+	Orders              int              `json:"orders"`
+	TaxableSalesCents   int64            `json:"taxable_sales_cents"`
+	ZeroRatedSalesCents int64            `json:"zero_rated_sales_cents"`
+	ExemptSalesCents    int64            `json:"exempt_sales_cents"`
+	TaxCents            int64            `json:"tax_cents"`
+	Taxes               []TaxTypeSummary `json:"taxes"`
+}
+
+// TaxTypeSummary is the tax collected for one tax type and rate.
+type TaxTypeSummary struct {
+	Type        string `json:"type"`
+	RatePercent string `json:"rate_percent"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// RefundableOrder is a locked order as seen by a refund in progress.
+type RefundableOrder struct {
+	ID                    int
+	Status                string
+	StripePaymentIntentID string
+	TotalCents            int64
+	RefundedCents         int64
+	Lines                 map[int]RefundableLine
+}
+
+// RefundableLine is an order line with what is still refundable on it.
+type RefundableLine struct {
+	ID        int
+	ProductID *int
+	// VariantSKU is set if a variant was sold; VariantID is then nil if it has
+	// since been deleted.
+	VariantID      *int
+	VariantSKU     string
+	Quantity       int
+	RefundedQty    int
+	UnitPriceCents int64
+	DiscountCents  int64
+	TaxCents       int64
+}
+
+// AmountFor returns what refunding qty more units of the line is worth: net of
+// the line's discount, tax included. Rounding is spread so that refunding every
+// unit returns exactly what was paid for the line.
+func (l RefundableLine) AmountFor(qty int) int64 {
+	paid := l.UnitPriceCents*int64(l.Quantity) - l.DiscountCents + l.TaxCents
+	n := int64(l.Quantity)
+	return paid*int64(l.RefundedQty+qty)/n - paid*int64(l.RefundedQty)/n
+}
+
+// RefundLine is the quantity refunded on one order line.
+type RefundLine struct {
+	OrderLineID int `json:"order_line_id"`
+	Quantity    int `json:"quantity"`
+}
+
+// Refund is a (partial) refund of an order.
+type Refund struct {
+	ID             int          `json:"id"`
+	OrderID        int          `json:"order_id"`
+	StripeRefundID string       `json:"stripe_refund_id"`
+	AmountCents    int64        `json:"amount_cents"`
+	Status         string       `json:"status"`
+	Reason         string       `json:"reason"`
+	Restocked      bool         `json:"restocked"`
+	Lines          []RefundLine `json:"lines"`
+	OrderStatus    string       `json:"order_status"`
+	RefundedCents  int64        `json:"order_refunded_cents"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// Payment event types understood by ApplyPaymentEvent.
+const (
+	PaymentEventSucceeded      = "payment_intent.succeeded"
+	PaymentEventFailed         = "payment_intent.payment_failed"
+	PaymentEventRefunded       = "charge.refunded"
+	PaymentEventDisputeCreated = "charge.dispute.created"
+	// PaymentEventSetupSucceeded is only recorded; the card it saves is stored
+	// through CardStore.
+	PaymentEventSetupSucceeded = "setup_intent.succeeded"
+)
+
+// PaymentEvent is a provider webhook event reduced to what orders need.
+type PaymentEvent struct {
+	ID              string
+	Type            string
+	PaymentIntentID string
+	// OrderID is the order the PaymentIntent was created for (its order_id
+	// metadata). It links the intent to an order that has none recorded, because
+	// the response creating it was lost.
+	OrderID int
+	// FullyRefunded and AmountRefunded are set for PaymentEventRefunded.
+	FullyRefunded  bool
+	AmountRefunded int64
+}
+
+// StoredResponse is a response kept for idempotent replay.
+type StoredResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyRecord is a claimed idempotency key.
+type IdempotencyRecord struct {
+	RequestHash string
+	Response    *StoredResponse
+}
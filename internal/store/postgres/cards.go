@@ -0,0 +1,275 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CardStore implements store.CardStore.
+type CardStore struct {
+	db *sql.DB
+}
+
+const cardColumns = `id, user_id, stripe_payment_method_id, brand, last4, exp_month, exp_year, fingerprint, is_default, expiry_status`
+
+func (s *CardStore) Create(c *store.Card) error {
+	err := s.db.QueryRow(
+		`INSERT INTO credit_cards
+       (user_id, stripe_payment_method_id, brand, last4, exp_month, exp_year, fingerprint, expiry_status, is_default)
+     VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8,
+             NOT EXISTS(SELECT 1 FROM credit_cards WHERE user_id = $1 AND is_default))
+     RETURNING id, is_default;`,
+		c.UserID, c.StripePaymentMethodID, c.Brand, c.Last4, c.ExpMonth, c.ExpYear, c.Fingerprint, c.ExpiryStatus,
+	).Scan(&c.ID, &c.IsDefault)
+	if isUniqueViolation(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *CardStore) Get(cardID int) (*store.Card, error) {
+	return s.getBy(`id = $1`, cardID)
+}
+
+func (s *CardStore) GetForUser(cardID, userID int) (*store.Card, error) {
+	return s.getBy(`id = $1 AND user_id = $2`, cardID, userID)
+}
+
+func (s *CardStore) GetByPaymentMethod(paymentMethodID string) (*store.Card, error) {
+	return s.getBy(`stripe_payment_method_id = $1`, paymentMethodID)
+}
+
+func (s *CardStore) GetByFingerprint(userID int, fingerprint string) (*store.Card, error) {
+	return s.getBy(`user_id = $1 AND fingerprint = $2`, userID, fingerprint)
+}
+
+func (s *CardStore) GetDefault(userID int) (*store.Card, error) {
+	return s.getBy(`user_id = $1 AND is_default`, userID)
+}
+
+func (s *CardStore) getBy(where string, args ...interface{}) (*store.Card, error) {
+	c, err := scanCard(s.db.QueryRow(
+		`SELECT `+cardColumns+`
+       FROM credit_cards
+      WHERE `+where+`;`,
+		args...,
+	))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (s *CardStore) ListForUser(userID int) ([]store.Card, error) {
+	return s.list(
+		`SELECT `+cardColumns+`
+       FROM credit_cards
+      WHERE user_id = $1
+      ORDER BY is_default DESC, id DESC;`,
+		userID,
+	)
+}
+
+func (s *CardStore) ListUnexpired() ([]store.Card, error) {
+	return s.list(
+		`SELECT `+cardColumns+`
+       FROM credit_cards
+      WHERE expiry_status <> $1
+      ORDER BY id;`,
+		store.CardStatusExpired,
+	)
+}
+
+func (s *CardStore) list(query string, args ...interface{}) ([]store.Card, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := make([]store.Card, 0)
+	for rows.Next() {
+		c, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *c)
+	}
+	return cards, rows.Err()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCard(row rowScanner) (*store.Card, error) {
+	var (
+		c        store.Card
+		brand    sql.NullString
+		last4    sql.NullString
+		expMonth sql.NullInt64
+		expYear  sql.NullInt64
+		fp       sql.NullString
+	)
+	err := row.Scan(&c.ID, &c.UserID, &c.StripePaymentMethodID, &brand, &last4, &expMonth, &expYear, &fp, &c.IsDefault, &c.ExpiryStatus)
+	if err != nil {
+		return nil, err
+	}
+	c.Brand, c.Last4, c.Fingerprint = brand.String, last4.String, fp.String
+	c.ExpMonth, c.ExpYear = int(expMonth.Int64), int(expYear.Int64)
+	return &c, nil
+}
+
+func (s *CardStore) SetDefault(userID, cardID int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		// Clear the old default first: at most one default per user is enforced by an index.
+		if _, err := tx.Exec(
+			`UPDATE credit_cards SET is_default = FALSE WHERE user_id = $1 AND is_default;`,
+			userID,
+		); err != nil {
+			return err
+		}
+		res, err := tx.Exec(
+			`UPDATE credit_cards SET is_default = TRUE WHERE id = $1 AND user_id = $2;`,
+			cardID, userID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *CardStore) Delete(cardID int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		var (
+			userID    int
+			isDefault bool
+		)
+		err := tx.QueryRow(
+			`DELETE FROM credit_cards WHERE id = $1 RETURNING user_id, is_default;`,
+			cardID,
+		).Scan(&userID, &isDefault)
+		if err != nil {
+			return notFound(err)
+		}
+		if !isDefault {
+			return nil
+		}
+		next, err := newestUnexpiredCard(tx, userID)
+		if err != nil || next == 0 {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE credit_cards SET is_default = TRUE WHERE id = $1;`, next)
+		return err
+	})
+}
+
+// newestUnexpiredCard locks the user's cards and returns the ID of the most
+// recently added one that has not expired, or 0 if there is none. Expired cards
+// cannot be the default, whatever the expiry job last flagged.
+func newestUnexpiredCard(tx *sql.Tx, userID int) (int, error) {
+	rows, err := tx.Query(
+		`SELECT `+cardColumns+`
+       FROM credit_cards
+      WHERE user_id = $1
+      ORDER BY id DESC
+        FOR UPDATE;`,
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c, err := scanCard(rows)
+		if err != nil {
+			return 0, err
+		}
+		if c.ExpiryStatus != store.CardStatusExpired && !c.Expired(time.Now()) {
+			return c.ID, nil
+		}
+	}
+	return 0, rows.Err()
+}
+
+func (s *CardStore) SetExpiryStatus(cardID int, status string) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		var (
+			userID    int
+			isDefault bool
+		)
+		err := tx.QueryRow(
+			`UPDATE credit_cards SET expiry_status = $1
+        WHERE id = $2 AND expiry_status <> $1
+        RETURNING user_id, is_default;`,
+			status, cardID,
+		).Scan(&userID, &isDefault)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil || status == store.CardStatusValid {
+			return err
+		}
+		if status == store.CardStatusExpired && isDefault {
+			next, err := newestUnexpiredCard(tx, userID)
+			if err != nil {
+				return err
+			}
+			if next != 0 {
+				if _, err := tx.Exec(`UPDATE credit_cards SET is_default = FALSE WHERE id = $1;`, cardID); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(`UPDATE credit_cards SET is_default = TRUE WHERE id = $1;`, next); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = tx.Exec(
+			`INSERT INTO card_expiry_events (card_id, user_id, status) VALUES ($1, $2, $3);`,
+			cardID, userID, status,
+		)
+		return err
+	})
+}
+
+func (s *CardStore) ListExpiryEvents(userID int) ([]store.CardExpiryEvent, error) {
+	rows, err := s.db.Query(
+		`SELECT e.id, e.card_id, c.brand, c.last4, c.exp_month, c.exp_year, e.status, e.created_at
+       FROM card_expiry_events e
+       JOIN credit_cards c ON c.id = e.card_id
+      WHERE e.user_id = $1
+      ORDER BY e.id DESC;`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]store.CardExpiryEvent, 0)
+	for rows.Next() {
+		var (
+			e        store.CardExpiryEvent
+			brand    sql.NullString
+			last4    sql.NullString
+			expMonth sql.NullInt64
+			expYear  sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.CardID, &brand, &last4, &expMonth, &expYear, &e.Status, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Brand, e.Last4 = brand.String, last4.String
+		e.ExpMonth, e.ExpYear = int(expMonth.Int64), int(expYear.Int64)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
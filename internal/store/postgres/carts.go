@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CartStore implements store.CartStore.
+type CartStore struct {
+	db *sql.DB
+}
+
+// cartItemSelect reads items with the current price (see currentPriceExpr)
+// and stock of their variant, if any, else of their product, and the pending
+// order they are checked out in. Archived products are never in stock.
+const cartItemSelect = `
+    SELECT ci.id, ci.product_id, p.name, ci.variant_id, v.sku, v.options, ci.quantity, ci.price_cents,
+           ` + currentPriceExpr + `,
+           p.archived_at IS NULL AND
+           CASE WHEN v.id IS NULL THEN p.unlimited_stock OR p.stock_quantity >= ci.quantity
+                ELSE v.unlimited_stock OR v.stock_quantity >= ci.quantity END,
+           o.id, ci.added_at
+      FROM cart_items ci
+      JOIN products p ON p.id = ci.product_id
+      LEFT JOIN product_variants v ON v.id = ci.variant_id
+      LEFT JOIN orders o ON o.id = ci.order_id AND o.status = 'pending'`
+
+func (s *CartStore) List(userID int) ([]store.CartItem, error) {
+	rows, err := s.db.Query(cartItemSelect+`
+     WHERE ci.user_id = $1
+     ORDER BY ci.id;`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]store.CartItem, 0)
+	for rows.Next() {
+		it, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *it)
+	}
+	return items, rows.Err()
+}
+
+func (s *CartStore) Add(userID, productID, variantID, quantity int) (*store.CartItem, error) {
+	var itemID int
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		// The variant must be one of the product's; products sold in variants
+		// are only added through one
+		var price, variantProductID sql.NullInt64
+		var hasVariants, archived bool
+		err := tx.QueryRow(
+			`SELECT p.price_cents,
+              EXISTS (SELECT 1 FROM product_variants x WHERE x.product_id = p.id),
+              p.archived_at IS NOT NULL,
+              v.product_id, v.price_cents
+         FROM products p
+         LEFT JOIN product_variants v ON v.id = $2
+        WHERE p.id = $1;`,
+			productID, variantID,
+		).Scan(new(int), &hasVariants, &archived, &variantProductID, &price)
+		if err == sql.ErrNoRows {
+			return store.ProductNotFoundError(productID)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case archived:
+			return store.ProductArchivedError(productID)
+		case variantID != 0 && (!variantProductID.Valid || int(variantProductID.Int64) != productID):
+			return &store.VariantNotFoundError{ProductID: productID, VariantID: variantID}
+		case variantID == 0 && hasVariants:
+			return store.VariantRequiredError(productID)
+		}
+
+		return tx.QueryRow(
+			`INSERT INTO cart_items (user_id, product_id, variant_id, quantity, price_cents)
+       SELECT $1, p.id, v.id, $4, `+currentPriceExpr+`
+         FROM products p
+         LEFT JOIN product_variants v ON v.id = $3
+        WHERE p.id = $2
+       ON CONFLICT (user_id, product_id, (COALESCE(variant_id, 0)))
+       DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity, order_id = NULL, updated_at = NOW()
+       RETURNING id;`,
+			userID, productID, variantID, quantity,
+		).Scan(&itemID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.get(userID, itemID)
+}
+
+func (s *CartStore) SetQuantity(userID, itemID, quantity int) (*store.CartItem, error) {
+	res, err := s.db.Exec(
+		`UPDATE cart_items SET quantity = $1, order_id = NULL, updated_at = NOW() WHERE id = $2 AND user_id = $3;`,
+		quantity, itemID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, store.ErrNotFound
+	}
+	return s.get(userID, itemID)
+}
+
+func (s *CartStore) Remove(userID, itemID int) error {
+	res, err := s.db.Exec(`DELETE FROM cart_items WHERE id = $1 AND user_id = $2;`, itemID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *CartStore) Clear(userID int) error {
+	_, err := s.db.Exec(`DELETE FROM cart_items WHERE user_id = $1;`, userID)
+	return err
+}
+
+func (s *CartStore) get(userID, itemID int) (*store.CartItem, error) {
+	it, err := scanCartItem(s.db.QueryRow(cartItemSelect+`
+     WHERE ci.id = $1 AND ci.user_id = $2;`,
+		itemID, userID,
+	))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return it, nil
+}
+
+// scanCartItem reads one row selected with cartItemSelect.
+func scanCartItem(row rowScanner) (*store.CartItem, error) {
+	var (
+		it        store.CartItem
+		variantID sql.NullInt64
+		sku       sql.NullString
+		options   []byte
+		orderID   sql.NullInt64
+	)
+	if err := row.Scan(
+		&it.ID, &it.ProductID, &it.ProductName, &variantID, &sku, &options, &it.Quantity, &it.PriceCents,
+		&it.CurrentPriceCents, &it.InStock, &orderID, &it.AddedAt,
+	); err != nil {
+		return nil, err
+	}
+	it.VariantID, it.VariantSKU, it.OrderID = int(variantID.Int64), sku.String, int(orderID.Int64)
+	if options != nil {
+		if err := json.Unmarshal(options, &it.VariantOptions); err != nil {
+			return nil, err
+		}
+	}
+	it.PriceChanged = it.PriceCents != it.CurrentPriceCents
+	return &it, nil
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CategoryStore implements store.CategoryStore.
+type CategoryStore struct {
+	db *sql.DB
+}
+
+const categorySelect = `
+    SELECT c.id, c.parent_id, c.name, c.slug,
+           (SELECT COUNT(*) FROM product_categories pc JOIN products p ON p.id = pc.product_id
+             WHERE pc.category_id = c.id AND p.archived_at IS NULL),
+           c.created_at
+      FROM categories c`
+
+// categorySubtree returns SQL selecting the IDs of the categories matching cond
+// and of all their subcategories.
+func categorySubtree(cond string) string {
+	return `WITH RECURSIVE subtree AS (
+          SELECT id FROM categories WHERE ` + cond + `
+          UNION ALL
+          SELECT c.id FROM categories c JOIN subtree ON c.parent_id = subtree.id)
+        SELECT id FROM subtree`
+}
+
+func (s *CategoryStore) List() ([]store.Category, error) {
+	rows, err := s.db.Query(categorySelect + `
+     ORDER BY c.name, c.id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]store.Category, 0)
+	for rows.Next() {
+		var c store.Category
+		if err := scanCategory(rows, &c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (s *CategoryStore) GetBySlug(slug string) (*store.Category, error) {
+	var c store.Category
+	if err := scanCategory(s.db.QueryRow(categorySelect+`
+     WHERE c.slug = $1;`, slug), &c); err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *CategoryStore) get(id int) (*store.Category, error) {
+	var c store.Category
+	if err := scanCategory(s.db.QueryRow(categorySelect+`
+     WHERE c.id = $1;`, id), &c); err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *CategoryStore) Create(in store.CategoryInput) (*store.Category, error) {
+	var id int
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := checkCategoryParent(tx, 0, in.ParentID); err != nil {
+			return err
+		}
+		err := tx.QueryRow(
+			`INSERT INTO categories (parent_id, name, slug) VALUES ($1, $2, $3) RETURNING id;`,
+			nullInt(in.ParentID), in.Name, in.Slug,
+		).Scan(&id)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.get(id)
+}
+
+func (s *CategoryStore) Update(id int, in store.CategoryInput) (*store.Category, error) {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := checkCategoryParent(tx, id, in.ParentID); err != nil {
+			return err
+		}
+		res, err := tx.Exec(
+			`UPDATE categories SET parent_id = $1, name = $2, slug = $3 WHERE id = $4;`,
+			nullInt(in.ParentID), in.Name, in.Slug, id,
+		)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.get(id)
+}
+
+func (s *CategoryStore) Delete(id int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		var hasChildren bool
+		err := tx.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = c.id)
+         FROM categories c WHERE c.id = $1 FOR UPDATE;`,
+			id,
+		).Scan(&hasChildren)
+		if err != nil {
+			return notFound(err)
+		}
+		if hasChildren {
+			return store.ErrCategoryNotEmpty
+		}
+		_, err = tx.Exec(`DELETE FROM categories WHERE id = $1;`, id)
+		return err
+	})
+}
+
+// checkCategoryParent checks that parentID (if any) exists and, for an existing
+// category id, is not id itself or one of its subcategories. The table is locked
+// against concurrent moves, which could otherwise close a cycle together.
+func checkCategoryParent(tx *sql.Tx, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := tx.Exec(`LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE;`); err != nil {
+		return err
+	}
+
+	var exists, cycle bool
+	err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1),
+            $1 IN (`+categorySubtree("id = $2")+`);`,
+		*parentID, id,
+	).Scan(&exists, &cycle)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return store.CategoryNotFoundError(*parentID)
+	}
+	if cycle {
+		return store.ErrCategoryCycle
+	}
+	return nil
+}
+
+func scanCategory(row rowScanner, c *store.Category) error {
+	var parentID sql.NullInt64
+	if err := row.Scan(&c.ID, &parentID, &c.Name, &c.Slug, &c.ProductCount, &c.CreatedAt); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		c.ParentID = &id
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// CouponStore implements store.CouponStore.
+type CouponStore struct {
+	db *sql.DB
+}
+
+const couponColumns = `c.id, c.code, c.discount_type, c.value, c.min_order_cents,
+       c.max_redemptions, c.max_redemptions_per_user, c.starts_at, c.ends_at, c.active, c.created_at,
+       ARRAY(SELECT cp.product_id FROM coupon_products cp WHERE cp.coupon_id = c.id ORDER BY cp.product_id)`
+
+// couponSelect adds the redemption totals, in the base currency; orders that
+// failed do not count.
+const couponSelect = `
+    SELECT ` + couponColumns + `,
+           COALESCE(r.redeemed, 0), COALESCE(r.discounted_cents, 0)
+      FROM coupons c
+      LEFT JOIN (SELECT od.coupon_id, COUNT(*) AS redeemed,
+                        SUM(ROUND(od.amount_cents / ` + orderRate + `))::bigint AS discounted_cents
+                   FROM order_discounts od
+                   JOIN orders o ON o.id = od.order_id
+                  WHERE o.status <> 'failed'
+                  GROUP BY od.coupon_id) r ON r.coupon_id = c.id`
+
+func (s *CouponStore) Create(in store.CouponInput) (*store.Coupon, error) {
+	var id int
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`INSERT INTO coupons
+         (code, discount_type, value, min_order_cents, max_redemptions, max_redemptions_per_user,
+          starts_at, ends_at, active)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+       RETURNING id;`,
+			in.Code, in.DiscountType, in.Value, in.MinOrderCents, nullInt(in.MaxRedemptions),
+			nullInt(in.MaxRedemptionsPerUser), nullTimestamp(in.StartsAt), nullTimestamp(in.EndsAt), in.Active,
+		).Scan(&id)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		return setCouponProducts(tx, id, in.ProductIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(id)
+}
+
+func (s *CouponStore) List() ([]store.Coupon, error) {
+	rows, err := s.db.Query(couponSelect + `
+     ORDER BY c.id DESC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := make([]store.Coupon, 0)
+	for rows.Next() {
+		var c store.Coupon
+		if err := scanCoupon(rows, &c, &c.TimesRedeemed, &c.DiscountedCents); err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+	return coupons, rows.Err()
+}
+
+func (s *CouponStore) Get(id int) (*store.Coupon, error) {
+	var c store.Coupon
+	err := scanCoupon(s.db.QueryRow(couponSelect+`
+     WHERE c.id = $1;`, id), &c, &c.TimesRedeemed, &c.DiscountedCents)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *CouponStore) Update(id int, in store.CouponInput) (*store.Coupon, error) {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE coupons
+          SET code = $1, discount_type = $2, value = $3, min_order_cents = $4, max_redemptions = $5,
+              max_redemptions_per_user = $6, starts_at = $7, ends_at = $8, active = $9
+        WHERE id = $10;`,
+			in.Code, in.DiscountType, in.Value, in.MinOrderCents, nullInt(in.MaxRedemptions),
+			nullInt(in.MaxRedemptionsPerUser), nullTimestamp(in.StartsAt), nullTimestamp(in.EndsAt), in.Active, id,
+		)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+
+		if _, err := tx.Exec(`DELETE FROM coupon_products WHERE coupon_id = $1;`, id); err != nil {
+			return err
+		}
+		return setCouponProducts(tx, id, in.ProductIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(id)
+}
+
+func (s *CouponStore) Delete(id int) error {
+	res, err := s.db.Exec(`DELETE FROM coupons WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// setCouponProducts restricts a coupon to productIDs, which must all exist.
+func setCouponProducts(tx *sql.Tx, couponID int, productIDs []int) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(productIDs))
+	for i, id := range productIDs {
+		ids[i] = int64(id)
+	}
+
+	var missing int
+	err := tx.QueryRow(
+		`SELECT want.id FROM unnest($1::int[]) AS want(id)
+      WHERE NOT EXISTS (SELECT 1 FROM products p WHERE p.id = want.id)
+      LIMIT 1;`,
+		pq.Array(ids),
+	).Scan(&missing)
+	if err == nil {
+		return store.ProductNotFoundError(missing)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO coupon_products (coupon_id, product_id)
+     SELECT $1, id FROM products WHERE id = ANY($2)
+     ON CONFLICT DO NOTHING;`,
+		couponID, pq.Array(ids),
+	)
+	return err
+}
+
+// lockCoupon locks the coupon with code (case-insensitive) for a checkout and
+// returns it with how often it was redeemed, in total and by userID.
+func lockCoupon(tx *sql.Tx, code string, userID int) (c *store.Coupon, redeemed, redeemedByUser int, err error) {
+	c = &store.Coupon{}
+	err = scanCoupon(tx.QueryRow(
+		`SELECT `+couponColumns+`
+       FROM coupons c
+      WHERE LOWER(c.code) = LOWER($1)
+      FOR UPDATE;`,
+		code,
+	), c)
+	if err == sql.ErrNoRows {
+		return nil, 0, 0, store.CouponError("Coupon not found")
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	err = tx.QueryRow(
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE od.user_id = $2)
+       FROM order_discounts od
+       JOIN orders o ON o.id = od.order_id
+      WHERE od.coupon_id = $1 AND o.status <> $3;`,
+		c.ID, userID, store.OrderStatusFailed,
+	).Scan(&redeemed, &redeemedByUser)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return c, redeemed, redeemedByUser, nil
+}
+
+// scanCoupon reads couponColumns into c, followed by extra.
+func scanCoupon(row rowScanner, c *store.Coupon, extra ...interface{}) error {
+	var (
+		maxTotal, maxPerUser sql.NullInt64
+		startsAt, endsAt     sql.NullTime
+		productIDs           []int64
+	)
+	dest := []interface{}{
+		&c.ID, &c.Code, &c.DiscountType, &c.Value, &c.MinOrderCents,
+		&maxTotal, &maxPerUser, &startsAt, &endsAt, &c.Active, &c.CreatedAt,
+		pq.Array(&productIDs),
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if maxTotal.Valid {
+		n := int(maxTotal.Int64)
+		c.MaxRedemptions = &n
+	}
+	if maxPerUser.Valid {
+		n := int(maxPerUser.Int64)
+		c.MaxRedemptionsPerUser = &n
+	}
+	if startsAt.Valid {
+		c.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		c.EndsAt = &endsAt.Time
+	}
+	c.ProductIDs = make([]int, len(productIDs))
+	for i, id := range productIDs {
+		c.ProductIDs[i] = int(id)
+	}
+	return nil
+}
+
+// nullInt binds an optional integer.
+func nullInt(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+// nullTimestamp binds an optional time to a TIMESTAMP column, in UTC.
+func nullTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(timestampLayout)
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+func (s *OrderStore) SeenPaymentEvent(eventID string) (bool, error) {
+	var seen bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM stripe_events WHERE id = $1);`, eventID).Scan(&seen)
+	return seen, err
+}
+
+func (s *OrderStore) ApplyPaymentEvent(ev store.PaymentEvent) (bool, error) {
+	applied := false
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		// Deduplicate by event ID: providers deliver at least once.
+		res, err := tx.Exec(
+			`INSERT INTO stripe_events (id, type)
+       VALUES ($1, $2)
+       ON CONFLICT (id) DO NOTHING;`,
+			ev.ID, ev.Type,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		applied = true
+
+		if ev.PaymentIntentID == "" {
+			return nil
+		}
+		// An order whose intent was created without us learning its ID gets it now
+		if ev.OrderID != 0 {
+			_, err := tx.Exec(
+				`UPDATE orders SET stripe_payment_intent_id = $1, updated_at = NOW()
+          WHERE id = $2 AND stripe_payment_intent_id IS NULL;`,
+				ev.PaymentIntentID, ev.OrderID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		switch ev.Type {
+		case store.PaymentEventSucceeded:
+			return markOrderPaid(tx, ev.PaymentIntentID)
+
+		case store.PaymentEventFailed:
+			// Pending orders hold a stock reservation that has to be released.
+			var orderID int
+			err := tx.QueryRow(
+				`SELECT id FROM orders WHERE stripe_payment_intent_id = $1 FOR UPDATE;`,
+				ev.PaymentIntentID,
+			).Scan(&orderID)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return failOrder(tx, orderID)
+
+		case store.PaymentEventRefunded:
+			status := store.OrderStatusPartiallyRefunded
+			if ev.FullyRefunded {
+				status = store.OrderStatusRefunded
+			}
+			// Only orders that were paid can be refunded, and refunded_cents never
+			// goes down (e.g. when an older refund event arrives late).
+			_, err := tx.Exec(
+				`UPDATE orders
+           SET status = $1, refunded_cents = $2, updated_at = NOW()
+         WHERE stripe_payment_intent_id = $3
+           AND status = ANY($4)
+           AND refunded_cents <= $2;`,
+				status, ev.AmountRefunded, ev.PaymentIntentID, pq.Array(refundableOrderStatuses),
+			)
+			return err
+
+		case store.PaymentEventDisputeCreated:
+			return setOrderStatus(tx, ev.PaymentIntentID, store.OrderStatusDisputed)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// refundableOrderStatuses are the statuses a refund event may move an order from.
+var refundableOrderStatuses = []string{
+	store.OrderStatusPaid,
+	store.OrderStatusPartiallyRefunded,
+	store.OrderStatusRefunded,
+	store.OrderStatusNeedsReview,
+}
+
+// markOrderPaid records a successful payment for the order of paymentIntentID.
+// Pending orders become paid. A failed order has already released its stock,
+// so it takes the stock back if it is still there and is otherwise left in
+// needs_review for an admin to refund. Other orders are never moved backwards.
+// Either way the cart items the order checked out are removed.
+func markOrderPaid(tx *sql.Tx, paymentIntentID string) error {
+	var (
+		orderID int
+		status  string
+	)
+	err := tx.QueryRow(
+		`SELECT id, status FROM orders WHERE stripe_payment_intent_id = $1 FOR UPDATE;`,
+		paymentIntentID,
+	).Scan(&orderID, &status)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	next := store.OrderStatusPaid
+	switch status {
+	case store.OrderStatusPending:
+	case store.OrderStatusFailed:
+		reclaimed, err := reclaimOrderStock(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !reclaimed {
+			next = store.OrderStatusNeedsReview
+		}
+	default:
+		return nil
+	}
+	_, err = tx.Exec(
+		`UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2;`,
+		next, orderID,
+	)
+	if err != nil {
+		return err
+	}
+	return removeCheckedOutItems(tx, orderID)
+}
+
+// setOrderStatus moves the order for paymentIntentID to status. When fromStatuses
+// is non-empty the update only applies to orders currently in one of them.
+func setOrderStatus(tx *sql.Tx, paymentIntentID, status string, fromStatuses ...string) error {
+	query := `UPDATE orders SET status = $1, updated_at = NOW()
+   WHERE stripe_payment_intent_id = $2`
+	args := []interface{}{status, paymentIntentID}
+	if len(fromStatuses) > 0 {
+		query += ` AND status = ANY($3)`
+		args = append(args, pq.Array(fromStatuses))
+	}
+	_, err := tx.Exec(query+";", args...)
+	return err
+}
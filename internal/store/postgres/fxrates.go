@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql"
+	"math/big"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// FXRateStore implements store.FXRateStore.
+type FXRateStore struct {
+	db *sql.DB
+}
+
+func (s *FXRateStore) List() ([]store.FXRate, error) {
+	rows, err := s.db.Query(`SELECT currency, rate::text, updated_at FROM fx_rates ORDER BY currency;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]store.FXRate, 0)
+	for rows.Next() {
+		r, err := scanFXRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, *r)
+	}
+	return rates, rows.Err()
+}
+
+func (s *FXRateStore) Get(currency string) (*store.FXRate, error) {
+	r, err := scanFXRate(s.db.QueryRow(
+		`SELECT currency, rate::text, updated_at FROM fx_rates WHERE currency = $1;`,
+		currency,
+	))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return r, nil
+}
+
+func (s *FXRateStore) Set(currency, rate string) (*store.FXRate, error) {
+	return scanFXRate(s.db.QueryRow(
+		`INSERT INTO fx_rates (currency, rate)
+     VALUES ($1, $2)
+     ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+     RETURNING currency, rate::text, updated_at;`,
+		currency, rate,
+	))
+}
+
+func (s *FXRateStore) Delete(currency string) error {
+	res, err := s.db.Exec(`DELETE FROM fx_rates WHERE currency = $1;`, currency)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// scanFXRate reads a (currency, rate::text, updated_at) row, trimming the
+// rate's trailing zeros.
+func scanFXRate(row rowScanner) (*store.FXRate, error) {
+	var r store.FXRate
+	if err := row.Scan(&r.Currency, &r.Rate, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if rate, ok := money.ParseRate(r.Rate); ok {
+		r.Rate = money.FormatRate(rate)
+	}
+	return &r, nil
+}
+
+// lockFXRate returns the rate of currency for pricing an order in it; nil for
+// the base currency or a currency without a rate, which can still be sold at
+// explicit prices.
+func lockFXRate(tx *sql.Tx, currency string) (*big.Rat, error) {
+	if currency == money.Base {
+		return nil, nil
+	}
+	var rate string
+	err := tx.QueryRow(
+		`SELECT rate::text FROM fx_rates WHERE currency = $1 FOR SHARE;`,
+		currency,
+	).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, ok := money.ParseRate(rate)
+	if !ok {
+		return nil, store.UnsupportedCurrencyError(currency)
+	}
+	return r, nil
+}
+
+// orderRate is the rate converting an order's amounts to the base currency:
+// the one it was priced at or, for an order priced without one, the currency's
+// current rate. It is NULL when the currency has no rate.
+const orderRate = `COALESCE(o.fx_rate, (SELECT r.rate FROM fx_rates r WHERE r.currency = o.currency))`
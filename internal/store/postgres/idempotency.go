@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// IdempotencyStore implements store.IdempotencyStore.
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+func (s *IdempotencyStore) Claim(userID int, key, requestHash string, staleAfter time.Duration) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash)
+     VALUES ($1, $2, $3)
+     ON CONFLICT (user_id, idempotency_key) DO UPDATE SET created_at = NOW()
+      WHERE idempotency_keys.response_status IS NULL
+        AND idempotency_keys.request_hash = EXCLUDED.request_hash
+        AND idempotency_keys.created_at < NOW() - make_interval(secs => $4);`,
+		userID, key, requestHash, staleAfter.Seconds(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *IdempotencyStore) Get(userID int, key string) (*store.IdempotencyRecord, error) {
+	var (
+		rec         store.IdempotencyRecord
+		status      sql.NullInt64
+		contentType sql.NullString
+		body        []byte
+	)
+	err := s.db.QueryRow(
+		`SELECT request_hash, response_status, response_content_type, response_body
+       FROM idempotency_keys
+      WHERE user_id = $1 AND idempotency_key = $2;`,
+		userID, key,
+	).Scan(&rec.RequestHash, &status, &contentType, &body)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if status.Valid {
+		rec.Response = &store.StoredResponse{
+			Status:      int(status.Int64),
+			ContentType: contentType.String,
+			Body:        body,
+		}
+	}
+	return &rec, nil
+}
+
+func (s *IdempotencyStore) Save(userID int, key string, resp store.StoredResponse) error {
+	_, err := s.db.Exec(
+		`UPDATE idempotency_keys
+        SET response_status = $1, response_content_type = $2, response_body = $3
+      WHERE user_id = $4 AND idempotency_key = $5;`,
+		resp.Status, resp.ContentType, resp.Body, userID, key,
+	)
+	return err
+}
+
+func (s *IdempotencyStore) Release(userID int, key string) error {
+	_, err := s.db.Exec(
+		`DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2;`,
+		userID, key,
+	)
+	return err
+}
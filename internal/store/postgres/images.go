@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// ProductImageStore implements store.ProductImageStore.
+type ProductImageStore struct {
+	db *sql.DB
+}
+
+const imageColumns = `id, product_id, storage_key, thumbnail_key, content_type, width, height, position, is_primary`
+
+func scanImage(row rowScanner, img *store.ProductImage) error {
+	return row.Scan(
+		&img.ID, &img.ProductID, &img.Key, &img.ThumbnailKey, &img.ContentType,
+		&img.Width, &img.Height, &img.Position, &img.IsPrimary,
+	)
+}
+
+func (s *ProductImageStore) List(productID int) ([]store.ProductImage, error) {
+	return listImages(s.db, productID)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// listImages returns a product's images in display order.
+func listImages(q querier, productID int) ([]store.ProductImage, error) {
+	rows, err := q.Query(
+		`SELECT `+imageColumns+` FROM product_images WHERE product_id = $1 ORDER BY position, id;`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make([]store.ProductImage, 0)
+	for rows.Next() {
+		var img store.ProductImage
+		if err := scanImage(rows, &img); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+func (s *ProductImageStore) Create(img *store.ProductImage, primary bool) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		// Lock the product so concurrent uploads get distinct positions
+		var hasPrimary bool
+		err := tx.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM product_images WHERE product_id = p.id AND is_primary)
+         FROM products p WHERE p.id = $1 FOR UPDATE;`,
+			img.ProductID,
+		).Scan(&hasPrimary)
+		if err != nil {
+			return notFound(err)
+		}
+
+		img.IsPrimary = primary || !hasPrimary
+		if img.IsPrimary && hasPrimary {
+			if _, err := tx.Exec(
+				`UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary;`,
+				img.ProductID,
+			); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRow(
+			`INSERT INTO product_images
+         (product_id, storage_key, thumbnail_key, content_type, width, height, position, is_primary)
+       VALUES ($1, $2, $3, $4, $5, $6,
+               (SELECT COALESCE(MAX(position), 0) + 1 FROM product_images WHERE product_id = $1), $7)
+       RETURNING id, position;`,
+			img.ProductID, img.Key, img.ThumbnailKey, img.ContentType, img.Width, img.Height, img.IsPrimary,
+		).Scan(&img.ID, &img.Position)
+	})
+}
+
+func (s *ProductImageStore) SetPrimary(productID, imageID int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		// Clear the old primary first: at most one per product is enforced by an index.
+		if _, err := tx.Exec(
+			`UPDATE product_images SET is_primary = FALSE WHERE product_id = $1 AND is_primary;`,
+			productID,
+		); err != nil {
+			return err
+		}
+		res, err := tx.Exec(
+			`UPDATE product_images SET is_primary = TRUE WHERE id = $1 AND product_id = $2;`,
+			imageID, productID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *ProductImageStore) Reorder(productID int, imageIDs []int) ([]store.ProductImage, error) {
+	var images []store.ProductImage
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := tx.QueryRow(
+			`SELECT id FROM products WHERE id = $1 FOR UPDATE;`, productID,
+		).Scan(new(int)); err != nil {
+			return notFound(err)
+		}
+
+		ids := make([]int64, len(imageIDs))
+		for i, id := range imageIDs {
+			ids[i] = int64(id)
+		}
+		// The new order must be a permutation of the product's images
+		var matches bool
+		if err := tx.QueryRow(
+			`SELECT COALESCE(array_agg(id ORDER BY id), '{}') =
+              (SELECT COALESCE(array_agg(x ORDER BY x), '{}') FROM unnest($2::int[]) AS x)
+         FROM product_images WHERE product_id = $1;`,
+			productID, pq.Array(ids),
+		).Scan(&matches); err != nil {
+			return err
+		}
+		if !matches {
+			return store.ErrImageOrder
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE product_images i SET position = want.position
+         FROM unnest($2::int[]) WITH ORDINALITY AS want(id, position)
+        WHERE i.id = want.id AND i.product_id = $1;`,
+			productID, pq.Array(ids),
+		); err != nil {
+			return err
+		}
+		var err error
+		images, err = listImages(tx, productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (s *ProductImageStore) Delete(productID, imageID int) (*store.ProductImage, error) {
+	var img store.ProductImage
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		err := scanImage(tx.QueryRow(
+			`DELETE FROM product_images WHERE id = $1 AND product_id = $2
+       RETURNING `+imageColumns+`;`,
+			imageID, productID,
+		), &img)
+		if err != nil {
+			return notFound(err)
+		}
+		if !img.IsPrimary {
+			return nil
+		}
+		_, err = tx.Exec(
+			`UPDATE product_images SET is_primary = TRUE
+        WHERE id = (SELECT id FROM product_images WHERE product_id = $1
+                     ORDER BY position, id LIMIT 1);`,
+			productID,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
@@ -0,0 +1,883 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+	"github.com/Brossef/rescounts-task/internal/tax"
+)
+
+// Reasons recorded in stock_adjustments for stock moved by orders.
+const (
+	stockReasonOrderReserved = "order_reserved"
+	stockReasonOrderReleased = "order_released"
+	stockReasonOrderRefunded = "order_refunded"
+)
+
+// timestampLayout formats times for comparison with TIMESTAMP columns.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// OrderStore implements store.OrderStore.
+type OrderStore struct {
+	db *sql.DB
+}
+
+func (s *OrderStore) CreatePending(in store.NewOrder) (*store.Order, error) {
+	order := &store.Order{
+		UserID:   in.UserID,
+		Status:   store.OrderStatusPending,
+		Currency: in.Currency,
+	}
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		rate, err := lockFXRate(tx, in.Currency)
+		if err != nil {
+			return err
+		}
+		switch {
+		case in.Currency == money.Base:
+			order.FXRate = "1"
+		case rate != nil:
+			order.FXRate = money.FormatRate(rate)
+		}
+
+		if err := lockCartItems(tx, in.UserID, in.CartItemIDs); err != nil {
+			return err
+		}
+
+		lines, total, err := reserveStock(tx, in.Items, in.Currency, rate)
+		if err != nil {
+			return err
+		}
+		order.Lines = lines
+
+		// The coupon row stays locked until commit, so concurrent checkouts
+		// cannot both take the last redemption.
+		var coupon *store.Coupon
+		if in.CouponCode != "" {
+			c, redeemed, redeemedByUser, err := lockCoupon(tx, in.CouponCode, in.UserID)
+			if err != nil {
+				return err
+			}
+			// Coupon amounts are in the base currency
+			if rate == nil && in.Currency != money.Base && c.HasBaseAmounts() {
+				return store.UnsupportedCurrencyError(in.Currency)
+			}
+			if rate != nil {
+				c.MinOrderCents = int(money.Convert(int64(c.MinOrderCents), rate))
+				if c.DiscountType == store.CouponFixed {
+					c.Value = int(money.Convert(int64(c.Value), rate))
+				}
+			}
+			if order.DiscountCents, err = c.Apply(time.Now(), order.Lines, redeemed, redeemedByUser); err != nil {
+				return err
+			}
+			coupon = c
+			order.CouponCode = c.Code
+		}
+
+		// Tax is charged on what is paid, i.e. after the discount
+		order.TaxProvince = in.Province
+		for i := range order.Lines {
+			li := &order.Lines[i]
+			li.Taxes = tax.Line(in.Province, li.TaxCategory, li.Subtotal-li.DiscountCents)
+			for _, t := range li.Taxes {
+				li.TaxCents += t.AmountCents
+			}
+			order.TaxCents += li.TaxCents
+		}
+		order.TotalCents = total - order.DiscountCents + order.TaxCents
+
+		err = tx.QueryRow(
+			`INSERT INTO orders
+         (user_id, status, total_cents, discount_cents, tax_cents, tax_province, currency, fx_rate)
+       VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, '')::numeric)
+       RETURNING id;`,
+			in.UserID, order.Status, order.TotalCents, order.DiscountCents, order.TaxCents, in.Province,
+			in.Currency, order.FXRate,
+		).Scan(&order.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, li := range order.Lines {
+			err := tx.QueryRow(
+				`INSERT INTO order_lines
+           (order_id, product_id, product_name, variant_id, variant_sku, variant_options, quantity,
+            unit_price_cents, total_price_cents, discount_cents, tax_category, tax_cents)
+         VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12)
+         RETURNING id;`,
+				order.ID, li.ProductID, li.ProductName, li.VariantID, li.VariantSKU, lineVariantOptions(li), li.Quantity,
+				li.UnitPriceCents, li.Subtotal, li.DiscountCents, li.TaxCategory, li.TaxCents,
+			).Scan(&order.Lines[i].ID)
+			if err != nil {
+				return err
+			}
+			for _, t := range li.Taxes {
+				if _, err := tx.Exec(
+					`INSERT INTO order_line_taxes (order_line_id, tax_type, rate_percent, amount_cents)
+           VALUES ($1, $2, $3, $4);`,
+					order.Lines[i].ID, t.Type, t.RatePercent, t.AmountCents,
+				); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(in.CartItemIDs) > 0 {
+			if _, err := tx.Exec(
+				`UPDATE cart_items SET order_id = $1 WHERE id = ANY($2) AND user_id = $3;`,
+				order.ID, pq.Array(in.CartItemIDs), in.UserID,
+			); err != nil {
+				return err
+			}
+		}
+
+		if coupon != nil {
+			if _, err := tx.Exec(
+				`INSERT INTO order_discounts (order_id, coupon_id, user_id, code, amount_cents)
+         VALUES ($1, $2, $3, $4, $5);`,
+				order.ID, coupon.ID, in.UserID, coupon.Code, order.DiscountCents,
+			); err != nil {
+				return err
+			}
+		}
+		return logOrderStock(tx, order.ID, -1, stockReasonOrderReserved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// lockCartItems locks the cart items an order checks out, so a concurrent
+// checkout of the same items waits for this one, and returns ErrCartCheckedOut
+// if one is already checked out in a pending order.
+func lockCartItems(tx *sql.Tx, userID int, itemIDs []int) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	var orderIDs pq.Int64Array
+	if err := tx.QueryRow(
+		`SELECT COALESCE(array_agg(order_id) FILTER (WHERE order_id IS NOT NULL), '{}')
+       FROM (SELECT order_id FROM cart_items
+              WHERE id = ANY($1) AND user_id = $2
+              FOR UPDATE) ci;`,
+		pq.Array(itemIDs), userID,
+	).Scan(&orderIDs); err != nil {
+		return err
+	}
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	// A separate statement, so it sees an order committed while we waited
+	var pending bool
+	if err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM orders WHERE id = ANY($1) AND status = $2);`,
+		orderIDs, store.OrderStatusPending,
+	).Scan(&pending); err != nil {
+		return err
+	}
+	if pending {
+		return store.ErrCartCheckedOut
+	}
+	return nil
+}
+
+// stockKey identifies what an order line takes stock from: a product, or one
+// of its variants.
+type stockKey struct {
+	ProductID int
+	VariantID int
+}
+
+// reserveStock locks the products in items and then their variants (each in ID
+// order, to avoid deadlocks between concurrent checkouts), checks availability
+// and decrements stock for everything that is not unlimited: a variant's own
+// stock, or the product's for products sold without variants. It returns the
+// order lines priced in currency (see store.Product.PriceIn and VariantPriceIn)
+// and their total, or *PriceChangedError if an item is not at its
+// ExpectedPriceCents. A nil rate outside of the base currency means the currency
+// has none: UnsupportedCurrencyError unless every line has an explicit price.
+func reserveStock(tx *sql.Tx, items []store.BuyItem, currency string, rate *big.Rat) ([]store.OrderLine, int64, error) {
+	requested := map[stockKey]int{}
+	expected := map[stockKey]int{}
+	var keys []stockKey
+	seenProduct := map[int]bool{}
+	var productIDs, variantIDs []int64
+	for _, it := range items {
+		key := stockKey{it.ProductID, it.VariantID}
+		if _, seen := requested[key]; !seen {
+			keys = append(keys, key)
+			if it.VariantID != 0 {
+				variantIDs = append(variantIDs, int64(it.VariantID))
+			}
+		}
+		if !seenProduct[it.ProductID] {
+			seenProduct[it.ProductID] = true
+			productIDs = append(productIDs, int64(it.ProductID))
+		}
+		requested[key] += it.Quantity
+		if it.ExpectedPriceCents != nil {
+			expected[key] = *it.ExpectedPriceCents
+		}
+	}
+
+	rows, err := tx.Query(
+		`SELECT p.id, p.name, p.price_cents, `+salePriceExpr+`,
+            p.stock_quantity, p.unlimited_stock, p.tax_category,
+            (SELECT pp.price_cents FROM product_prices pp
+              WHERE pp.product_id = p.id AND pp.currency = $2),
+            EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id),
+            p.archived_at IS NOT NULL
+       FROM products p
+      WHERE p.id = ANY($1)
+      ORDER BY p.id
+      FOR UPDATE;`,
+		pq.Array(productIDs), currency,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	type productStock struct {
+		Product     store.Product
+		Stock       int
+		Unlimited   bool
+		TaxCategory string
+		HasVariants bool
+		Archived    bool
+	}
+	products := map[int]*productStock{}
+	for rows.Next() {
+		var (
+			p        productStock
+			explicit sql.NullInt64
+		)
+		if err := rows.Scan(
+			&p.Product.ID, &p.Product.Name, &p.Product.PriceCents, &p.Product.SalePriceCents, &p.Stock, &p.Unlimited, &p.TaxCategory, &explicit, &p.HasVariants, &p.Archived,
+		); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if explicit.Valid {
+			p.Product.Prices = map[string]int{currency: int(explicit.Int64)}
+		}
+		products[p.Product.ID] = &p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	variants := map[int]*store.ProductVariant{}
+	if len(variantIDs) > 0 {
+		rows, err := tx.Query(`
+      SELECT v.id, v.product_id, v.sku, v.options, `+currentPriceExpr+`, v.price_cents,
+             v.stock_quantity, v.unlimited_stock
+        FROM product_variants v
+        JOIN products p ON p.id = v.product_id
+       WHERE v.id = ANY($1)
+       ORDER BY v.id
+       FOR UPDATE OF v;`,
+			pq.Array(variantIDs),
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		for rows.Next() {
+			v, err := scanVariant(rows)
+			if err != nil {
+				rows.Close()
+				return nil, 0, err
+			}
+			variants[v.ID] = v
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var (
+		shortfalls []store.StockShortfall
+		mismatches []store.PriceMismatch
+	)
+	for _, key := range keys {
+		p, ok := products[key.ProductID]
+		if !ok {
+			return nil, 0, store.ProductNotFoundError(key.ProductID)
+		}
+		if p.Archived {
+			return nil, 0, store.ProductArchivedError(key.ProductID)
+		}
+		stock, unlimited := p.Stock, p.Unlimited
+		var v *store.ProductVariant
+		if key.VariantID != 0 {
+			var ok bool
+			v, ok = variants[key.VariantID]
+			if !ok || v.ProductID != key.ProductID {
+				return nil, 0, &store.VariantNotFoundError{ProductID: key.ProductID, VariantID: key.VariantID}
+			}
+			stock, unlimited = v.StockQuantity, v.UnlimitedStock
+		} else if p.HasVariants {
+			return nil, 0, store.VariantRequiredError(key.ProductID)
+		}
+		if rate == nil && p.Product.NeedsRate(currency) {
+			return nil, 0, store.UnsupportedCurrencyError(currency)
+		}
+		if want, ok := expected[key]; ok {
+			if price := basePrice(&p.Product, v); price != want {
+				mismatches = append(mismatches, store.PriceMismatch{
+					ProductID:     key.ProductID,
+					VariantID:     key.VariantID,
+					ExpectedCents: want,
+					CurrentCents:  price,
+				})
+			}
+		}
+		if !unlimited && stock < requested[key] {
+			shortfalls = append(shortfalls, store.StockShortfall{
+				ProductID: key.ProductID,
+				VariantID: key.VariantID,
+				Requested: requested[key],
+				Available: stock,
+			})
+		}
+	}
+	if len(mismatches) > 0 {
+		return nil, 0, &store.PriceChangedError{Items: mismatches}
+	}
+	if len(shortfalls) > 0 {
+		return nil, 0, &store.InsufficientStockError{Items: shortfalls}
+	}
+
+	for _, key := range keys {
+		var err error
+		if key.VariantID != 0 {
+			if variants[key.VariantID].UnlimitedStock {
+				continue
+			}
+			_, err = tx.Exec(
+				`UPDATE product_variants SET stock_quantity = stock_quantity - $1 WHERE id = $2;`,
+				requested[key], key.VariantID,
+			)
+		} else {
+			if products[key.ProductID].Unlimited {
+				continue
+			}
+			_, err = tx.Exec(
+				`UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2;`,
+				requested[key], key.ProductID,
+			)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var total int64
+	lines := make([]store.OrderLine, 0, len(items))
+	for _, it := range items {
+		p := products[it.ProductID]
+		line := store.OrderLine{
+			ProductID:   it.ProductID,
+			ProductName: p.Product.Name,
+			Quantity:    it.Quantity,
+			TaxCategory: p.TaxCategory,
+		}
+		if v := variants[it.VariantID]; it.VariantID != 0 {
+			line.VariantID, line.VariantSKU, line.VariantOptions = v.ID, v.SKU, v.Options
+			line.UnitPriceCents = int64(p.Product.VariantPriceIn(v, currency, rate))
+		} else {
+			line.UnitPriceCents = int64(p.Product.PriceIn(currency, rate))
+		}
+		line.Subtotal = line.UnitPriceCents * int64(it.Quantity)
+		total += line.Subtotal
+		lines = append(lines, line)
+	}
+	return lines, total, nil
+}
+
+// basePrice is the base-currency price of a product, or of its variant v when
+// non-nil, as carts show it.
+func basePrice(p *store.Product, v *store.ProductVariant) int {
+	if v != nil {
+		return p.VariantPriceIn(v, money.Base, nil)
+	}
+	return p.PriceIn(money.Base, nil)
+}
+
+// lineVariantOptions encodes the option values of a line's variant, or NULL
+// for a line without one.
+func lineVariantOptions(li store.OrderLine) interface{} {
+	if li.VariantID == 0 {
+		return nil
+	}
+	return variantOptionsJSON(li.VariantOptions)
+}
+
+// lineVariant is the variant of an order line as scanned from ol.variant_id,
+// ol.variant_sku and ol.variant_options.
+type lineVariant struct {
+	id      sql.NullInt64
+	sku     sql.NullString
+	options []byte
+}
+
+// set copies the variant read into a history or sales row's fields.
+func (lv *lineVariant) set(id **int, sku *string, options *map[string]string) error {
+	if lv.id.Valid {
+		v := int(lv.id.Int64)
+		*id = &v
+	}
+	*sku = lv.sku.String
+	if lv.options == nil {
+		return nil
+	}
+	return json.Unmarshal(lv.options, options)
+}
+
+// orderStockLines is the stock each limited-stock line of order $1 took, per
+// product and variant. Lines of variants deleted since are left out: their
+// stock is gone with them.
+const orderStockLines = `
+    SELECT ol.product_id, ol.variant_id, SUM(ol.quantity) AS quantity
+      FROM order_lines ol
+      JOIN products p ON p.id = ol.product_id
+      LEFT JOIN product_variants v ON v.id = ol.variant_id
+     WHERE ol.order_id = $1
+       AND (ol.variant_id IS NOT NULL OR ol.variant_sku IS NULL)
+       AND NOT COALESCE(v.unlimited_stock, p.unlimited_stock)
+     GROUP BY ol.product_id, ol.variant_id`
+
+// logOrderStock records the stock movement of every limited-stock line of an order.
+// sign is -1 for a reservation and +1 for a release.
+func logOrderStock(tx *sql.Tx, orderID, sign int, reason string) error {
+	_, err := tx.Exec(
+		`INSERT INTO stock_adjustments (product_id, variant_id, delta, reason, order_id)
+     SELECT product_id, variant_id, $2 * quantity, $3, $1
+       FROM (`+orderStockLines+`) ol;`,
+		orderID, sign, reason,
+	)
+	return err
+}
+
+// releaseOrderStock puts the stock reserved by an order back on the shelf.
+func releaseOrderStock(tx *sql.Tx, orderID int) error {
+	if _, err := tx.Exec(
+		`UPDATE products p
+        SET stock_quantity = p.stock_quantity + ol.quantity
+       FROM (`+orderStockLines+`) ol
+      WHERE p.id = ol.product_id AND ol.variant_id IS NULL;`,
+		orderID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE product_variants v
+        SET stock_quantity = v.stock_quantity + ol.quantity
+       FROM (`+orderStockLines+`) ol
+      WHERE v.id = ol.variant_id;`,
+		orderID,
+	); err != nil {
+		return err
+	}
+	return logOrderStock(tx, orderID, 1, stockReasonOrderReleased)
+}
+
+// reclaimOrderStock takes the stock of a failed order again, as checkout did.
+// It reports false, taking nothing, when a line is no longer in stock.
+func reclaimOrderStock(tx *sql.Tx, orderID int) (bool, error) {
+	var lines int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM (`+orderStockLines+`) ol;`, orderID).Scan(&lines); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`SAVEPOINT reclaim_stock;`); err != nil {
+		return false, err
+	}
+
+	var taken int64
+	for _, query := range []string{
+		`UPDATE products p
+        SET stock_quantity = p.stock_quantity - ol.quantity
+       FROM (` + orderStockLines + `) ol
+      WHERE p.id = ol.product_id AND ol.variant_id IS NULL
+        AND p.stock_quantity >= ol.quantity;`,
+		`UPDATE product_variants v
+        SET stock_quantity = v.stock_quantity - ol.quantity
+       FROM (` + orderStockLines + `) ol
+      WHERE v.id = ol.variant_id
+        AND v.stock_quantity >= ol.quantity;`,
+	} {
+		res, err := tx.Exec(query, orderID)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		taken += n
+	}
+
+	if taken < lines {
+		_, err := tx.Exec(`ROLLBACK TO SAVEPOINT reclaim_stock;`)
+		return false, err
+	}
+	if _, err := tx.Exec(`RELEASE SAVEPOINT reclaim_stock;`); err != nil {
+		return false, err
+	}
+	return true, logOrderStock(tx, orderID, -1, stockReasonOrderReserved)
+}
+
+func (s *OrderStore) SetPaymentIntent(orderID int, paymentIntentID, status string) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		// Orders that already left pending (e.g. through a webhook) keep their status.
+		res, err := tx.Exec(
+			`UPDATE orders
+          SET stripe_payment_intent_id = $1, status = $2, updated_at = NOW()
+        WHERE id = $3 AND status = $4;`,
+			paymentIntentID, status, orderID, store.OrderStatusPending,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 || status != store.OrderStatusPaid {
+			return err
+		}
+		return removeCheckedOutItems(tx, orderID)
+	})
+}
+
+// removeCheckedOutItems deletes the cart items a paid order checked out.
+func removeCheckedOutItems(tx *sql.Tx, orderID int) error {
+	_, err := tx.Exec(`DELETE FROM cart_items WHERE order_id = $1;`, orderID)
+	return err
+}
+
+func (s *OrderStore) Fail(orderID int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		return failOrder(tx, orderID)
+	})
+}
+
+// failOrder marks a pending order as failed and releases its stock reservation.
+// Orders that are no longer pending are left untouched.
+func failOrder(tx *sql.Tx, orderID int) error {
+	res, err := tx.Exec(
+		`UPDATE orders SET status = $1, updated_at = NOW()
+      WHERE id = $2 AND status = $3;`,
+		store.OrderStatusFailed, orderID, store.OrderStatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	return releaseOrderStock(tx, orderID)
+}
+
+func (s *OrderStore) FailAbandoned(olderThan time.Duration, cancel func(paymentIntentID string) bool) ([]int, error) {
+	var ids []int
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`SELECT id, COALESCE(stripe_payment_intent_id, '') FROM orders
+        WHERE status = $1
+          AND created_at < NOW() - make_interval(secs => $2)
+        ORDER BY id
+          FOR UPDATE SKIP LOCKED;`,
+			store.OrderStatusPending, olderThan.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		type abandoned struct {
+			id   int
+			piID string
+		}
+		var candidates []abandoned
+		for rows.Next() {
+			var a abandoned
+			if err := rows.Scan(&a.id, &a.piID); err != nil {
+				return err
+			}
+			candidates = append(candidates, a)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, a := range candidates {
+			// The row lock keeps a webhook from paying the order while its
+			// intent is being canceled.
+			if a.piID != "" && !cancel(a.piID) {
+				continue
+			}
+			if err := failOrder(tx, a.id); err != nil {
+				return err
+			}
+			ids = append(ids, a.id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (s *OrderStore) GetForUser(orderID, userID int) (*store.Order, error) {
+	var (
+		o    store.Order
+		piID sql.NullString
+	)
+	err := s.db.QueryRow(
+		`SELECT o.id, o.user_id, o.stripe_payment_intent_id, o.status, o.total_cents, o.discount_cents,
+            o.tax_cents, COALESCE(o.tax_province, ''), o.refunded_cents, o.currency, COALESCE(o.fx_rate::text, ''),
+            COALESCE(od.code, '')
+       FROM orders o
+       LEFT JOIN order_discounts od ON od.order_id = o.id
+      WHERE o.id = $1 AND o.user_id = $2;`,
+		orderID, userID,
+	).Scan(
+		&o.ID, &o.UserID, &piID, &o.Status, &o.TotalCents, &o.DiscountCents,
+		&o.TaxCents, &o.TaxProvince, &o.RefundedCents, &o.Currency, &o.FXRate, &o.CouponCode,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if rate, ok := money.ParseRate(o.FXRate); ok {
+		o.FXRate = money.FormatRate(rate)
+	}
+	o.StripePaymentIntentID = piID.String
+	return &o, nil
+}
+
+func (s *OrderStore) ListHistory(userID int) ([]store.HistoryItem, error) {
+	rows, err := s.db.Query(`
+    SELECT
+      o.id,
+      ol.id,
+      o.status,
+      COALESCE(ol.product_id, 0),
+      COALESCE(ol.product_name, ''),
+      ol.variant_id,
+      ol.variant_sku,
+      ol.variant_options,
+      ol.quantity,
+      ol.unit_price_cents,
+      ol.total_price_cents,
+      ol.discount_cents,
+      ol.tax_cents,
+      COALESCE(od.code, ''),
+      ol.refunded_quantity,
+      o.refunded_cents,
+      o.currency,
+      o.created_at
+    FROM orders o
+    JOIN order_lines ol ON ol.order_id = o.id
+    LEFT JOIN order_discounts od ON od.order_id = o.id
+    WHERE o.user_id = $1
+    ORDER BY o.created_at DESC, ol.id;
+  `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]store.HistoryItem, 0)
+	for rows.Next() {
+		var (
+			item    store.HistoryItem
+			variant lineVariant
+		)
+		if err := rows.Scan(
+			&item.OrderID,
+			&item.OrderLineID,
+			&item.OrderStatus,
+			&item.ProductID,
+			&item.ProductName,
+			&variant.id,
+			&variant.sku,
+			&variant.options,
+			&item.Quantity,
+			&item.UnitPriceCents,
+			&item.TotalPriceCents,
+			&item.DiscountCents,
+			&item.TaxCents,
+			&item.CouponCode,
+			&item.RefundedQty,
+			&item.OrderRefunded,
+			&item.Currency,
+			&item.PurchasedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := variant.set(&item.VariantID, &item.VariantSKU, &item.VariantOptions); err != nil {
+			return nil, err
+		}
+		history = append(history, item)
+	}
+	return history, rows.Err()
+}
+
+// salesWhere builds the WHERE clause of a SalesFilter over orders o, users u
+// and order_discounts od, numbering its placeholders after args.
+func salesWhere(filter store.SalesFilter, args []interface{}) (string, []interface{}) {
+	// Build dynamic WHERE clauses
+	clauses := []string{"1=1"} // start with a no-op clause
+
+	// Bound as literals: created_at is a TIMESTAMP without time zone
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.Format(timestampLayout))
+		clauses = append(clauses, "o.created_at >= $"+strconv.Itoa(len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.Format(timestampLayout))
+		clauses = append(clauses, "o.created_at < $"+strconv.Itoa(len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		clauses = append(clauses, "u.username = $"+strconv.Itoa(len(args)))
+	}
+	if filter.CouponCode != "" {
+		args = append(args, filter.CouponCode)
+		clauses = append(clauses, "LOWER(od.code) = LOWER($"+strconv.Itoa(len(args))+")")
+	}
+	if filter.Currency != "" {
+		args = append(args, filter.Currency)
+		clauses = append(clauses, "o.currency = $"+strconv.Itoa(len(args)))
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func (s *OrderStore) ListSales(filter store.SalesFilter) ([]store.SaleRecord, error) {
+	where, args := salesWhere(filter, nil)
+
+	query := `
+		SELECT 
+			o.id,
+			ol.id,
+			o.status,
+			COALESCE(ol.product_id, 0),
+			COALESCE(ol.product_name, ''),
+			ol.variant_id,
+			ol.variant_sku,
+			ol.variant_options,
+			u.id,
+			u.username,
+			ol.quantity,
+			ol.unit_price_cents,
+			ol.total_price_cents,
+			ol.discount_cents,
+			ol.tax_cents,
+			COALESCE(od.code, ''),
+			ol.refunded_quantity,
+			o.refunded_cents,
+			o.currency,
+			ROUND(ol.total_price_cents / ` + orderRate + `)::bigint,
+			o.created_at
+		FROM orders o
+		JOIN order_lines ol ON ol.order_id = o.id
+		JOIN users u ON o.user_id = u.id
+		LEFT JOIN order_discounts od ON od.order_id = o.id
+		WHERE ` + where + `
+		ORDER BY o.created_at DESC, ol.id;
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := make([]store.SaleRecord, 0)
+	for rows.Next() {
+		var (
+			r       store.SaleRecord
+			variant lineVariant
+		)
+		if err := rows.Scan(
+			&r.OrderID,
+			&r.OrderLineID,
+			&r.OrderStatus,
+			&r.ProductID,
+			&r.ProductName,
+			&variant.id,
+			&variant.sku,
+			&variant.options,
+			&r.UserID,
+			&r.Username,
+			&r.Quantity,
+			&r.UnitPriceCents,
+			&r.TotalPriceCents,
+			&r.DiscountCents,
+			&r.TaxCents,
+			&r.CouponCode,
+			&r.RefundedQty,
+			&r.OrderRefunded,
+			&r.Currency,
+			&r.BaseTotalPriceCents,
+			&r.PurchasedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := variant.set(&r.VariantID, &r.VariantSKU, &r.VariantOptions); err != nil {
+			return nil, err
+		}
+		sales = append(sales, r)
+	}
+	return sales, rows.Err()
+}
+
+func (s *OrderStore) SalesTotals(filter store.SalesFilter) ([]store.CurrencySalesTotal, error) {
+	where, args := salesWhere(filter, []interface{}{pq.Array(paidOrderStatuses)})
+
+	rows, err := s.db.Query(`
+		SELECT
+			o.currency,
+			COUNT(*),
+			COALESCE(SUM(o.total_cents - o.tax_cents + o.discount_cents), 0),
+			COALESCE(SUM(o.discount_cents), 0),
+			COALESCE(SUM(o.tax_cents), 0),
+			COALESCE(SUM(o.refunded_cents), 0),
+			COALESCE(SUM(o.total_cents - o.refunded_cents), 0),
+			COALESCE(SUM(ROUND((o.total_cents - o.refunded_cents) / `+orderRate+`)), 0)::bigint
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		LEFT JOIN order_discounts od ON od.order_id = o.id
+		WHERE o.status = ANY($1) AND `+where+`
+		GROUP BY o.currency
+		ORDER BY o.currency;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make([]store.CurrencySalesTotal, 0)
+	for rows.Next() {
+		var t store.CurrencySalesTotal
+		if err := rows.Scan(
+			&t.Currency,
+			&t.Orders,
+			&t.GrossCents,
+			&t.DiscountCents,
+			&t.TaxCents,
+			&t.RefundedCents,
+			&t.NetCents,
+			&t.BaseNetCents,
+		); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
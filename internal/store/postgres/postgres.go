@@ -0,0 +1,60 @@
+// Package postgres implements the store interfaces on top of PostgreSQL.
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// New returns every store backed by db.
+func New(db *sql.DB) store.Stores {
+	return store.Stores{
+		Users:           &UserStore{db: db},
+		Admins:          &AdminStore{db: db},
+		Products:        &ProductStore{db: db},
+		Images:          &ProductImageStore{db: db},
+		Variants:        &ProductVariantStore{db: db},
+		PriceSchedules:  &PriceScheduleStore{db: db},
+		Cards:           &CardStore{db: db},
+		Carts:           &CartStore{db: db},
+		Categories:      &CategoryStore{db: db},
+		Tags:            &TagStore{db: db},
+		Coupons:         &CouponStore{db: db},
+		FXRates:         &FXRateStore{db: db},
+		Orders:          &OrderStore{db: db},
+		Tokens:          &TokenStore{db: db},
+		IdempotencyKeys: &IdempotencyStore{db: db},
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// withTx runs fn in a transaction, committing only if it returns nil.
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
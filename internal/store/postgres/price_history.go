@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// recordPriceChange adds an entry to a product's price history with its
+// current name and prices, unless they are those of its latest entry.
+func recordPriceChange(tx *sql.Tx, productID, adminID int) error {
+	_, err := tx.Exec(`
+    INSERT INTO product_price_history (product_id, name, price_cents, prices, admin_user_id)
+    SELECT p.id, p.name, p.price_cents, cur.prices, NULLIF($2, 0)
+      FROM products p
+     CROSS JOIN (SELECT jsonb_object_agg(currency, price_cents) AS prices
+                   FROM product_prices WHERE product_id = $1) cur
+     WHERE p.id = $1
+       AND NOT EXISTS (
+             SELECT 1
+               FROM (SELECT name, price_cents, prices FROM product_price_history
+                      WHERE product_id = $1 AND variant_sku IS NULL
+                      ORDER BY id DESC LIMIT 1) last
+              WHERE last.name = p.name AND last.price_cents = p.price_cents
+                AND last.prices IS NOT DISTINCT FROM cur.prices);`,
+		productID, adminID,
+	)
+	return err
+}
+
+// recordVariantPriceChange adds an entry to a product's price history with its
+// variant's current price override, unless it is that of the variant's latest
+// entry. A variant without entries counts as having no override.
+func recordVariantPriceChange(tx *sql.Tx, variantID, adminID int) error {
+	_, err := tx.Exec(`
+    INSERT INTO product_price_history
+      (product_id, variant_id, variant_sku, name, price_cents, price_override_cents, admin_user_id)
+    SELECT p.id, v.id, v.sku, p.name, p.price_cents, v.price_cents, NULLIF($2, 0)
+      FROM product_variants v
+      JOIN products p ON p.id = v.product_id
+     WHERE v.id = $1
+       AND v.price_cents IS DISTINCT FROM (
+             SELECT price_override_cents FROM product_price_history
+              WHERE variant_id = $1 ORDER BY id DESC LIMIT 1);`,
+		variantID, adminID,
+	)
+	return err
+}
+
+func (s *ProductStore) PriceHistory(productID int) ([]store.PriceChange, error) {
+	if err := s.db.QueryRow(
+		`SELECT id FROM products WHERE id = $1;`, productID,
+	).Scan(new(int)); err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.Query(`
+    SELECT id, product_id, variant_id, COALESCE(variant_sku, ''), name, price_cents, prices,
+           price_override_cents, admin_user_id, changed_at
+      FROM product_price_history
+     WHERE product_id = $1
+     ORDER BY id DESC;`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]store.PriceChange, 0)
+	for rows.Next() {
+		var (
+			c         store.PriceChange
+			variantID sql.NullInt64
+			prices    []byte
+			override  sql.NullInt64
+			adminID   sql.NullInt64
+		)
+		if err := rows.Scan(
+			&c.ID, &c.ProductID, &variantID, &c.VariantSKU, &c.Name, &c.PriceCents, &prices,
+			&override, &adminID, &c.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			c.VariantID = &id
+		}
+		if override.Valid {
+			price := int(override.Int64)
+			c.PriceOverrideCents = &price
+		}
+		if prices != nil {
+			if err := json.Unmarshal(prices, &c.Prices); err != nil {
+				return nil, err
+			}
+		}
+		if adminID.Valid {
+			id := int(adminID.Int64)
+			c.AdminUserID = &id
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// runningSchedule matches the price schedule s of product p running now.
+// Schedule times are UTC.
+const runningSchedule = `s.product_id = p.id AND s.cancelled_at IS NULL
+             AND s.starts_at <= (NOW() AT TIME ZONE 'UTC')
+             AND (s.ends_at IS NULL OR s.ends_at > (NOW() AT TIME ZONE 'UTC'))`
+
+// salePriceExpr is the base-currency sale price of product p's running
+// schedule, or NULL. Schedules do not overlap, so there is at most one.
+const salePriceExpr = `(SELECT s.sale_price_cents FROM price_schedules s WHERE ` + runningSchedule + `)`
+
+// currentPriceExpr is the base-currency price product p sells at now, or its
+// variant v when v is joined: the variant's override, else the product's
+// price, scaled by the running sale price's ratio to the product's price (see
+// store.Product.VariantPriceIn).
+const currentPriceExpr = `ROUND(COALESCE(v.price_cents, p.price_cents)::numeric
+                 * COALESCE(` + salePriceExpr + `, p.price_cents) / p.price_cents)::int`
+
+// PriceScheduleStore implements store.PriceScheduleStore.
+type PriceScheduleStore struct {
+	db *sql.DB
+}
+
+const scheduleColumns = `id, product_id, sale_price_cents, starts_at, ends_at, admin_user_id, created_at, cancelled_at`
+
+func scanSchedule(row rowScanner) (*store.PriceSchedule, error) {
+	var (
+		ps      store.PriceSchedule
+		adminID sql.NullInt64
+	)
+	if err := row.Scan(
+		&ps.ID, &ps.ProductID, &ps.SalePriceCents, &ps.StartsAt, &ps.EndsAt, &adminID,
+		&ps.CreatedAt, &ps.CancelledAt,
+	); err != nil {
+		return nil, err
+	}
+	if adminID.Valid {
+		id := int(adminID.Int64)
+		ps.AdminUserID = &id
+	}
+	ps.Status = ps.StatusAt(time.Now())
+	return &ps, nil
+}
+
+func (s *PriceScheduleStore) List(productID int) ([]store.PriceSchedule, error) {
+	if err := s.db.QueryRow(
+		`SELECT id FROM products WHERE id = $1;`, productID,
+	).Scan(new(int)); err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.Query(
+		`SELECT `+scheduleColumns+` FROM price_schedules WHERE product_id = $1 ORDER BY starts_at, id;`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]store.PriceSchedule, 0)
+	for rows.Next() {
+		ps, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *ps)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *PriceScheduleStore) Create(productID int, in store.PriceScheduleInput) (*store.PriceSchedule, error) {
+	var ps *store.PriceSchedule
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		// Lock the product so concurrent schedules cannot both pass the overlap check
+		if err := tx.QueryRow(
+			`SELECT id FROM products WHERE id = $1 FOR UPDATE;`, productID,
+		).Scan(new(int)); err != nil {
+			return notFound(err)
+		}
+
+		// A NULL end is open-ended; cancelled schedules no longer count
+		var overlaps bool
+		if err := tx.QueryRow(
+			`SELECT EXISTS (
+         SELECT 1 FROM price_schedules
+          WHERE product_id = $1 AND cancelled_at IS NULL
+            AND (ends_at IS NULL OR ends_at > $2)
+            AND ($3::timestamp IS NULL OR starts_at < $3));`,
+			productID, in.StartsAt.UTC().Format(timestampLayout), nullTimestamp(in.EndsAt),
+		).Scan(&overlaps); err != nil {
+			return err
+		}
+		if overlaps {
+			return store.ErrScheduleOverlap
+		}
+
+		var err error
+		ps, err = scanSchedule(tx.QueryRow(
+			`INSERT INTO price_schedules (product_id, sale_price_cents, starts_at, ends_at, admin_user_id)
+       VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+       RETURNING `+scheduleColumns+`;`,
+			productID, in.SalePriceCents, in.StartsAt.UTC().Format(timestampLayout),
+			nullTimestamp(in.EndsAt), in.AdminID,
+		))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (s *PriceScheduleStore) Cancel(productID, scheduleID int) (*store.PriceSchedule, error) {
+	var ps *store.PriceSchedule
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		ps, err = scanSchedule(tx.QueryRow(
+			`SELECT `+scheduleColumns+` FROM price_schedules
+        WHERE id = $1 AND product_id = $2 FOR UPDATE;`,
+			scheduleID, productID,
+		))
+		if err != nil {
+			return notFound(err)
+		}
+		if ps.Status == store.PriceScheduleEnded || ps.Status == store.PriceScheduleCancelled {
+			return store.ErrScheduleEnded
+		}
+
+		ps, err = scanSchedule(tx.QueryRow(
+			`UPDATE price_schedules SET cancelled_at = (NOW() AT TIME ZONE 'UTC')
+        WHERE id = $1
+       RETURNING `+scheduleColumns+`;`,
+			scheduleID,
+		))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
@@ -0,0 +1,439 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/money"
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// ProductStore implements store.ProductStore.
+type ProductStore struct {
+	db *sql.DB
+}
+
+// productColumns are the columns scanProduct reads, from products p.
+const productColumns = `p.id, p.name, p.description, p.price_cents, p.stock_quantity, p.unlimited_stock,
+           p.tax_category, p.created_at, p.archived_at,
+           ` + salePriceExpr + `,
+           (SELECT s.ends_at FROM price_schedules s WHERE ` + runningSchedule + `),
+           (SELECT json_object_agg(x.currency, x.price_cents)
+              FROM product_prices x WHERE x.product_id = p.id),
+           COALESCE((SELECT json_agg(json_build_object('id', c.id, 'slug', c.slug, 'name', c.name) ORDER BY c.name)
+                       FROM product_categories pc
+                       JOIN categories c ON c.id = pc.category_id
+                      WHERE pc.product_id = p.id), '[]'),
+           COALESCE((SELECT json_agg(t.name ORDER BY t.name)
+                       FROM product_tags pt
+                       JOIN tags t ON t.id = pt.tag_id
+                      WHERE pt.product_id = p.id), '[]'),
+           COALESCE((SELECT json_agg(json_build_object(
+                              'id', i.id, 'key', i.storage_key, 'thumbnail_key', i.thumbnail_key,
+                              'content_type', i.content_type, 'width', i.width, 'height', i.height,
+                              'position', i.position, 'is_primary', i.is_primary)
+                              ORDER BY i.position, i.id)
+                       FROM product_images i WHERE i.product_id = p.id), '[]'),
+           COALESCE((SELECT json_agg(json_build_object('name', o.name, 'values', o.option_values)
+                              ORDER BY o.position)
+                       FROM product_options o WHERE o.product_id = p.id), '[]'),
+           COALESCE((SELECT json_agg(json_build_object(
+                              'id', v.id, 'product_id', v.product_id, 'sku', v.sku, 'options', v.options,
+                              'price_cents', ` + currentPriceExpr + `,
+                              'price_override_cents', v.price_cents,
+                              'stock_quantity', v.stock_quantity, 'unlimited_stock', v.unlimited_stock)
+                              ORDER BY v.id)
+                       FROM product_variants v WHERE v.product_id = p.id), '[]')`
+
+// scanProduct reads productColumns, followed by the extra columns of a query.
+func scanProduct(row rowScanner, p *store.Product, extra ...interface{}) error {
+	var desc sql.NullString
+	var prices, categories, tags, images, options, variants []byte
+	dest := []interface{}{
+		&p.ID, &p.Name, &desc, &p.PriceCents, &p.StockQuantity, &p.UnlimitedStock,
+		&p.TaxCategory, &p.CreatedAt, &p.ArchivedAt, &p.SalePriceCents, &p.SaleEndsAt, &prices, &categories, &tags, &images, &options, &variants,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	p.Description = desc.String
+	p.Currency = money.Base
+	p.OriginalPriceCents = p.PriceCents
+	if prices != nil {
+		if err := json.Unmarshal(prices, &p.Prices); err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(categories, &p.Categories); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tags, &p.Tags); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(options, &p.Options); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(variants, &p.Variants); err != nil {
+		return err
+	}
+
+	// Storage keys are not part of ProductImage's JSON, so read them separately
+	var rows []struct {
+		store.ProductImage
+		Key          string `json:"key"`
+		ThumbnailKey string `json:"thumbnail_key"`
+	}
+	if err := json.Unmarshal(images, &rows); err != nil {
+		return err
+	}
+	p.Images = make([]store.ProductImage, len(rows))
+	for i, row := range rows {
+		p.Images[i] = row.ProductImage
+		p.Images[i].ProductID = p.ID
+		p.Images[i].Key, p.Images[i].ThumbnailKey = row.Key, row.ThumbnailKey
+	}
+	return nil
+}
+
+// productSortKeys maps store.ProductSort* to the SQL they sort on and the type
+// cursor values are cast to. The price is the one in the queried currency.
+var productSortKeys = map[string]struct{ expr, cast string }{
+	store.ProductSortID:        {"p.id", "int"},
+	store.ProductSortPrice:     {productPriceExpr, "int"},
+	store.ProductSortName:      {"p.name", "text"},
+	store.ProductSortCreatedAt: {"p.created_at", "timestamp"},
+}
+
+// productPriceExpr is a product's price in the queried currency: its explicit
+// price pp, else its base price converted at fx.rate, scaled by its running
+// sale price's ratio to its base price (see store.Product.PriceIn).
+const productPriceExpr = `ROUND(COALESCE(pp.price_cents, p.price_cents * fx.rate)
+                                * COALESCE(` + salePriceExpr + `, p.price_cents) / p.price_cents)::int`
+
+func (s *ProductStore) List(q store.ProductQuery) (*store.ProductPage, error) {
+	key, ok := productSortKeys[q.Sort]
+	if !ok {
+		key = productSortKeys[store.ProductSortID]
+	}
+	rate := "1"
+	if q.Rate != nil {
+		rate = money.FormatRate(q.Rate)
+	}
+
+	// Build dynamic WHERE clauses
+	clauses := []string{"p.archived_at IS NULL"}
+	if q.Archived {
+		clauses[0] = "p.archived_at IS NOT NULL"
+	}
+	args := []interface{}{q.Currency, rate}
+	if q.MinPriceCents != nil {
+		args = append(args, *q.MinPriceCents)
+		clauses = append(clauses, productPriceExpr+" >= $"+strconv.Itoa(len(args)))
+	}
+	if q.MaxPriceCents != nil {
+		args = append(args, *q.MaxPriceCents)
+		clauses = append(clauses, productPriceExpr+" <= $"+strconv.Itoa(len(args)))
+	}
+	if q.CategorySlug != "" {
+		args = append(args, q.CategorySlug)
+		clauses = append(clauses, `EXISTS (
+      SELECT 1 FROM product_categories pc
+       WHERE pc.product_id = p.id
+         AND pc.category_id IN (`+categorySubtree("slug = $"+strconv.Itoa(len(args)))+`))`)
+	}
+	if q.Tag != "" {
+		args = append(args, q.Tag)
+		clauses = append(clauses, `EXISTS (
+      SELECT 1 FROM product_tags pt JOIN tags t ON t.id = pt.tag_id
+       WHERE pt.product_id = p.id AND t.name = $`+strconv.Itoa(len(args))+`)`)
+	}
+	const from = `
+    FROM products p
+    LEFT JOIN product_prices pp ON pp.product_id = p.id AND pp.currency = $1
+    CROSS JOIN (SELECT $2::numeric AS rate) fx`
+
+	page := &store.ProductPage{}
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*)`+from+`
+    WHERE `+strings.Join(clauses, " AND ")+`;`,
+		args...,
+	).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// Keyset pagination: continue after the cursor's (key, id) in sort order
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		args = append(args, q.After.Value, q.After.ID)
+		clauses = append(clauses, "("+key.expr+", p.id) "+cmp+
+			" ($"+strconv.Itoa(len(args)-1)+"::"+key.cast+", $"+strconv.Itoa(len(args))+")")
+	}
+	// One extra row tells whether there is a next page
+	args = append(args, q.Limit+1)
+
+	rows, err := s.db.Query(`
+    SELECT `+productColumns+`,
+           (`+key.expr+`)::text`+from+`
+    WHERE `+strings.Join(clauses, " AND ")+`
+    ORDER BY `+key.expr+` `+dir+`, p.id `+dir+`
+    LIMIT $`+strconv.Itoa(len(args))+`;`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page.Products = make([]store.Product, 0, q.Limit)
+	var lastValue string
+	for rows.Next() {
+		var p store.Product
+		var sortValue string
+		if err := scanProduct(rows, &p, &sortValue); err != nil {
+			return nil, err
+		}
+		if len(page.Products) == q.Limit {
+			last := page.Products[len(page.Products)-1]
+			page.Next = &store.ProductCursor{Value: lastValue, ID: last.ID}
+			break
+		}
+		page.Products = append(page.Products, p)
+		lastValue = sortValue
+	}
+	return page, rows.Err()
+}
+
+func (s *ProductStore) Get(id int) (*store.Product, error) {
+	var p store.Product
+	err := scanProduct(s.db.QueryRow(`
+    SELECT `+productColumns+`
+      FROM products p
+     WHERE p.id = $1;`, id), &p)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &p, nil
+}
+
+func (s *ProductStore) Create(in store.ProductInput) (*store.Product, error) {
+	var id int
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`INSERT INTO products (name, description, price_cents, stock_quantity, unlimited_stock, tax_category)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id;`,
+			in.Name, in.Description, in.PriceCents, in.StockQuantity, in.UnlimitedStock, in.TaxCategory,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := insertProductPrices(tx, id, in.Prices); err != nil {
+			return err
+		}
+		if err := setProductCategories(tx, id, in.CategoryIDs); err != nil {
+			return err
+		}
+		if err := setProductTags(tx, id, in.Tags); err != nil {
+			return err
+		}
+		return recordPriceChange(tx, id, in.AdminID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(id)
+}
+
+func (s *ProductStore) Update(id int, in store.ProductInput) (*store.Product, error) {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		// An empty tax category keeps the current one
+		res, err := tx.Exec(
+			`UPDATE products
+         SET name = $1, description = $2, price_cents = $3,
+             tax_category = COALESCE(NULLIF($4, ''), tax_category)
+       WHERE id = $5;`,
+			in.Name, in.Description, in.PriceCents, in.TaxCategory, id,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+
+		// Nil prices, categories and tags keep the current ones
+		if in.Prices != nil {
+			if _, err := tx.Exec(`DELETE FROM product_prices WHERE product_id = $1;`, id); err != nil {
+				return err
+			}
+			if err := insertProductPrices(tx, id, in.Prices); err != nil {
+				return err
+			}
+		}
+		if in.CategoryIDs != nil {
+			if _, err := tx.Exec(`DELETE FROM product_categories WHERE product_id = $1;`, id); err != nil {
+				return err
+			}
+			if err := setProductCategories(tx, id, in.CategoryIDs); err != nil {
+				return err
+			}
+		}
+		if in.Tags != nil {
+			if _, err := tx.Exec(`DELETE FROM product_tags WHERE product_id = $1;`, id); err != nil {
+				return err
+			}
+			if err := setProductTags(tx, id, in.Tags); err != nil {
+				return err
+			}
+		}
+		return recordPriceChange(tx, id, in.AdminID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(id)
+}
+
+// insertProductPrices records a product's explicit prices in other currencies.
+func insertProductPrices(tx *sql.Tx, productID int, prices map[string]int) error {
+	for currency, cents := range prices {
+		if _, err := tx.Exec(
+			`INSERT INTO product_prices (product_id, currency, price_cents) VALUES ($1, $2, $3);`,
+			productID, currency, cents,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ProductStore) Archive(id int) error {
+	// An archived product keeps the time it was first archived
+	res, err := s.db.Exec(
+		`UPDATE products SET archived_at = COALESCE(archived_at, NOW()) WHERE id = $1;`, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *ProductStore) Restore(id int) (*store.Product, error) {
+	res, err := s.db.Exec(`UPDATE products SET archived_at = NULL WHERE id = $1;`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, store.ErrNotFound
+	}
+	return s.Get(id)
+}
+
+func (s *ProductStore) AdjustStock(productID int, adj store.StockAdjustment) (*store.StockLevel, error) {
+	var level store.StockLevel
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`SELECT id, stock_quantity, unlimited_stock FROM products WHERE id = $1 FOR UPDATE;`,
+			productID,
+		).Scan(&level.ProductID, &level.StockQuantity, &level.UnlimitedStock)
+		if err != nil {
+			return notFound(err)
+		}
+
+		if level.StockQuantity+adj.Delta < 0 {
+			return &store.NegativeStockError{Current: level.StockQuantity}
+		}
+		level.StockQuantity += adj.Delta
+		if adj.Unlimited != nil {
+			level.UnlimitedStock = *adj.Unlimited
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE products SET stock_quantity = $1, unlimited_stock = $2 WHERE id = $3;`,
+			level.StockQuantity, level.UnlimitedStock, productID,
+		); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`INSERT INTO stock_adjustments (product_id, delta, reason, admin_user_id)
+       VALUES ($1, $2, $3, $4);`,
+			productID, adj.Delta, adj.Reason, adj.AdminID,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+// setProductCategories assigns a product to categoryIDs, which must all exist.
+func setProductCategories(tx *sql.Tx, productID int, categoryIDs []int) error {
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(categoryIDs))
+	for i, id := range categoryIDs {
+		ids[i] = int64(id)
+	}
+
+	var missing int
+	err := tx.QueryRow(
+		`SELECT want.id FROM unnest($1::int[]) AS want(id)
+      WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE c.id = want.id)
+      LIMIT 1;`,
+		pq.Array(ids),
+	).Scan(&missing)
+	if err == nil {
+		return store.CategoryNotFoundError(missing)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO product_categories (product_id, category_id)
+     SELECT $1, id FROM categories WHERE id = ANY($2)
+     ON CONFLICT DO NOTHING;`,
+		productID, pq.Array(ids),
+	)
+	return err
+}
+
+// setProductTags assigns tags (normalized names) to a product, creating the
+// ones that do not exist yet.
+func setProductTags(tx *sql.Tx, productID int, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO tags (name) SELECT DISTINCT unnest($1::text[])
+     ON CONFLICT (name) DO NOTHING;`,
+		pq.Array(tags),
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`INSERT INTO product_tags (product_id, tag_id)
+     SELECT $1, id FROM tags WHERE name = ANY($2)
+     ON CONFLICT DO NOTHING;`,
+		productID, pq.Array(tags),
+	)
+	return err
+}
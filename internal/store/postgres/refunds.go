@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+func (s *OrderStore) Refund(orderID, adminID int, issue func(o *store.RefundableOrder) (*store.Refund, error)) (*store.Refund, error) {
+	var refund *store.Refund
+	// Hold the order row for the whole refund so concurrent refunds cannot
+	// both pass the "remaining amount" check.
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		o := store.RefundableOrder{ID: orderID}
+		var piID sql.NullString
+		err := tx.QueryRow(
+			`SELECT status, stripe_payment_intent_id, total_cents, refunded_cents
+         FROM orders
+        WHERE id = $1
+        FOR UPDATE;`,
+			orderID,
+		).Scan(&o.Status, &piID, &o.TotalCents, &o.RefundedCents)
+		if err != nil {
+			return notFound(err)
+		}
+		o.StripePaymentIntentID = piID.String
+
+		if o.Lines, err = loadRefundableLines(tx, orderID); err != nil {
+			return err
+		}
+
+		if refund, err = issue(&o); err != nil {
+			return err
+		}
+		refund.OrderID = orderID
+		return recordRefund(tx, adminID, o.Lines, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// loadRefundableLines locks and returns the lines of an order keyed by line ID.
+func loadRefundableLines(tx *sql.Tx, orderID int) (map[int]store.RefundableLine, error) {
+	rows, err := tx.Query(
+		`SELECT id, product_id, variant_id, COALESCE(variant_sku, ''), quantity, refunded_quantity,
+            unit_price_cents, discount_cents, tax_cents
+       FROM order_lines
+      WHERE order_id = $1
+      ORDER BY id
+      FOR UPDATE;`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := map[int]store.RefundableLine{}
+	for rows.Next() {
+		var (
+			l         store.RefundableLine
+			productID sql.NullInt64
+			variantID sql.NullInt64
+		)
+		if err := rows.Scan(
+			&l.ID, &productID, &variantID, &l.VariantSKU, &l.Quantity, &l.RefundedQty,
+			&l.UnitPriceCents, &l.DiscountCents, &l.TaxCents,
+		); err != nil {
+			return nil, err
+		}
+		if productID.Valid {
+			id := int(productID.Int64)
+			l.ProductID = &id
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			l.VariantID = &id
+		}
+		lines[l.ID] = l
+	}
+	return lines, rows.Err()
+}
+
+// recordRefund stores the refund and its lines, updates the order totals and,
+// when requested, restocks the refunded quantities. It fills refund.ID and CreatedAt.
+func recordRefund(tx *sql.Tx, adminID int, lines map[int]store.RefundableLine, refund *store.Refund) error {
+	err := tx.QueryRow(
+		`INSERT INTO refunds
+       (order_id, stripe_refund_id, amount_cents, status, reason, restocked, admin_user_id)
+     VALUES ($1, $2, $3, $4, $5, $6, $7)
+     RETURNING id, created_at;`,
+		refund.OrderID, refund.StripeRefundID, refund.AmountCents, refund.Status, refund.Reason, refund.Restocked, adminID,
+	).Scan(&refund.ID, &refund.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, rl := range refund.Lines {
+		line := lines[rl.OrderLineID]
+		if _, err := tx.Exec(
+			`INSERT INTO refund_lines (refund_id, order_line_id, quantity, amount_cents)
+       VALUES ($1, $2, $3, $4);`,
+			refund.ID, rl.OrderLineID, rl.Quantity, line.AmountFor(rl.Quantity),
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE order_lines SET refunded_quantity = refunded_quantity + $1 WHERE id = $2;`,
+			rl.Quantity, rl.OrderLineID,
+		); err != nil {
+			return err
+		}
+
+		// Variants deleted since the sale have no stock to return to
+		if !refund.Restocked || line.ProductID == nil || (line.VariantSKU != "" && line.VariantID == nil) {
+			continue
+		}
+		var (
+			res sql.Result
+			err error
+		)
+		if line.VariantID != nil {
+			res, err = tx.Exec(
+				`UPDATE product_variants SET stock_quantity = stock_quantity + $1
+          WHERE id = $2 AND NOT unlimited_stock;`,
+				rl.Quantity, *line.VariantID,
+			)
+		} else {
+			res, err = tx.Exec(
+				`UPDATE products SET stock_quantity = stock_quantity + $1
+          WHERE id = $2 AND NOT unlimited_stock;`,
+				rl.Quantity, *line.ProductID,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO stock_adjustments (product_id, variant_id, delta, reason, admin_user_id, order_id)
+       VALUES ($1, $2, $3, $4, $5, $6);`,
+			*line.ProductID, line.VariantID, rl.Quantity, stockReasonOrderRefunded, adminID, refund.OrderID,
+		); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE orders
+        SET refunded_cents = $1, status = $2, updated_at = NOW()
+      WHERE id = $3;`,
+		refund.RefundedCents, refund.OrderStatus, refund.OrderID,
+	)
+	return err
+}
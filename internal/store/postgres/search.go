@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// headlineOptions configures ts_headline for search results.
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, HighlightAll=true`
+
+// snippetOptions picks up to two short fragments of a description.
+const snippetOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=" … "`
+
+func (s *ProductStore) Search(text string, limit int) ([]store.ProductSearchResult, error) {
+	// $1 is the prefix query, $2 the raw text for trigram similarity.
+	rows, err := s.db.Query(`
+    SELECT `+productColumns+`,
+           ts_rank_cd(p.search_vector, q.query) + similarity(p.name, $2) AS rank,
+           ts_headline('english', `+htmlEscape("p.name")+`, q.query, '`+headlineOptions+`'),
+           ts_headline('english', `+htmlEscape("COALESCE(p.description, '')")+`, q.query, '`+snippetOptions+`')
+      FROM products p
+     CROSS JOIN (SELECT to_tsquery('english', $1) AS query) q
+     WHERE (p.search_vector @@ q.query OR p.name % $2) AND p.archived_at IS NULL
+     ORDER BY p.search_vector @@ q.query DESC, rank DESC, p.id
+     LIMIT $3;`,
+		prefixQuery(text), text, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]store.ProductSearchResult, 0)
+	for rows.Next() {
+		var r store.ProductSearchResult
+		if err := scanProduct(rows, &r.Product, &r.Rank, &r.NameHighlight, &r.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// htmlEscape returns a SQL expression escaping the text of expr like
+// html.EscapeString, so that the <mark> tags ts_headline adds are the only
+// markup in its output. The parser reads the entities as single tokens, which
+// are never highlighted.
+func htmlEscape(expr string) string {
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"}} {
+		expr = "REPLACE(" + expr + ", '" + strings.ReplaceAll(r[0], "'", "''") + "', '" + r[1] + "')"
+	}
+	return expr
+}
+
+// prefixQuery turns search text into a tsquery matching every word, each as a
+// prefix ("blue wid" → "blue:* & wid:*"). Anything but letters and digits
+// separates words, so the text cannot inject tsquery operators.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// TagStore implements store.TagStore.
+type TagStore struct {
+	db *sql.DB
+}
+
+const tagSelect = `
+    SELECT t.id, t.name,
+           (SELECT COUNT(*) FROM product_tags pt JOIN products p ON p.id = pt.product_id
+             WHERE pt.tag_id = t.id AND p.archived_at IS NULL),
+           t.created_at
+      FROM tags t`
+
+func (s *TagStore) List() ([]store.Tag, error) {
+	rows, err := s.db.Query(tagSelect + `
+     ORDER BY t.name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]store.Tag, 0)
+	for rows.Next() {
+		var t store.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.ProductCount, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *TagStore) Create(name string) (*store.Tag, error) {
+	t := &store.Tag{Name: name}
+	err := s.db.QueryRow(
+		`INSERT INTO tags (name) VALUES ($1) RETURNING id, created_at;`,
+		name,
+	).Scan(&t.ID, &t.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, store.ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *TagStore) Rename(id int, name string) (*store.Tag, error) {
+	_, err := s.db.Exec(`UPDATE tags SET name = $1 WHERE id = $2;`, name, id)
+	if isUniqueViolation(err) {
+		return nil, store.ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t store.Tag
+	err = s.db.QueryRow(tagSelect+`
+     WHERE t.id = $1;`, id).Scan(&t.ID, &t.Name, &t.ProductCount, &t.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &t, nil
+}
+
+func (s *TagStore) Delete(id int) error {
+	res, err := s.db.Exec(`DELETE FROM tags WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// paidOrderStatuses are the statuses of orders whose payment (and tax) was collected.
+var paidOrderStatuses = []string{
+	store.OrderStatusPaid,
+	store.OrderStatusPartiallyRefunded,
+	store.OrderStatusRefunded,
+	store.OrderStatusDisputed,
+	store.OrderStatusNeedsReview,
+}
+
+// netOf scales an order line amount down by its refunded quantity and converts
+// it to the base currency at the order's exchange rate (see orderRate).
+func netOf(column string) string {
+	return `ROUND((` + column + ` * (ol.quantity - ol.refunded_quantity) / ol.quantity) / ` + orderRate + `)`
+}
+
+func (s *OrderStore) TaxReport(filter store.TaxReportFilter) ([]store.ProvinceTaxSummary, error) {
+	clauses := []string{"o.tax_province IS NOT NULL", "o.status = ANY($1)"}
+	args := []interface{}{pq.Array(paidOrderStatuses)}
+
+	// Bound as literals: created_at is a TIMESTAMP without time zone
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.Format(timestampLayout))
+		clauses = append(clauses, "o.created_at >= $"+strconv.Itoa(len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.Format(timestampLayout))
+		clauses = append(clauses, "o.created_at < $"+strconv.Itoa(len(args)))
+	}
+	where := strings.Join(clauses, " AND ")
+
+	net := netOf("(ol.total_price_cents - ol.discount_cents)")
+	rows, err := s.db.Query(`
+		SELECT
+			o.tax_province,
+			COUNT(DISTINCT o.id),
+			COALESCE(SUM(`+net+`) FILTER (WHERE ol.tax_category = 'taxable'), 0)::bigint,
+			COALESCE(SUM(`+net+`) FILTER (WHERE ol.tax_category = 'zero_rated'), 0)::bigint,
+			COALESCE(SUM(`+net+`) FILTER (WHERE ol.tax_category = 'exempt'), 0)::bigint
+		FROM orders o
+		JOIN order_lines ol ON ol.order_id = o.id
+		WHERE `+where+`
+		GROUP BY o.tax_province
+		ORDER BY o.tax_province;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]store.ProvinceTaxSummary, 0)
+	byProvince := map[string]int{}
+	for rows.Next() {
+		var p store.ProvinceTaxSummary
+		if err := rows.Scan(&p.Province, &p.Orders, &p.TaxableSalesCents, &p.ZeroRatedSalesCents, &p.ExemptSalesCents); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Taxes = []store.TaxTypeSummary{}
+		byProvince[p.Province] = len(summaries)
+		summaries = append(summaries, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`
+		SELECT
+			o.tax_province,
+			t.tax_type,
+			TRIM(TRAILING '.' FROM TRIM(TRAILING '0' FROM t.rate_percent::text)),
+			COALESCE(SUM(`+netOf("t.amount_cents")+`), 0)::bigint
+		FROM orders o
+		JOIN order_lines ol ON ol.order_id = o.id
+		JOIN order_line_taxes t ON t.order_line_id = ol.id
+		WHERE `+where+`
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			province string
+			t        store.TaxTypeSummary
+		)
+		if err := rows.Scan(&province, &t.Type, &t.RatePercent, &t.AmountCents); err != nil {
+			return nil, err
+		}
+		i, ok := byProvince[province]
+		if !ok {
+			continue
+		}
+		summaries[i].Taxes = append(summaries[i].Taxes, t)
+		summaries[i].TaxCents += t.AmountCents
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// TokenStore implements store.TokenStore.
+type TokenStore struct {
+	db *sql.DB
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insertRefreshToken stores a refresh token hash, with the access token issued
+// alongside it, and returns its row ID.
+func insertRefreshToken(q queryRower, userID int, tokenHash, family string, ttl time.Duration, access store.AccessToken) (int, error) {
+	var id int
+	err := q.QueryRow(
+		`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, access_jti, access_expires_at)
+     VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second', $5, $6)
+     RETURNING id;`,
+		userID, tokenHash, family, int(ttl.Seconds()), access.JTI, access.ExpiresAt.UTC(),
+	).Scan(&id)
+	return id, err
+}
+
+func (s *TokenStore) CreateRefreshToken(userID int, tokenHash, family string, ttl time.Duration, access store.AccessToken) error {
+	_, err := insertRefreshToken(s.db, userID, tokenHash, family, ttl, access)
+	return err
+}
+
+func (s *TokenStore) RotateRefreshToken(oldHash, newHash string, ttl time.Duration, access store.AccessToken) (*store.User, error) {
+	var user store.User
+	reused := false
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		var (
+			id        int
+			family    string
+			expired   bool
+			revokedAt sql.NullTime
+		)
+		err := tx.QueryRow(
+			`SELECT rt.id, rt.user_id, u.username, rt.family_id, rt.expires_at < NOW(), rt.revoked_at
+         FROM refresh_tokens rt
+         JOIN users u ON u.id = rt.user_id
+        WHERE rt.token_hash = $1
+        FOR UPDATE OF rt;`,
+			oldHash,
+		).Scan(&id, &user.ID, &user.Username, &family, &expired, &revokedAt)
+		if err != nil {
+			return notFound(err)
+		}
+
+		if revokedAt.Valid {
+			// Commit the family revocation, then report the reuse.
+			log.Printf("WARNING: refresh token reuse for user %d, revoking family %s\n", user.ID, family)
+			reused = true
+			return revokeFamily(tx, family)
+		}
+		if expired {
+			return store.ErrTokenExpired
+		}
+
+		newID, err := insertRefreshToken(tx, user.ID, newHash, family, ttl, access)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2;`,
+			newID, id,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, store.ErrTokenReused
+	}
+	return &user, nil
+}
+
+// revokeFamily revokes every still-active refresh token of a family.
+func revokeFamily(tx *sql.Tx, family string) error {
+	_, err := tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+      WHERE family_id = $1 AND revoked_at IS NULL;`,
+		family,
+	)
+	return err
+}
+
+func (s *TokenStore) Logout(userID int, jti string, expiresAt time.Time, refreshHash string) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(
+			`INSERT INTO revoked_access_tokens (jti, user_id, expires_at)
+       VALUES ($1, $2, $3)
+       ON CONFLICT (jti) DO NOTHING;`,
+			jti, userID, expiresAt.UTC(),
+		); err != nil {
+			return err
+		}
+		// Denylist entries are useless once the token has expired anyway.
+		if _, err := tx.Exec(`DELETE FROM revoked_access_tokens WHERE expires_at < NOW();`); err != nil {
+			return err
+		}
+
+		if refreshHash == "" {
+			return nil
+		}
+		var family string
+		err := tx.QueryRow(
+			`SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2;`,
+			refreshHash, userID,
+		).Scan(&family)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return revokeFamily(tx, family)
+	})
+}
+
+func (s *TokenStore) RevokeUser(userID int) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		var id int
+		if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1;`, userID).Scan(&id); err != nil {
+			return notFound(err)
+		}
+		// Wait for rotations in flight, so the statements below (which see what
+		// they commit) cover the tokens they issue; later rotations find their
+		// token revoked.
+		if _, err := tx.Exec(
+			`SELECT id FROM refresh_tokens WHERE user_id = $1 AND revoked_at IS NULL FOR UPDATE;`,
+			userID,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO revoked_access_tokens (jti, user_id, expires_at)
+       SELECT access_jti, user_id, access_expires_at
+         FROM refresh_tokens
+        WHERE user_id = $1 AND access_jti IS NOT NULL AND access_expires_at > NOW()
+       ON CONFLICT (jti) DO NOTHING;`,
+			userID,
+		); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`UPDATE refresh_tokens SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL;`,
+			userID,
+		)
+		return err
+	})
+}
+
+func (s *TokenStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM revoked_access_tokens WHERE jti = $1);`,
+		jti,
+	).Scan(&revoked)
+	return revoked, err
+}
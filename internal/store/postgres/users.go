@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// UserStore implements store.UserStore.
+type UserStore struct {
+	db *sql.DB
+}
+
+func (s *UserStore) Create(username, email, passwordHash string) (int, error) {
+	var id int
+	err := s.db.QueryRow(
+		`INSERT INTO users (username, email, password)
+     VALUES ($1, $2, $3)
+     RETURNING id;`,
+		username, email, passwordHash,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, store.ErrConflict
+	}
+	return id, err
+}
+
+func (s *UserStore) Get(id int) (*store.User, error) {
+	return s.getBy(`id = $1`, id)
+}
+
+func (s *UserStore) GetByEmail(email string) (*store.User, error) {
+	return s.getBy(`email = $1`, email)
+}
+
+func (s *UserStore) GetByStripeCustomerID(customerID string) (*store.User, error) {
+	return s.getBy(`stripe_customer_id = $1`, customerID)
+}
+
+func (s *UserStore) getBy(where string, arg interface{}) (*store.User, error) {
+	var (
+		u          store.User
+		customerID sql.NullString
+		province   sql.NullString
+	)
+	err := s.db.QueryRow(
+		`SELECT id, username, email, password, stripe_customer_id, billing_province
+       FROM users
+      WHERE `+where+`;`,
+		arg,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &customerID, &province)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	u.StripeCustomerID = customerID.String
+	u.BillingProvince = province.String
+	return &u, nil
+}
+
+func (s *UserStore) SetStripeCustomerID(userID int, customerID string) error {
+	_, err := s.db.Exec(
+		`UPDATE users SET stripe_customer_id = $1 WHERE id = $2;`,
+		customerID, userID,
+	)
+	return err
+}
+
+func (s *UserStore) SetBillingProvince(userID int, province string) error {
+	_, err := s.db.Exec(
+		`UPDATE users SET billing_province = $1 WHERE id = $2;`,
+		province, userID,
+	)
+	return err
+}
+
+// AdminStore implements store.AdminStore.
+type AdminStore struct {
+	db *sql.DB
+}
+
+func (s *AdminStore) IsAdmin(userID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM admins WHERE user_id = $1);`,
+		userID,
+	).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,264 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"github.com/Brossef/rescounts-task/internal/store"
+)
+
+// ProductVariantStore implements store.ProductVariantStore.
+type ProductVariantStore struct {
+	db *sql.DB
+}
+
+const variantSelect = `
+    SELECT v.id, v.product_id, v.sku, v.options, ` + currentPriceExpr + `, v.price_cents,
+           v.stock_quantity, v.unlimited_stock
+      FROM product_variants v
+      JOIN products p ON p.id = v.product_id`
+
+func scanVariant(row rowScanner) (*store.ProductVariant, error) {
+	var (
+		v        store.ProductVariant
+		options  []byte
+		override sql.NullInt64
+	)
+	if err := row.Scan(
+		&v.ID, &v.ProductID, &v.SKU, &options, &v.PriceCents, &override,
+		&v.StockQuantity, &v.UnlimitedStock,
+	); err != nil {
+		return nil, err
+	}
+	if override.Valid {
+		price := int(override.Int64)
+		v.PriceOverrideCents = &price
+	}
+	if err := json.Unmarshal(options, &v.Options); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// lockProductOptions locks a product, so its options and variants cannot change
+// concurrently, and returns its options; ErrNotFound for an unknown product.
+func lockProductOptions(tx *sql.Tx, productID int) ([]store.ProductOption, error) {
+	if err := tx.QueryRow(
+		`SELECT id FROM products WHERE id = $1 FOR UPDATE;`, productID,
+	).Scan(new(int)); err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := tx.Query(
+		`SELECT name, option_values FROM product_options WHERE product_id = $1 ORDER BY position;`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := make([]store.ProductOption, 0)
+	for rows.Next() {
+		var o store.ProductOption
+		if err := rows.Scan(&o.Name, pq.Array(&o.Values)); err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+	return options, rows.Err()
+}
+
+func (s *ProductVariantStore) SetOptions(productID int, options []store.ProductOption) ([]store.ProductOption, error) {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if _, err := lockProductOptions(tx, productID); err != nil {
+			return err
+		}
+
+		// Every existing variant must still have one valid value per option
+		rows, err := tx.Query(`SELECT options FROM product_variants WHERE product_id = $1;`, productID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var raw []byte
+			var values map[string]string
+			if err := rows.Scan(&raw); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return err
+			}
+			if store.CheckVariantOptions(options, values) != nil {
+				return store.ErrOptionsInUse
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if _, err := tx.Exec(`DELETE FROM product_options WHERE product_id = $1;`, productID); err != nil {
+			return err
+		}
+		for i, o := range options {
+			if _, err := tx.Exec(
+				`INSERT INTO product_options (product_id, name, option_values, position)
+         VALUES ($1, $2, $3, $4);`,
+				productID, o.Name, pq.Array(o.Values), i+1,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (s *ProductVariantStore) Create(productID int, in store.VariantInput) (*store.ProductVariant, error) {
+	var v *store.ProductVariant
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		options, err := lockProductOptions(tx, productID)
+		if err != nil {
+			return err
+		}
+		if err := store.CheckVariantOptions(options, in.Options); err != nil {
+			return err
+		}
+
+		var id int
+		err = tx.QueryRow(
+			`INSERT INTO product_variants
+         (product_id, sku, options, price_cents, stock_quantity, unlimited_stock)
+       VALUES ($1, $2, $3, $4, $5, $6)
+       RETURNING id;`,
+			productID, in.SKU, variantOptionsJSON(in.Options), nullInt(in.PriceOverrideCents),
+			in.StockQuantity, in.UnlimitedStock,
+		).Scan(&id)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		if err := recordVariantPriceChange(tx, id, in.AdminID); err != nil {
+			return err
+		}
+		v, err = scanVariant(tx.QueryRow(variantSelect+` WHERE v.id = $1;`, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *ProductVariantStore) Update(productID, variantID int, in store.VariantInput) (*store.ProductVariant, error) {
+	var v *store.ProductVariant
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		options, err := lockProductOptions(tx, productID)
+		if err != nil {
+			return err
+		}
+		if err := store.CheckVariantOptions(options, in.Options); err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(
+			`UPDATE product_variants
+          SET sku = $1, options = $2, price_cents = $3
+        WHERE id = $4 AND product_id = $5;`,
+			in.SKU, variantOptionsJSON(in.Options), nullInt(in.PriceOverrideCents), variantID, productID,
+		)
+		if isUniqueViolation(err) {
+			return store.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrNotFound
+		}
+		if err := recordVariantPriceChange(tx, variantID, in.AdminID); err != nil {
+			return err
+		}
+		v, err = scanVariant(tx.QueryRow(variantSelect+` WHERE v.id = $1;`, variantID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *ProductVariantStore) Delete(productID, variantID int) error {
+	res, err := s.db.Exec(
+		`DELETE FROM product_variants WHERE id = $1 AND product_id = $2;`,
+		variantID, productID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *ProductVariantStore) AdjustStock(productID, variantID int, adj store.StockAdjustment) (*store.StockLevel, error) {
+	level := store.StockLevel{ProductID: productID, VariantID: variantID}
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			`SELECT stock_quantity, unlimited_stock FROM product_variants
+        WHERE id = $1 AND product_id = $2 FOR UPDATE;`,
+			variantID, productID,
+		).Scan(&level.StockQuantity, &level.UnlimitedStock)
+		if err != nil {
+			return notFound(err)
+		}
+
+		if level.StockQuantity+adj.Delta < 0 {
+			return &store.NegativeStockError{Current: level.StockQuantity}
+		}
+		level.StockQuantity += adj.Delta
+		if adj.Unlimited != nil {
+			level.UnlimitedStock = *adj.Unlimited
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE product_variants SET stock_quantity = $1, unlimited_stock = $2 WHERE id = $3;`,
+			level.StockQuantity, level.UnlimitedStock, variantID,
+		); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`INSERT INTO stock_adjustments (product_id, variant_id, delta, reason, admin_user_id)
+       VALUES ($1, $2, $3, $4, $5);`,
+			productID, variantID, adj.Delta, adj.Reason, adj.AdminID,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+// variantOptionsJSON encodes a variant's option values for the options column.
+func variantOptionsJSON(values map[string]string) string {
+	if values == nil {
+		return "{}"
+	}
+	raw, _ := json.Marshal(values)
+	return string(raw)
+}
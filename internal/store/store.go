@@ -0,0 +1,339 @@
+// Package store defines the persistence interfaces used by the HTTP handlers.
+// The Postgres implementation lives in store/postgres; handlers only depend on
+// the interfaces here so they can be exercised against in-memory fakes.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist (or is not
+	// visible to the caller, e.g. another user's card).
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write violates a uniqueness constraint.
+	ErrConflict = errors.New("conflict")
+	// ErrTokenExpired is returned for a refresh token past its expiry.
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenReused is returned when an already rotated or revoked refresh
+	// token is presented; its whole family has been revoked.
+	ErrTokenReused = errors.New("token reused")
+	// ErrCategoryCycle is returned when a category would become its own ancestor.
+	ErrCategoryCycle = errors.New("category cycle")
+	// ErrCategoryNotEmpty is returned when deleting a category with subcategories.
+	ErrCategoryNotEmpty = errors.New("category has subcategories")
+	// ErrImageOrder is returned when a new image order does not list each of
+	// the product's images exactly once.
+	ErrImageOrder = errors.New("image order does not match the product's images")
+	// ErrOptionsInUse is returned when changing a product's options would leave
+	// one of its variants without a valid value for each option.
+	ErrOptionsInUse = errors.New("options in use by variants")
+	// ErrScheduleOverlap is returned when a price schedule would overlap
+	// another uncancelled schedule of the same product.
+	ErrScheduleOverlap = errors.New("price schedule overlaps another one")
+	// ErrScheduleEnded is returned when cancelling a price schedule that has
+	// already ended or been cancelled.
+	ErrScheduleEnded = errors.New("price schedule has ended")
+	// ErrCartCheckedOut is returned by CreatePending when a cart item is
+	// already checked out in another order that is still pending.
+	ErrCartCheckedOut = errors.New("cart is already being checked out")
+)
+
+// Stores bundles every store the server needs.
+type Stores struct {
+	Users           UserStore
+	Admins          AdminStore
+	Products        ProductStore
+	Images          ProductImageStore
+	Variants        ProductVariantStore
+	PriceSchedules  PriceScheduleStore
+	Cards           CardStore
+	Carts           CartStore
+	Categories      CategoryStore
+	Tags            TagStore
+	Coupons         CouponStore
+	FXRates         FXRateStore
+	Orders          OrderStore
+	Tokens          TokenStore
+	IdempotencyKeys IdempotencyStore
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	// Create inserts a user and returns its ID; ErrConflict if the username or email is taken.
+	Create(username, email, passwordHash string) (int, error)
+	Get(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetByStripeCustomerID(customerID string) (*User, error)
+	SetStripeCustomerID(userID int, customerID string) error
+	SetBillingProvince(userID int, province string) error
+}
+
+// AdminStore answers whether a user is an admin.
+type AdminStore interface {
+	IsAdmin(userID int) (bool, error)
+}
+
+// ProductStore persists the catalog and its stock.
+type ProductStore interface {
+	// List returns the page of products q selects, in base currency prices.
+	// Archived products are only listed with q.Archived.
+	List(q ProductQuery) (*ProductPage, error)
+	// Get returns a product, archived or not.
+	Get(id int) (*Product, error)
+	// Search returns up to limit unarchived products matching text, best first:
+	// full-text matches (words or word prefixes of the name or description), then
+	// names similar to text. Typos are only tolerated in names: descriptions
+	// match by words and prefixes alone.
+	Search(text string, limit int) ([]ProductSearchResult, error)
+	// Create inserts a product; CategoryNotFoundError for an unknown category.
+	Create(in ProductInput) (*Product, error)
+	// Update changes name, description, price and, unless empty, tax category and
+	// (unless nil) explicit currency prices, categories and tags; stock is changed
+	// through AdjustStock.
+	Update(id int, in ProductInput) (*Product, error)
+	// Archive hides a product from the catalog and stops its sales, keeping it
+	// for past orders; archiving an archived product is a no-op.
+	Archive(id int) error
+	// Restore puts an archived product back in the catalog and returns it.
+	Restore(id int) (*Product, error)
+	// PriceHistory returns a product's price history, newest first. Create and
+	// Update record an entry whenever the name or a price changes, and the
+	// variant store's whenever a variant's price override does.
+	PriceHistory(productID int) ([]PriceChange, error)
+	// AdjustStock adds delta to a product's stock (and optionally toggles unlimited
+	// stock), recording the adjustment. *NegativeStockError if it would go below zero.
+	AdjustStock(productID int, adj StockAdjustment) (*StockLevel, error)
+}
+
+// ProductImageStore persists the metadata of product images. Images are only
+// looked up through their product, so another product's image is ErrNotFound.
+type ProductImageStore interface {
+	// List returns a product's images in display order.
+	List(productID int) ([]ProductImage, error)
+	// Create adds an image after the product's others, filling in its ID,
+	// Position and IsPrimary; the product's first image becomes its primary one.
+	// ErrNotFound for an unknown product.
+	Create(img *ProductImage, primary bool) error
+	// SetPrimary makes one of a product's images its primary one.
+	SetPrimary(productID, imageID int) error
+	// Reorder sets the display order of a product's images to imageIDs, which
+	// must list each of them once (else ErrImageOrder), and returns them.
+	Reorder(productID int, imageIDs []int) ([]ProductImage, error)
+	// Delete removes an image and returns it, so its files can be removed. When
+	// it was the primary one, the first remaining image becomes the primary.
+	Delete(productID, imageID int) (*ProductImage, error)
+}
+
+// PriceScheduleStore persists products' price schedules. Schedules are only
+// looked up through their product, so another product's schedule is ErrNotFound.
+type PriceScheduleStore interface {
+	// List returns a product's schedules, including ended and cancelled ones,
+	// by start time; ErrNotFound for an unknown product.
+	List(productID int) ([]PriceSchedule, error)
+	// Create adds a schedule; ErrNotFound for an unknown product and
+	// ErrScheduleOverlap if it overlaps another uncancelled one.
+	Create(productID int, in PriceScheduleInput) (*PriceSchedule, error)
+	// Cancel stops a schedule, whether it has started or not, and returns it;
+	// ErrScheduleEnded if it has already ended or been cancelled.
+	Cancel(productID, scheduleID int) (*PriceSchedule, error)
+}
+
+// ProductVariantStore persists products' options and variants. Variants are
+// only looked up through their product, so another product's variant is ErrNotFound.
+type ProductVariantStore interface {
+	// SetOptions replaces a product's options; ErrOptionsInUse if an existing
+	// variant would no longer match them (see CheckVariantOptions).
+	SetOptions(productID int, options []ProductOption) ([]ProductOption, error)
+	// Create adds a variant to a product. ErrNotFound for an unknown product,
+	// VariantOptionsError if its options do not match the product's, and
+	// ErrConflict if the SKU or the combination of options is taken.
+	Create(productID int, in VariantInput) (*ProductVariant, error)
+	// Update changes a variant's SKU, options and price override, with the
+	// errors of Create; its stock is changed through AdjustStock.
+	Update(productID, variantID int, in VariantInput) (*ProductVariant, error)
+	// Delete removes a variant; order lines keep its SKU and options.
+	Delete(productID, variantID int) error
+	// AdjustStock is ProductStore.AdjustStock for a variant.
+	AdjustStock(productID, variantID int, adj StockAdjustment) (*StockLevel, error)
+}
+
+// CardStore persists the metadata of users' saved cards.
+type CardStore interface {
+	// Create saves a card, filling in its ID and IsDefault; the user's first
+	// card becomes their default. ErrConflict if the payment method or the
+	// card (by fingerprint) is already saved.
+	Create(card *Card) error
+	Get(cardID int) (*Card, error)
+	// GetForUser returns a card only if it belongs to userID.
+	GetForUser(cardID, userID int) (*Card, error)
+	// ListForUser returns the user's cards, default first, then newest first.
+	ListForUser(userID int) ([]Card, error)
+	GetByPaymentMethod(paymentMethodID string) (*Card, error)
+	// GetByFingerprint returns the user's card for a card number, if saved.
+	GetByFingerprint(userID int, fingerprint string) (*Card, error)
+	// GetDefault returns the user's default card; ErrNotFound if there is none.
+	GetDefault(userID int) (*Card, error)
+	// SetDefault makes one of the user's cards their default.
+	SetDefault(userID, cardID int) error
+	// Delete removes a card. When it was the default, the user's most recently
+	// added remaining card that has not expired becomes the default, if any.
+	Delete(cardID int) error
+	// ListUnexpired returns every card not yet flagged as expired.
+	ListUnexpired() ([]Card, error)
+	// SetExpiryStatus changes a card's expiry status and, when it becomes
+	// expiring or expired, records a CardExpiryEvent for its owner. A default
+	// card that expires hands the default over as Delete does, if it can.
+	SetExpiryStatus(cardID int, status string) error
+	// ListExpiryEvents returns the user's card expiry events, newest first.
+	ListExpiryEvents(userID int) ([]CardExpiryEvent, error)
+}
+
+// CartStore persists users' shopping carts. Items are only looked up through
+// their owner, so another user's item is ErrNotFound.
+type CartStore interface {
+	// List returns the user's cart items, oldest first, with their current prices.
+	List(userID int) ([]CartItem, error)
+	// Add puts quantity of a product (variantID 0) or of one of its variants in
+	// the cart at its current price, or adds quantity to its existing item.
+	// Changing an item keeps it in the cart when the order it was checked out
+	// in (see NewOrder.CartItemIDs) is paid, as does SetQuantity.
+	// ProductNotFoundError for an unknown product, and ProductArchivedError,
+	// *VariantNotFoundError or VariantRequiredError like CreatePending.
+	Add(userID, productID, variantID, quantity int) (*CartItem, error)
+	// SetQuantity changes the quantity of one of the user's items.
+	SetQuantity(userID, itemID, quantity int) (*CartItem, error)
+	// Remove deletes one of the user's items.
+	Remove(userID, itemID int) error
+	// Clear empties the user's cart.
+	Clear(userID int) error
+}
+
+// CategoryStore persists the category tree. Create and Update return ErrConflict
+// if the slug is taken and CategoryNotFoundError for an unknown parent.
+type CategoryStore interface {
+	// List returns every category, by name.
+	List() ([]Category, error)
+	GetBySlug(slug string) (*Category, error)
+	Create(in CategoryInput) (*Category, error)
+	// Update also moves the category; ErrCategoryCycle if the new parent is the
+	// category itself or one of its subcategories.
+	Update(id int, in CategoryInput) (*Category, error)
+	// Delete removes a category and its product assignments;
+	// ErrCategoryNotEmpty if it has subcategories.
+	Delete(id int) error
+}
+
+// TagStore persists tags. Tags are also created by assigning them to products.
+type TagStore interface {
+	// List returns every tag, by name.
+	List() ([]Tag, error)
+	// Create inserts a tag; ErrConflict if the name is taken.
+	Create(name string) (*Tag, error)
+	// Rename changes a tag's name; ErrConflict if the name is taken.
+	Rename(id int, name string) (*Tag, error)
+	Delete(id int) error
+}
+
+// FXRateStore persists the exchange rates from the base currency.
+type FXRateStore interface {
+	// List returns every rate, by currency.
+	List() ([]FXRate, error)
+	// Get returns the rate of a currency; ErrNotFound if it has none.
+	Get(currency string) (*FXRate, error)
+	// Set creates or replaces the rate of a currency.
+	Set(currency, rate string) (*FXRate, error)
+	Delete(currency string) error
+}
+
+// CouponStore persists coupons. Coupons are redeemed through OrderStore.CreatePending.
+type CouponStore interface {
+	// Create inserts a coupon; ErrConflict if the code is taken, ProductNotFoundError
+	// for an unknown restricted product.
+	Create(in CouponInput) (*Coupon, error)
+	// List returns every coupon, newest first, with its redemption totals.
+	List() ([]Coupon, error)
+	Get(id int) (*Coupon, error)
+	// Update replaces every field of a coupon, including its product restrictions.
+	Update(id int, in CouponInput) (*Coupon, error)
+	// Delete removes a coupon; orders keep the code they redeemed.
+	Delete(id int) error
+}
+
+// OrderStore persists orders, their lines, refunds and the payment events applied to them.
+type OrderStore interface {
+	// CreatePending locks the products and variants, reserves stock, applies the
+	// coupon, computes sales tax and records a pending order. It returns
+	// *InsufficientStockError, ProductNotFoundError, ProductArchivedError,
+	// *VariantNotFoundError, VariantRequiredError, *PriceChangedError,
+	// CouponError, UnsupportedCurrencyError or ErrCartCheckedOut when the order
+	// cannot be placed.
+	CreatePending(in NewOrder) (*Order, error)
+	// SetPaymentIntent links a pending order to its PaymentIntent and sets its
+	// status. Like a succeeded payment event, moving it to paid removes the cart
+	// items it checked out.
+	SetPaymentIntent(orderID int, paymentIntentID, status string) error
+	// Fail marks a pending order as failed and releases its stock reservation.
+	Fail(orderID int) error
+	// FailAbandoned fails the pending orders older than olderThan, releasing
+	// their stock, and returns their IDs. An order with a PaymentIntent, e.g. one
+	// whose 3-D Secure challenge was never finished, is only failed once
+	// cancel(paymentIntentID) reports the intent canceled; otherwise it stays
+	// pending for the intent's webhook.
+	FailAbandoned(olderThan time.Duration, cancel func(paymentIntentID string) bool) ([]int, error)
+	// GetForUser returns an order only if it belongs to userID.
+	GetForUser(orderID, userID int) (*Order, error)
+	ListHistory(userID int) ([]HistoryItem, error)
+	// ListSales returns the order lines matching filter. Amounts are converted
+	// to the base currency at the rate each order was priced at or, for orders
+	// priced without one, at the currency's current rate; with neither, they
+	// are unknown and left out of base-currency sums.
+	ListSales(filter SalesFilter) ([]SaleRecord, error)
+	// SalesTotals sums the orders ListSales would return that were paid
+	// (including later refunded or disputed ones), per currency.
+	SalesTotals(filter SalesFilter) ([]CurrencySalesTotal, error)
+	// TaxReport sums the sales and tax of orders that were paid (including later
+	// refunded or disputed ones) by billing province.
+	TaxReport(filter TaxReportFilter) ([]ProvinceTaxSummary, error)
+	// Refund locks the order and its lines, passes them to issue (which validates
+	// the request and moves the money) and records the refund it returns. Nothing
+	// is recorded if issue returns an error.
+	Refund(orderID, adminID int, issue func(o *RefundableOrder) (*Refund, error)) (*Refund, error)
+	// ApplyPaymentEvent records a provider event and applies it to the matching
+	// order. It returns false, without changing anything, for an already seen event.
+	ApplyPaymentEvent(ev PaymentEvent) (bool, error)
+	// SeenPaymentEvent reports whether ApplyPaymentEvent already recorded eventID.
+	SeenPaymentEvent(eventID string) (bool, error)
+}
+
+// TokenStore persists refresh tokens and revoked access tokens.
+type TokenStore interface {
+	// CreateRefreshToken stores the hash of a new refresh token in family, with
+	// the access token issued alongside it.
+	CreateRefreshToken(userID int, tokenHash, family string, ttl time.Duration, access AccessToken) error
+	// RotateRefreshToken revokes the token with oldHash and stores newHash, with
+	// the access token issued alongside it, in the same family. ErrNotFound,
+	// ErrTokenExpired or ErrTokenReused when it cannot.
+	RotateRefreshToken(oldHash, newHash string, ttl time.Duration, access AccessToken) (*User, error)
+	// Logout denylists an access token and, if refreshHash is not empty, revokes
+	// the refresh token family it belongs to.
+	Logout(userID int, jti string, expiresAt time.Time, refreshHash string) error
+	// RevokeUser revokes every refresh token family of a user and denylists the
+	// unexpired access tokens issued with them. ErrNotFound for an unknown user.
+	RevokeUser(userID int) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+// IdempotencyStore persists responses for requests sent with an Idempotency-Key.
+type IdempotencyStore interface {
+	// Claim reserves (userID, key) for a request; false if it was already
+	// claimed. A claim with the same requestHash that got no response within
+	// staleAfter, e.g. because the server crashed while running it, is taken over.
+	Claim(userID int, key, requestHash string, staleAfter time.Duration) (bool, error)
+	// Get returns the stored entry; Response is nil while the request is running.
+	Get(userID int, key string) (*IdempotencyRecord, error)
+	Save(userID int, key string, resp StoredResponse) error
+	// Release forgets a claim so the request can be retried.
+	Release(userID int, key string) error
+}
@@ -0,0 +1,108 @@
+// Package tax computes Canadian sales tax (GST/HST/PST/QST) by province.
+//
+// Rates are kept in thousandths of a percent so every calculation stays in
+// integer cents: 9.975% is 9975.
+package tax
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tax types.
+const (
+	GST = "GST"
+	HST = "HST"
+	PST = "PST"
+	QST = "QST"
+)
+
+// Product tax categories stored in products.tax_category. Exempt and
+// zero-rated supplies are both charged no tax; they are reported separately.
+const (
+	CategoryTaxable   = "taxable"
+	CategoryExempt    = "exempt"
+	CategoryZeroRated = "zero_rated"
+)
+
+// Rate is one tax levied in a province.
+type Rate struct {
+	Type string
+	// Thousandths is the rate in thousandths of a percent (5000 is 5%).
+	Thousandths int
+}
+
+// Percent formats the rate as a percentage, e.g. "9.975".
+func (r Rate) Percent() string {
+	s := strconv.Itoa(r.Thousandths/1000) + "." + strconv.Itoa(1000 + r.Thousandths%1000)[1:]
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// rates lists the taxes of each province and territory, by postal abbreviation.
+var rates = map[string][]Rate{
+	"AB": {{GST, 5000}},
+	"BC": {{GST, 5000}, {PST, 7000}},
+	"MB": {{GST, 5000}, {PST, 7000}},
+	"NB": {{HST, 15000}},
+	"NL": {{HST, 15000}},
+	"NS": {{HST, 14000}},
+	"NT": {{GST, 5000}},
+	"NU": {{GST, 5000}},
+	"ON": {{HST, 13000}},
+	"PE": {{HST, 15000}},
+	"QC": {{GST, 5000}, {QST, 9975}},
+	"SK": {{GST, 5000}, {PST, 6000}},
+	"YT": {{GST, 5000}},
+}
+
+// NormalizeProvince upper-cases a province code and reports whether it is known.
+func NormalizeProvince(province string) (string, bool) {
+	p := strings.ToUpper(strings.TrimSpace(province))
+	_, ok := rates[p]
+	return p, ok
+}
+
+// Provinces returns every known province code, sorted.
+func Provinces() []string {
+	codes := make([]string, 0, len(rates))
+	for p := range rates {
+		codes = append(codes, p)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ValidCategory reports whether category is a known tax category.
+func ValidCategory(category string) bool {
+	switch category {
+	case CategoryTaxable, CategoryExempt, CategoryZeroRated:
+		return true
+	}
+	return false
+}
+
+// Amount is one tax charged on a line.
+type Amount struct {
+	Type        string `json:"type"`
+	RatePercent string `json:"rate_percent"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// Line returns the taxes due in province on a line of the given category worth
+// amountCents (after discounts). Each tax is rounded half up to the cent.
+// Exempt and zero-rated lines, and unknown provinces, owe nothing.
+func Line(province, category string, amountCents int64) []Amount {
+	if category != CategoryTaxable || amountCents <= 0 {
+		return nil
+	}
+	var taxes []Amount
+	for _, r := range rates[province] {
+		taxes = append(taxes, Amount{
+			Type:        r.Type,
+			RatePercent: r.Percent(),
+			AmountCents: (amountCents*int64(r.Thousandths) + 50000) / 100000,
+		})
+	}
+	return taxes
+}
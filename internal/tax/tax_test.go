@@ -0,0 +1,109 @@
+package tax
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestRates(t *testing.T) {
+	for _, tc := range []struct {
+		province string
+		want     []Rate
+	}{
+		{"AB", []Rate{{GST, 5000}}},
+		{"BC", []Rate{{GST, 5000}, {PST, 7000}}},
+		{"MB", []Rate{{GST, 5000}, {PST, 7000}}},
+		{"NB", []Rate{{HST, 15000}}},
+		{"NL", []Rate{{HST, 15000}}},
+		{"NS", []Rate{{HST, 14000}}},
+		{"NT", []Rate{{GST, 5000}}},
+		{"NU", []Rate{{GST, 5000}}},
+		{"ON", []Rate{{HST, 13000}}},
+		{"PE", []Rate{{HST, 15000}}},
+		{"QC", []Rate{{GST, 5000}, {QST, 9975}}},
+		{"SK", []Rate{{GST, 5000}, {PST, 6000}}},
+		{"YT", []Rate{{GST, 5000}}},
+	} {
+		if got := rates[tc.province]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("rates[%s] = %v, want %v", tc.province, got, tc.want)
+		}
+	}
+	if got := Provinces(); len(got) != 13 || !slices.IsSorted(got) {
+		t.Errorf("Provinces() = %v, want the 13 provinces and territories, sorted", got)
+	}
+}
+
+func TestNormalizeProvince(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"ON", "ON", true},
+		{" qc ", "QC", true},
+		{"xx", "XX", false},
+		{"", "", false},
+	} {
+		if got, ok := NormalizeProvince(tc.in); got != tc.want || ok != tc.ok {
+			t.Errorf("NormalizeProvince(%q) = %q, %v; want %q, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for _, tc := range []struct {
+		thousandths int
+		want        string
+	}{
+		{5000, "5"},
+		{13000, "13"},
+		{9975, "9.975"},
+		{7500, "7.5"},
+		{12340, "12.34"},
+		{50, "0.05"},
+		{0, "0"},
+	} {
+		if got := (Rate{Thousandths: tc.thousandths}).Percent(); got != tc.want {
+			t.Errorf("Percent(%d) = %q, want %q", tc.thousandths, got, tc.want)
+		}
+	}
+}
+
+func TestLineRoundsEachTaxHalfUp(t *testing.T) {
+	for _, tc := range []struct {
+		province, category string
+		amountCents        int64
+		want               []int64
+	}{
+		// 13% of 50 is 6.5 cents, of 49 is 6.37
+		{"ON", CategoryTaxable, 50, []int64{7}},
+		{"ON", CategoryTaxable, 49, []int64{6}},
+		{"ON", CategoryTaxable, 1000, []int64{130}},
+		// 5% of 30 is 1.5 and 7% is 2.1; 5% of 29 is 1.45
+		{"BC", CategoryTaxable, 30, []int64{2, 2}},
+		{"BC", CategoryTaxable, 29, []int64{1, 2}},
+		// 5% of 10 is 0.5 and 9.975% is 0.9975: 2 cents, where 14.975% of 10
+		// rounded once would be 1
+		{"QC", CategoryTaxable, 10, []int64{1, 1}},
+		// 9.975% of 1000 is 99.75
+		{"QC", CategoryTaxable, 1000, []int64{50, 100}},
+		{"ON", CategoryExempt, 1000, nil},
+		{"ON", CategoryZeroRated, 1000, nil},
+		{"ON", CategoryTaxable, 0, nil},
+		{"XX", CategoryTaxable, 1000, nil},
+	} {
+		var got []int64
+		for _, a := range Line(tc.province, tc.category, tc.amountCents) {
+			got = append(got, a.AmountCents)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Line(%s, %s, %d) = %v, want %v", tc.province, tc.category, tc.amountCents, got, tc.want)
+		}
+	}
+
+	taxes := Line("QC", CategoryTaxable, 1000)
+	if taxes[0].Type != GST || taxes[0].RatePercent != "5" || taxes[1].Type != QST || taxes[1].RatePercent != "9.975" {
+		t.Errorf("Line(QC) = %+v, want GST at 5%% and QST at 9.975%%", taxes)
+	}
+}